@@ -0,0 +1,191 @@
+package perforce
+
+// Annotate - who last changed each line of a file.
+//
+//	res, err := p4.Annotate(perforce.NewFileSpec("//depot/loc/fr.po", perforce.HeadRev()),
+//		perforce.AnnotateOptions{FollowIntegrations: true})
+//	for _, l := range res.Lines {
+//		fmt.Println(l.Change, l.User, l.Text)
+//	}
+//
+// The content of utf16 text files is decoded (see DecodeText()).
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AnnotateOptions - p4 annotate options
+type AnnotateOptions struct {
+	FollowIntegrations bool // follow the integrations into the file (-I): Lower/Upper are changelists
+	AllLines           bool // include the deleted lines (-a)
+	IgnoreSpace        bool // ignore the changes in spaces (-db)
+	IgnoreAllSpace     bool // ignore all whitespace (-dw)
+	IgnoreLineEndings  bool // ignore the line endings (-dl)
+}
+
+// Line of an annotated file
+type T_AnnotateLine struct {
+	Text   string    // utf8, without end of line
+	Lower  int       // first revision (changelist with FollowIntegrations) the line is in
+	Upper  int       // last revision (changelist with FollowIntegrations) the line is in
+	Change int       // changelist of Lower
+	User   string    // author of Lower
+	Date   string    // date of Lower as returned by p4, i.e. 2021/03/04
+	Time   time.Time // Date in the server timezone
+}
+
+// Annotated file
+type T_AnnotateRes struct {
+	DepotFile string
+	Rev       int
+	Change    int
+	FileType  string
+	Encoding  string // see DetectEncoding()
+	Lines     []T_AnnotateLine
+}
+
+// Header and lines of p4 annotate -u output
+var annotateHeaderPattern = regexp.MustCompile(`^(//[^\n]*)#([0-9]+) - (\S+) change ([0-9]+) \(([^)]*)\)`)
+var annotateLinePattern = regexp.MustCompile(`^([0-9]+)(?:-([0-9]+))?: (\S+) ([0-9]{4}/[0-9]{2}/[0-9]{2}) `)
+
+// Revisions of p4 filelog output
+var filelogRevPattern = regexp.MustCompile(`(?m)^\.\.\. #([0-9]+) change ([0-9]+) `)
+
+// Annotate()
+//	Lines of a file with the revision and the author which last changed them:
+//	p4 annotate -u [-a] [-I] [-db|-dw] [-dl] file[revRange]
+// 	Input:
+//		- file, with an optional revision or revision range
+//		- options
+//  Return:
+//		- the decoded lines, the deleted ones too with AllLines
+//		- err code, nil if okay
+func (p *Perforce) Annotate(file FileSpec, opts AnnotateOptions) (res T_AnnotateRes, err error) {
+	p.logThis(fmt.Sprintf("Annotate(%s, %+v)", file, opts))
+
+	if file.Pattern {
+		return res, fmt.Errorf("Annotate() - A single file is expected: %s", file)
+	}
+	arg, err := p.fileSpecArg(file)
+	if err != nil {
+		return res, err
+	}
+
+	args := []string{"annotate", "-u"}
+	if opts.AllLines {
+		args = append(args, "-a")
+	}
+	if opts.FollowIntegrations {
+		args = append(args, "-I")
+	}
+	switch {
+	case opts.IgnoreAllSpace:
+		args = append(args, "-dw")
+	case opts.IgnoreSpace:
+		args = append(args, "-db")
+	}
+	if opts.IgnoreLineEndings {
+		args = append(args, "-dl")
+	}
+
+	out, err := p.execP4(nil, append(args, arg)...)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if err != nil {
+		return res, p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	records := bytes.Split(out, []byte{'\n'})
+	header := annotateHeaderPattern.FindSubmatch(bytes.TrimRight(records[0], "\r"))
+	if header == nil {
+		return res, p.errorf("Error parsing - no file header received from p4: %s", out)
+	}
+	res.DepotFile = UnescapePath(string(header[1]))
+	res.Rev, _ = strconv.Atoi(string(header[2]))
+	res.Change, _ = strconv.Atoi(string(header[4]))
+	res.FileType = string(header[5])
+
+	// Records are split on the '\n' bytes like p4 splits the content
+	var texts [][]byte
+	records = records[1:]
+	if n := len(records); n > 0 && len(records[n-1]) <= 0 {
+		records = records[:n-1]
+	}
+	for _, r := range records {
+		m := annotateLinePattern.FindSubmatchIndex(r)
+		if m == nil {
+			return res, p.errorf("Error parsing - unexpected line received from p4: %s", r)
+		}
+		var line T_AnnotateLine
+		line.Lower, _ = strconv.Atoi(string(r[m[2]:m[3]]))
+		line.Upper = line.Lower
+		if m[4] >= 0 {
+			line.Upper, _ = strconv.Atoi(string(r[m[4]:m[5]]))
+		} else if opts.FollowIntegrations {
+			line.Upper = res.Change
+		} else {
+			line.Upper = res.Rev
+		}
+		line.User = string(r[m[6]:m[7]])
+		line.Date = string(r[m[8]:m[9]])
+		line.Time = p.dateOf(line.Date)
+		res.Lines = append(res.Lines, line)
+		texts = append(texts, r[m[1]:])
+	}
+
+	var decoded []string
+	decoded, res.Encoding = decodeLines(texts)
+	for i := range res.Lines {
+		res.Lines[i].Text = decoded[i]
+	}
+	// Last '\n' of utf16 LE content: its nul byte is a line for p4
+	if n := len(texts); res.Encoding == EncodingUTF16LE && n > 0 && bytes.Equal(texts[n-1], []byte{0}) {
+		res.Lines = res.Lines[:n-1]
+	}
+
+	if opts.FollowIntegrations {
+		for i := range res.Lines {
+			res.Lines[i].Change = res.Lines[i].Lower
+		}
+		return res, nil
+	}
+
+	changes, err := p.revisionChanges(res.DepotFile, res.Rev)
+	if err != nil {
+		return res, err
+	}
+	for i := range res.Lines {
+		res.Lines[i].Change = changes[res.Lines[i].Lower]
+	}
+
+	return res, nil
+}
+
+// Changelists of the revisions of a file up to rev: p4 filelog file#rev
+func (p *Perforce) revisionChanges(depotFile string, rev int) (changes map[int]int, err error) {
+	arg, err := p.fileSpecArg(NewFileSpec(depotFile, RevNum(rev)))
+	if err != nil {
+		return changes, err
+	}
+	out, err := p.execP4(nil, "filelog", arg)
+	if err != nil {
+		return changes, p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	changes = make(map[int]int)
+	for _, m := range filelogRevPattern.FindAllStringSubmatch(string(out), -1) {
+		r, _ := strconv.Atoi(m[1])
+		cl, _ := strconv.Atoi(m[2])
+		changes[r] = cl
+	}
+	if len(changes) <= 0 {
+		return changes, p.errorf("Error parsing - no revision received from p4: %s", strings.TrimSpace(string(out)))
+	}
+	return changes, nil
+}
@@ -0,0 +1,123 @@
+package perforce_test
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+
+	perforce "github.com/fabdem/go-perforce"
+)
+
+// Text of the annotated lines
+func annotatedTexts(res perforce.T_AnnotateRes) (texts []string) {
+	for _, l := range res.Lines {
+		texts = append(texts, l.Text)
+	}
+	return texts
+}
+
+func TestAnnotate(t *testing.T) {
+	srv, p := newChangeServer(t)
+	second := srv.AddFile("//depot/a.txt", "text", "a\nb\n")
+	third := srv.AddFile("//depot/a.txt", "text", "a\nb  c\nd\n")
+
+	res, err := p.Annotate(perforce.NewFileSpec("//depot/a.txt", perforce.HeadRev()), perforce.AnnotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.DepotFile != "//depot/a.txt" || res.Rev != 3 || res.Change != third || res.FileType != "text" || res.Encoding != perforce.EncodingUTF8 {
+		t.Errorf("%+v", res)
+	}
+	if !reflect.DeepEqual(annotatedTexts(res), []string{"a", "b  c", "d"}) {
+		t.Fatalf("%q", annotatedTexts(res))
+	}
+	// Lines added by the revisions 1 and 3, changelist of the revision from p4 filelog
+	if l := res.Lines[0]; l.Lower != 1 || l.Upper != 3 || l.Change != 1 || l.User == "" || l.Time.IsZero() ||
+		l.Time.Format("2006/01/02") != l.Date {
+		t.Errorf("%+v", l)
+	}
+	if l := res.Lines[1]; l.Lower != 3 || l.Change != third {
+		t.Errorf("%+v", l)
+	}
+	if cmd := lastCommand(srv); cmd != "filelog //depot/a.txt#3" {
+		t.Errorf("%s", cmd)
+	}
+
+	// Older revision, whitespace ignored: b  c is b c
+	if res, err = p.Annotate(perforce.NewFileSpec("//depot/a.txt", perforce.RevNum(2)), perforce.AnnotateOptions{}); err != nil ||
+		!reflect.DeepEqual(annotatedTexts(res), []string{"a", "b"}) || res.Lines[1].Change != second {
+		t.Errorf("#2: %+v %v", res, err)
+	}
+	srv.AddFile("//depot/a.txt", "text", "a\nb c\nd\n")
+	if res, err = p.Annotate(perforce.NewFileSpec("//depot/a.txt", perforce.HeadRev()), perforce.AnnotateOptions{IgnoreSpace: true}); err != nil ||
+		res.Lines[1].Lower != 3 || res.Lines[1].Text != "b c" {
+		t.Errorf("-db: %+v %v", res, err)
+	}
+	if cmd := commandsOf(srv, "annotate"); len(cmd) <= 0 || cmd[len(cmd)-1] != "-u bob -c ws annotate -u -db //depot/a.txt#head" {
+		t.Errorf("%q", cmd)
+	}
+
+	if _, err = p.Annotate(perforce.FileSpec{Path: "//depot/...", Pattern: true}, perforce.AnnotateOptions{}); err == nil {
+		t.Errorf("pattern: no error")
+	}
+	if _, err = p.Annotate(perforce.NewFileSpec("//depot/none.txt", perforce.RevSpec{}), perforce.AnnotateOptions{}); err == nil {
+		t.Errorf("unknown file: no error")
+	}
+}
+
+// -a: ranges of revisions, -I: changelists instead of revisions
+func TestAnnotateRanges(t *testing.T) {
+	srv, p := newChangeServer(t)
+	second := srv.AddFile("//depot/a.txt", "text", "a\nb\n")
+
+	res, err := p.Annotate(perforce.NewFileSpec("//depot/a.txt", perforce.HeadRev()), perforce.AnnotateOptions{AllLines: true})
+	if err != nil || len(res.Lines) != 2 {
+		t.Fatalf("%+v %v", res, err)
+	}
+	if l := res.Lines[0]; l.Lower != 1 || l.Upper != 2 || l.Change != 1 {
+		t.Errorf("-a: %+v", l)
+	}
+	if cmd := commandsOf(srv, "annotate"); len(cmd) != 1 || cmd[0] != "-u bob -c ws annotate -u -a //depot/a.txt#head" {
+		t.Errorf("%q", cmd)
+	}
+
+	res, err = p.Annotate(perforce.NewFileSpec("//depot/a.txt", perforce.HeadRev()), perforce.AnnotateOptions{FollowIntegrations: true})
+	if err != nil || len(res.Lines) != 2 {
+		t.Fatalf("%+v %v", res, err)
+	}
+	if l := res.Lines[1]; l.Lower != second || l.Upper != second || l.Change != second {
+		t.Errorf("-I: %+v", l)
+	}
+	if cmd := lastCommand(srv); cmd != "annotate -u -I //depot/a.txt#head" {
+		t.Errorf("no filelog with -I: %s", cmd)
+	}
+}
+
+// Lines of a utf16 file are decoded
+func TestAnnotateUTF16(t *testing.T) {
+	srv, p := newChangeServer(t)
+	utf16LE := func(s string) string {
+		data := []byte{0xff, 0xfe}
+		for _, c := range utf16.Encode([]rune(s)) {
+			data = binary.LittleEndian.AppendUint16(data, c)
+		}
+		return string(data)
+	}
+	srv.AddFile("//depot/fr.po", "utf16", utf16LE("été\nhiver\n"))
+	srv.AddFile("//depot/fr.po", "utf16", utf16LE("été\nautomne\nhiver\n"))
+
+	res, err := p.Annotate(perforce.NewFileSpec("//depot/fr.po", perforce.HeadRev()), perforce.AnnotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Encoding != perforce.EncodingUTF16LE || res.FileType != "utf16" {
+		t.Errorf("%+v", res)
+	}
+	if !reflect.DeepEqual(annotatedTexts(res), []string{"été", "automne", "hiver"}) {
+		t.Fatalf("%q", annotatedTexts(res))
+	}
+	if res.Lines[0].Lower != 1 || res.Lines[1].Lower != 2 || res.Lines[2].Lower != 1 {
+		t.Errorf("%+v", res.Lines)
+	}
+}
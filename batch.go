@@ -0,0 +1,81 @@
+package perforce
+
+// Batching of long lists of files.
+//
+// A command line is limited in length (ARG_MAX on linux, 32K characters on windows).
+// When a list of files is too long it's passed to p4 in an argument file read
+// from stdin (p4 -x - <command>) instead of the command line.
+// Very long lists are also split in chunks - one p4 call per chunk - to limit the
+// load on the server; the outputs of all the chunks are merged.
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	argMaxLen        = 16 * 1024 // Max total length of the files passed on the command line
+	defaultBatchSize = 5000      // Default max number of files per p4 call
+)
+
+// SetBatchSize()
+//	Set the max number of files passed to a single p4 call by the methods accepting
+//	a list of files. Longer lists are split and processed in several calls.
+//	0 restores the default.
+//	Not safe if the instance is shared between goroutines - see WithOptions()
+func (p *Perforce) SetBatchSize(files int) {
+	p.batchSize = files
+}
+
+// GetBatchSize()
+func (p *Perforce) GetBatchSize() (files int) {
+	if p.batchSize <= 0 {
+		return defaultBatchSize
+	}
+	return p.batchSize
+}
+
+// execP4Files()
+//	Run a p4 command on a list of files: p4 <args> <files>
+//	The files are passed in an argument file (p4 -x -) when the command line would be
+//	too long, and split in chunks of GetBatchSize() files.
+//	Args may start with global options (i.e. -ztag) which are kept before -x.
+//	Returns the merged output of all the chunks and the last error if any.
+//	All the chunks are processed even if one fails since p4 reports missing files
+//	with an error status.
+func (p *Perforce) execP4Files(args []string, files []string) (out []byte, err error) {
+	if len(files) <= 0 {
+		return p.execP4(nil, args...)
+	}
+
+	// Short list - use the command line
+	length := 0
+	for _, f := range files {
+		length += len(f) + 1
+	}
+	if length <= argMaxLen && len(files) <= p.GetBatchSize() {
+		return p.execP4(nil, append(append([]string{}, args...), files...)...)
+	}
+
+	// Global options need to be before -x
+	i := 0
+	for i < len(args) && strings.HasPrefix(args[i], "-") {
+		i++
+	}
+	xargs := append(append(append([]string{}, args[:i]...), "-x", "-"), args[i:]...)
+
+	size := p.GetBatchSize()
+	p.logThis(fmt.Sprintf("	%d files processed in batches of %d", len(files), size))
+	for start := 0; start < len(files); start += size {
+		end := start + size
+		if end > len(files) {
+			end = len(files)
+		}
+		chunk, cerr := p.execP4(strings.NewReader(strings.Join(files[start:end], "\n")+"\n"), xargs...)
+		out = append(out, chunk...)
+		if cerr != nil {
+			err = cerr
+		}
+	}
+	return out, err
+}
@@ -0,0 +1,88 @@
+package perforce_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	perforce "github.com/fabdem/go-perforce"
+	"github.com/fabdem/go-perforce/perforcetest"
+)
+
+// Command lines received by the server for a p4 command
+func commandsOf(srv *perforcetest.Server, cmd string) (lines []string) {
+	for _, c := range srv.Commands() {
+		for i, a := range c {
+			if a == cmd && (i == 0 || !strings.HasPrefix(c[i-1], "-") || c[i-1] == "-") {
+				lines = append(lines, strings.Join(c, " "))
+				break
+			}
+		}
+	}
+	return lines
+}
+
+func TestBatches(t *testing.T) {
+	srv := perforcetest.NewServer()
+	root := t.TempDir()
+	srv.AddClient("ws", root, "//depot/... //ws/...")
+	p := srv.Perforce("bob", "ws").WithOptions(perforce.Options{BatchSize: 2})
+
+	files := []string{"//depot/1.txt", "//depot/2.txt", "//depot/3.txt", "//depot/4.txt", "//other/5.txt"}
+	res, err := p.WhereMany(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, w := range res {
+		if w.Input != files[i] || w.Mapped != (i < 4) || (w.Mapped && w.Path != filepath.Join(root, filepath.Base(files[i]))) {
+			t.Errorf("%d: %+v", i, w)
+		}
+	}
+	if where := commandsOf(srv, "where"); len(where) != 3 || where[0] != "-u bob -c ws -ztag -x - where" {
+		t.Errorf("%q", where)
+	}
+}
+
+// A few files with long names are passed in an argument file, in one call
+func TestLongCommandLine(t *testing.T) {
+	srv := perforcetest.NewServer()
+	srv.AddClient("ws", t.TempDir(), "//depot/... //ws/...")
+	p := srv.Perforce("bob", "ws")
+
+	var files []string
+	for _, c := range "abc" {
+		files = append(files, "//depot/"+strings.Repeat(string(c), 6000)+".txt")
+	}
+	res, err := p.WhereMany(files)
+	if err != nil || len(res) != 3 || !res[2].Mapped {
+		t.Fatalf("%d %v", len(res), err)
+	}
+	if where := commandsOf(srv, "where"); len(where) != 1 || where[0] != "-u bob -c ws -ztag -x - where" {
+		t.Errorf("%d calls", len(where))
+	}
+}
+
+// All the batches are run even if one fails, the error is returned
+func TestBatchFailure(t *testing.T) {
+	srv := perforcetest.NewServer()
+	srv.AddClient("ws", t.TempDir(), "//depot/... //ws/...")
+	p := srv.Perforce("bob", "ws").WithOptions(perforce.Options{BatchSize: 1})
+	cl := srv.CreateChange("bob", "ws", "fixes")
+	for i := 0; i < 2; i++ {
+		if _, err := p.PutJob(perforce.T_JobProperties{Job: "new", Fields: map[string]string{"Status": "open", "User": "bob", "Description": "job"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv.Fail("fix", "job000001 - no such job.\n", 1)
+	if err := p.Fix(cl, "", "job000001", "job000002"); err == nil || !strings.Contains(err.Error(), "no such job") {
+		t.Errorf("%v", err)
+	}
+	if fix := commandsOf(srv, "fix"); len(fix) != 2 || fix[1] != "-u bob -c ws -x - fix -c 1" {
+		t.Errorf("%q", fix)
+	}
+	c, err := p.GetCLSpecProperties(cl)
+	if err != nil || strings.Join(c.Jobs, " ") != "job000002" {
+		t.Errorf("%+v %v", c.Jobs, err)
+	}
+}
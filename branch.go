@@ -0,0 +1,280 @@
+package perforce
+
+// Branch specs and changes to integrate through them.
+//
+//	b, err := p4.GetBranch("main-to-rel")
+//	b.View.Add(perforce.MapInclude, "//depot/main/doc/...", "//depot/rel/doc/...")
+//	_, err = p4.PutBranch(b, false)
+//	changes, err := p4.Interchanges("main-to-rel", false)
+//
+// Both sides of a branch view are depot paths in p4 syntax (escaped).
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Branch specification
+type T_BranchProperties struct {
+	Branch      string
+	Update      string    // The date this specification was last modified.
+	Time        time.Time // Update in the server timezone. Read-only.
+	Access      string
+	Owner       string
+	Description string   // Lines are separated by "\n".
+	Options     []string // unlocked/locked
+	View        *ViewMap // Source (Left) and target (Right) depot paths, in order - not set by GetBranches()
+	Eol         string   // Detect what kind of end of line we receive from the server.
+	Form        string   // Form as it was received
+}
+
+// BranchFilter - branch specs listed by GetBranches(). The criteria are combined (and).
+type BranchFilter struct {
+	Owner           string
+	Name            string // name or pattern with * wildcards, i.e. main-to-*
+	CaseInsensitive bool   // match of Name
+	Max             int    // max number of branch specs, 0 for no limit
+}
+
+// Changelist as listed by p4 changes or p4 interchanges
+type T_ChangeSummary struct {
+	Change      int
+	Time        time.Time // in the server timezone
+	User        string
+	Client      string
+	Status      string // pending, shelved or submitted
+	Description string // Lines are separated by "\n".
+}
+
+// GetBranches()
+//	List the branch specs: p4 branches [-u owner] [-e|-E name] [-m max]
+//	The views of the specs aren't returned, see GetBranch().
+func (p *Perforce) GetBranches(filter BranchFilter) (branches []T_BranchProperties, err error) {
+	p.logThis(fmt.Sprintf("GetBranches(%+v)", filter))
+
+	args := []string{"-ztag", "branches"}
+	if len(filter.Owner) > 0 {
+		args = append(args, "-u", filter.Owner)
+	}
+	if len(filter.Name) > 0 {
+		if filter.CaseInsensitive {
+			args = append(args, "-E", filter.Name)
+		} else {
+			args = append(args, "-e", filter.Name)
+		}
+	}
+	if filter.Max > 0 {
+		args = append(args, "-m", strconv.Itoa(filter.Max))
+	}
+
+	out, err := p.execP4(nil, args...)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if err != nil {
+		return branches, p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	records, _ := parseZtag(out)
+	for _, r := range records {
+		var b T_BranchProperties
+		if b.Branch = r["branch"]; len(b.Branch) <= 0 {
+			if b.Branch = r["Branch"]; len(b.Branch) <= 0 {
+				continue
+			}
+		}
+		b.Time = p.dateOf(r["Update"])
+		b.Update = r["Update"]
+		if !b.Time.IsZero() {
+			b.Update = b.Time.Format("2006/01/02 15:04:05")
+		}
+		b.Access = r["Access"]
+		if t := p.dateOf(r["Access"]); !t.IsZero() {
+			b.Access = t.Format("2006/01/02 15:04:05")
+		}
+		b.Owner = r["Owner"]
+		b.Description = r["Description"]
+		b.Options = strings.Fields(r["Options"])
+		branches = append(branches, b)
+	}
+
+	return branches, nil
+}
+
+// GetBranch()
+//	Get a branch spec: p4 branch -o branch
+//	The server returns a default spec if the branch spec doesn't exist.
+func (p *Perforce) GetBranch(branch string) (properties T_BranchProperties, err error) {
+	p.logThis(fmt.Sprintf("GetBranch(%s)", branch))
+
+	if len(branch) <= 0 {
+		return properties, fmt.Errorf("GetBranch() - No branch specified")
+	}
+
+	spec, err := p.GetSpec("branch", branch)
+	if err != nil {
+		return properties, err
+	}
+	if !spec.Has("Branch") {
+		return properties, p.errorf("Error parsing - not a branch spec received from p4: %s", spec)
+	}
+
+	properties.Eol = spec.Eol
+	properties.Branch = spec.Get("Branch")
+	properties.Update = spec.Get("Update")
+	properties.Time = p.dateOf(properties.Update)
+	properties.Access = spec.Get("Access")
+	properties.Owner = spec.Get("Owner")
+	properties.Description = spec.Get("Description")
+	properties.Options = strings.Fields(spec.Get("Options"))
+	properties.View, err = ParseViewMap(spec.GetLines("View"))
+	if err != nil {
+		return properties, err
+	}
+	if info, err := p.serverInfo(); err == nil {
+		properties.View.CaseInsensitive = info.CaseInsensitive
+	} else {
+		p.logThis(fmt.Sprintf("	Warning - case handling of the server unknown: %v", err))
+	}
+
+	properties.Form = spec.String()
+
+	return properties, nil
+}
+
+// PutBranch()
+//	Create or update a branch spec: p4 branch -i [-f]
+//	If properties.Form is set (i.e. returned by GetBranch()) it's used
+//	as a base and only the modified fields are rewritten.
+//	force (-f) allows the update of a branch spec owned by another user (admin).
+//	Returns the server response, i.e. "Branch main-to-rel saved."
+func (p *Perforce) PutBranch(properties T_BranchProperties, force bool) (response string, err error) {
+	p.logThis(fmt.Sprintf("PutBranch(%s, %t)", properties.Branch, force))
+
+	if len(properties.Branch) <= 0 {
+		return response, fmt.Errorf("PutBranch() - No branch specified")
+	}
+
+	spec := NewSpec()
+	if len(properties.Form) > 0 {
+		spec, err = ParseSpec(properties.Form)
+		if err != nil {
+			return response, err
+		}
+	}
+	if len(properties.Eol) > 0 {
+		spec.Eol = properties.Eol
+	}
+
+	spec.Set("Branch", properties.Branch)
+	if len(properties.Owner) > 0 {
+		spec.Set("Owner", properties.Owner)
+	}
+	descr := strings.TrimRight(strings.ReplaceAll(properties.Description, "\r\n", "\n"), "\n")
+	spec.SetLines("Description", strings.Split(descr, "\n"))
+	if len(properties.Options) > 0 {
+		spec.Set("Options", strings.Join(properties.Options, " "))
+	}
+	if properties.View != nil && len(properties.View.Mappings) > 0 {
+		spec.SetLines("View", properties.View.Lines())
+	}
+	if len(spec.GetLines("View")) <= 0 {
+		return response, fmt.Errorf("PutBranch() - No view for branch %s", properties.Branch)
+	}
+
+	var flags []string
+	if force {
+		flags = append(flags, "-f")
+	}
+	return p.PutSpec("branch", spec, flags...)
+}
+
+// DeleteBranch()
+//	Delete a branch spec: p4 branch -d [-f] branch
+//	force (-f) allows the deletion of a locked branch spec or of a branch spec owned by another user (admin).
+func (p *Perforce) DeleteBranch(branch string, force bool) (err error) {
+	p.logThis(fmt.Sprintf("DeleteBranch(%s, %t)", branch, force))
+
+	if len(branch) <= 0 {
+		return fmt.Errorf("DeleteBranch() - No branch specified")
+	}
+
+	args := []string{"branch", "-d"}
+	if force {
+		args = append(args, "-f")
+	}
+	out, err := p.execP4(nil, append(args, branch)...)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if err != nil {
+		return p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+	if !strings.Contains(string(out), "deleted") {
+		return p.errorf("Error unexpected response. Received %s", out)
+	}
+
+	return nil
+}
+
+// Interchanges()
+//	List the changelists not yet integrated through a branch spec:
+//	p4 interchanges -l [-r] -b branch [file...]
+// 	Input:
+//		- branch spec
+//		- reverse: changes of the target (right side) not integrated into the source (-r)
+//		- optional target files to limit the list, with an optional revision
+//  Return:
+//		- the changelists sorted by number - none if everything is integrated
+//		- err code, nil if okay
+func (p *Perforce) Interchanges(branch string, reverse bool, files ...FileSpec) (changes []T_ChangeSummary, err error) {
+	p.logThis(fmt.Sprintf("Interchanges(%s, %t, %v)", branch, reverse, files))
+
+	if len(branch) <= 0 {
+		return changes, fmt.Errorf("Interchanges() - No branch specified")
+	}
+
+	args := []string{"-ztag", "interchanges", "-l"}
+	if reverse {
+		args = append(args, "-r")
+	}
+	args = append(args, "-b", branch)
+	fileArgs := make([]string, len(files))
+	for i, f := range files {
+		if fileArgs[i], err = p.fileSpecArg(f); err != nil {
+			return changes, err
+		}
+	}
+
+	out, err := p.execP4Files(args, fileArgs)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	records, messages := parseZtag(out)
+	if err != nil && !allBenign(messages, nothingToIntegPattern) {
+		return changes, p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	seen := make(map[int]bool) // changes can be listed by several batches
+	for _, r := range records {
+		cl, err := strconv.Atoi(r["change"])
+		if err != nil || seen[cl] {
+			continue
+		}
+		seen[cl] = true
+		changes = append(changes, T_ChangeSummary{
+			Change:      cl,
+			Time:        p.dateOf(r["time"]),
+			User:        r["user"],
+			Client:      r["client"],
+			Status:      r["status"],
+			Description: r["desc"],
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Change < changes[j].Change })
+
+	return changes, nil
+}
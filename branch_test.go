@@ -0,0 +1,118 @@
+package perforce_test
+
+import (
+	"reflect"
+	"testing"
+
+	perforce "github.com/fabdem/go-perforce"
+)
+
+func TestBranchSpecs(t *testing.T) {
+	srv, p := newChangeServer(t)
+
+	b, err := p.GetBranch("lib-to-rel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.View.Lines()) != 0 {
+		t.Errorf("view of a new branch: %v", b.View)
+	}
+	if _, err = p.PutBranch(b, false); err == nil {
+		t.Errorf("branch without view: no error")
+	}
+
+	b.Description = "Library\nto release"
+	b.View.Add(perforce.MapInclude, "//depot/lib/...", "//depot/rel/...")
+	b.View.Add(perforce.MapExclude, "//depot/lib/tmp/...", "//depot/rel/tmp/...")
+	b.View.Add(perforce.MapInclude, "//depot/sp ace/...", "//depot/rel/sp ace/...")
+	if res, err := p.PutBranch(b, false); err != nil || res != "Branch lib-to-rel saved." {
+		t.Fatalf("%s %v", res, err)
+	}
+	if cmd := lastCommand(srv); cmd != "branch -i" {
+		t.Errorf("%s", cmd)
+	}
+
+	// Round trip of the view, in order
+	b, err = p.GetBranch("lib-to-rel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	view := []string{"//depot/lib/... //depot/rel/...", "-//depot/lib/tmp/... //depot/rel/tmp/...",
+		`"//depot/sp ace/..." "//depot/rel/sp ace/..."`}
+	if b.Owner != "bob" || b.Description != "Library\nto release" || !reflect.DeepEqual(b.View.Lines(), view) {
+		t.Errorf("%+v %q", b, b.View.Lines())
+	}
+	if target, ok := b.View.DepotToClient("//depot/lib/c.txt"); !ok || target != "//depot/rel/c.txt" {
+		t.Errorf("c.txt: %s %t", target, ok)
+	}
+	if _, ok := b.View.DepotToClient("//depot/lib/tmp/c.txt"); ok {
+		t.Errorf("excluded file mapped")
+	}
+
+	p.PutBranch(perforce.T_BranchProperties{Branch: "main-to-rel", View: mustViewMap(t, "//depot/main/... //depot/rel/...")}, false)
+	branches, err := p.GetBranches(perforce.BranchFilter{Name: "LIB-*", CaseInsensitive: true, Owner: "bob"})
+	if err != nil || len(branches) != 1 || branches[0].Branch != "lib-to-rel" || branches[0].View != nil {
+		t.Fatalf("%+v %v", branches, err)
+	}
+	if b := branches[0]; b.Time.IsZero() || b.Time.Format("2006/01/02 15:04:05") != b.Update {
+		t.Errorf("update %q %v", b.Update, b.Time)
+	}
+	if cmd := lastCommandOf(srv, "branches"); cmd != "branches -u bob -E LIB-*" {
+		t.Errorf("%s", cmd)
+	}
+	if branches, _ = p.GetBranches(perforce.BranchFilter{Max: 1}); len(branches) != 1 {
+		t.Errorf("max: %+v", branches)
+	}
+
+	if err = p.DeleteBranch("main-to-rel", false); err != nil {
+		t.Fatal(err)
+	}
+	if branches, _ = p.GetBranches(perforce.BranchFilter{}); len(branches) != 1 {
+		t.Errorf("deleted: %+v", branches)
+	}
+	if err = p.DeleteBranch("main-to-rel", false); err == nil {
+		t.Errorf("unknown branch: no error")
+	}
+}
+
+func TestInterchanges(t *testing.T) {
+	srv, p := newChangeServer(t)
+	first := srv.AddFile("//depot/lib/c.txt", "text", "c\n")
+	second := srv.AddFile("//depot/lib/c.txt", "text", "c\nd\n")
+	srv.AddFile("//depot/lib/e.txt", "text", "e\n")
+	p.PutBranch(perforce.T_BranchProperties{Branch: "lib-to-rel", View: mustViewMap(t, "//depot/lib/... //depot/rel/...")}, false)
+
+	changes, err := p.Interchanges("lib-to-rel", false, perforce.NewFileSpec("//depot/rel/c.txt", perforce.RevSpec{}))
+	if err != nil || len(changes) != 2 || changes[0].Change != first || changes[1].Change != second {
+		t.Fatalf("%+v %v", changes, err)
+	}
+	if c := changes[0]; c.Status != "submitted" || c.Time.IsZero() || c.Description == "" {
+		t.Errorf("%+v", c)
+	}
+	if cmd := lastCommandOf(srv, "interchanges"); cmd != "interchanges -l -b lib-to-rel //depot/rel/c.txt" {
+		t.Errorf("%s", cmd)
+	}
+
+	// Integrated: the target has the content of the source
+	srv.AddFile("//depot/rel/c.txt", "text", "c\nd\n")
+	if changes, err = p.Interchanges("lib-to-rel", false, perforce.NewFileSpec("//depot/rel/c.txt", perforce.RevSpec{})); err != nil || len(changes) != 0 {
+		t.Errorf("integrated: %+v %v", changes, err)
+	}
+	if changes, err = p.Interchanges("lib-to-rel", true); err != nil || len(changes) != 0 {
+		t.Errorf("reverse: %+v %v", changes, err)
+	}
+	if _, err = p.Interchanges("none", false); err == nil {
+		t.Errorf("unknown branch: no error")
+	}
+	if _, err = p.Interchanges("", false); err == nil {
+		t.Errorf("no branch: no error")
+	}
+}
+
+func mustViewMap(t *testing.T, lines ...string) *perforce.ViewMap {
+	v, err := perforce.ParseViewMap(lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
@@ -4,14 +4,14 @@ package perforce
 
 import (
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // GetP4Where()
@@ -31,35 +31,131 @@ import (
 func (p *Perforce) GetP4Where(depotFile string) (fileName string, err error) {
 	p.logThis(fmt.Sprintf("GetP4Where(%s)", depotFile))
 
-	var out []byte
-
-	if len(p.user) > 0 {
-		out, err = exec.Command(p.p4Cmd, "-ztag", "-u", p.user, "-c", p.workspace, "where", depotFile).CombinedOutput()
-		// fmt.Printf("P4 command line result - %s\n %s\n", err, out)
-	} else {
-		out, err = exec.Command(p.p4Cmd, "-ztag", "-c", p.workspace, "where", depotFile).CombinedOutput()
-	}
+	res, err := p.WhereMany([]string{depotFile})
 	if err != nil {
-		return fileName, fmt.Errorf("p4 command line error %s - %s ", err, out)
+		return fileName, err
 	}
-	p.logThis(fmt.Sprintf("	Response=%s", string(out)))
-
-	// Parse result
-	fields := strings.Split(string(out), "... path ")
-	if len(fields) < 2 {
-		return fileName, fmt.Errorf("p4 command line parsing result error %s - %s ", err, fields)
+	if len(res) < 1 || !res[0].Mapped {
+		return fileName, fmt.Errorf("p4 command line parsing result error - file not in client view: %s", depotFile)
 	}
-	fileName = fields[1]
-	fileName = strings.Trim(fields[1], "\r\n")
+	fileName = res[0].Path
 	p.logThis(fmt.Sprintf("	filename=%s", fileName))
 
 	return fileName, nil
 }
 
+// Result of a p4 where for one path
+type T_WhereProperties struct {
+	Input      string // Path as requested
+	DepotFile  string // Depot syntax
+	ClientFile string // Client syntax
+	Path       string // Local syntax
+	Mapped     bool   // false if not in client view or excluded
+	Unmap      bool   // true if excluded by a view line
+}
+
+// WhereMany()
+//	Get depot, workspace and local path of many files with one p4 call.
+//	Long lists are passed in an argument file and split in batches (see SetBatchSize()).
+// 	Input:
+//		- files in depot (//depot/...), client (//my_ws/...) or local syntax. No wildcards.
+//		  Paths aren't escaped: @ # % * are escaped before being sent to p4 and
+//		  depot and client paths returned are unescaped (see EscapePath()).
+//  Returns:
+//		- one entry per file in the same order. Files not in the client view or
+//		  excluded are returned with Mapped false.
+//		- err code, nil if okay
+//
+//	p4 -ztag -c<workspace> -u<user> where <files>
+//	Returns:
+//		... depotFile //somewhere/in/depot/a/file
+//		... clientFile //somewhere/in/client/a/file
+//		... path D:\a\local\path\file
+//
+//		... depotFile -//somewhere/in/depot/excluded/file
+//		... clientFile -//somewhere/in/client/excluded/file
+//		... path D:\a\local\path\excluded\file
+//		... unmap
+//
+//		//somewhere/else/file - file(s) not in client view.
+//
+func (p *Perforce) WhereMany(files []string) (res []T_WhereProperties, err error) {
+	p.logThis(fmt.Sprintf("WhereMany(%d files)", len(files)))
+
+	if len(files) <= 0 {
+		return res, nil
+	}
+	if len(p.workspace) <= 0 {
+		return res, fmt.Errorf("P4 command line error - a workspace needs to be defined")
+	}
+
+	// Local paths need to be absolute to be matched in the response
+	paths := make([]string, len(files))
+	args := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f
+		if !strings.HasPrefix(f, "//") {
+			if abs, err := filepath.Abs(f); err == nil {
+				paths[i] = abs
+			}
+		}
+		args[i] = EscapePath(paths[i])
+	}
+
+	out, err := p.execP4Files([]string{"-ztag", "where"}, args)
+
+	p.logThis(fmt.Sprintf("	Response=%s", out))
+
+	records, _ := parseZtag(out)
+	if err != nil && len(records) <= 0 && !strings.Contains(string(out), "not in client view") {
+		return res, p.errorf("p4 command line error %s - %s ", err, out)
+	}
+
+	// Index the records by depot, client and local path
+	index := make(map[string][]T_WhereProperties)
+	for _, r := range records {
+		w := T_WhereProperties{
+			DepotFile:  UnescapePath(strings.TrimPrefix(r["depotFile"], "-")),
+			ClientFile: UnescapePath(strings.TrimPrefix(r["clientFile"], "-")),
+			Path:       r["path"],
+		}
+		_, w.Unmap = r["unmap"]
+		w.Mapped = !w.Unmap
+		for _, k := range []string{w.DepotFile, w.ClientFile, whereKey(w.Path)} {
+			if len(k) > 0 {
+				index[k] = append(index[k], w)
+			}
+		}
+	}
+
+	// Match the records with the paths requested.
+	// Several records may be returned for a path (overlay mappings) - keep the mapped one.
+	res = make([]T_WhereProperties, len(files))
+	for i, f := range files {
+		res[i].Input = f
+		for _, w := range index[whereKey(paths[i])] {
+			if w.Mapped || !res[i].Mapped {
+				res[i] = w
+				res[i].Input = f
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// Key to match local paths: windows paths are case insensitive and accept any separator
+func whereKey(path string) string {
+	if strings.Contains(path, `\`) {
+		return strings.ToLower(strings.ReplaceAll(path, `\`, "/"))
+	}
+	return path
+}
+
 // GetFile()
 //	Get a file from depot
-// 	Depot file base name expected
-// 	Revision number or 0 if head rev is needed
+// 	Depot file base name expected - not escaped (i.e. //depot/icon@2x.png)
+// 	Revision number or 0 if head rev is needed - see GetFileAt() for other revisions
 //  The caller needs to dispose of the temp file
 //  Return:
 //		- the file in a temp file in os.TempDir()
@@ -68,18 +164,44 @@ func (p *Perforce) GetP4Where(depotFile string) (fileName string, err error) {
 func (p *Perforce) GetFile(depotFile string, rev int) (tempFile string, fileName string, err error) {
 	p.logThis(fmt.Sprintf("GetFile(%s, %d)", depotFile, rev))
 
-	fileName = filepath.Base(depotFile) // extract filename
-	ext := filepath.Ext(depotFile)      // Read extension
-
+	file := NewFileSpec(depotFile, HeadRev())
 	if rev > 0 { // If a specific version is requested
-		fileName = fileName[0:len(fileName)-len(ext)] + "#" + strconv.Itoa(rev) + ext
-	} else { // Get head rev
-		rev, err = p.GetHeadRev(depotFile)
+		file.Rev = RevNum(rev)
+	}
+	return p.GetFileAt(file)
+}
+
+// GetFileAt()
+//	Get a revision of a file from depot: #n, #head, @change, @label, @=shelf...
+//	Same as GetFile(). A pattern or a range of revisions is an error.
+func (p *Perforce) GetFileAt(file FileSpec) (tempFile string, fileName string, err error) {
+	p.logThis(fmt.Sprintf("GetFileAt(%s)", file))
+
+	fileName = filepath.Base(file.Path) // extract filename
+	ext := filepath.Ext(file.Path)      // Read extension
+
+	if err = file.Validate(); err != nil {
+		return tempFile, fileName, err
+	}
+	if file.Pattern || file.From.Kind != RevUnspecified {
+		return tempFile, fileName, fmt.Errorf("GetFileAt() - a single file revision is expected: %s", file)
+	}
+
+	rev := file.Rev.Number
+	if file.Rev.Kind != RevNumber { // Identify the revision
+		res, err := p.GetP4FilesAt(file)
 		if err != nil {
 			return tempFile, fileName, err
 		}
-		fileName = fileName[0:len(fileName)-len(ext)] + "#" + strconv.Itoa(rev) + ext
-	} // fileName is provided as a convenience
+		if len(res) <= 0 {
+			return tempFile, fileName, fmt.Errorf("GetFileAt() - no such file: %s", file)
+		}
+		rev = res[0].HeadRevision
+		if file.Rev.Kind != RevShelf { // print the revision identified - shelved content otherwise
+			file.Rev = RevNum(rev)
+		}
+	}
+	fileName = fileName[0:len(fileName)-len(ext)] + "#" + strconv.Itoa(rev) + ext // fileName is provided as a convenience
 
 	p.logThis(fmt.Sprintf("	fileName=%s rev=%d", fileName, rev))
 
@@ -90,16 +212,9 @@ func (p *Perforce) GetFile(depotFile string, rev int) (tempFile string, fileName
 	tempFile = tempf.Name()
 	tempf.Close()
 
-	var out []byte
-
-	if len(p.user) > 0 {
-		out, err = exec.Command(p.p4Cmd, "-u", p.user, "print", "-k", "-q", "-o", tempFile, depotFile+"#"+strconv.Itoa(rev)).CombinedOutput()
-		// fmt.Printf("P4 command line result - %s\n %s\n", err, out)
-	} else {
-		out, err = exec.Command(p.p4Cmd, "print", "-k", "-q", "-o", tempFile, depotFile+"#"+strconv.Itoa(rev)).CombinedOutput()
-	}
+	out, err := p.execP4(nil, "print", "-k", "-q", "-o", tempFile, file.String())
 	if err != nil {
-		return tempFile, fileName, fmt.Errorf("p4 command line error %s - %s ", err, out)
+		return tempFile, fileName, p.errorf("p4 command line error %s - %s ", err, out)
 	}
 
 	// 2EME PROBLEME POURQUOI CA PANIQUE SI ERROR DS GETFILE (REMOVE USER)
@@ -109,9 +224,9 @@ func (p *Perforce) GetFile(depotFile string, rev int) (tempFile string, fileName
 	// So manually checking if a file was created:
 	if _, err = os.Stat(tempFile); err != nil {
 		if os.IsNotExist(err) { // file does not exist
-			return tempFile, fileName, fmt.Errorf("P4 no file created %v - %v ", out, err)
+			return tempFile, fileName, p.errorf("P4 no file created %v - %v ", out, err)
 		} else { // Can't get file stat
-			return tempFile, fileName, fmt.Errorf("Can't access the status of file produced %v - %v ", out, err)
+			return tempFile, fileName, p.errorf("Can't access the status of file produced %v - %v ", out, err)
 		}
 	}
 	return tempFile, fileName, nil // everything is fine returns file and file name
@@ -132,45 +247,60 @@ type T_FilesProperties struct {
 // 	depotFilePattern: file path and name or pattern in P4.
 //										May return several matches.
 //  Returns a slice with 1 line of details per file. If empty, means no match. Doesn't return an error!
+//
+//	Deprecated: use GetP4FilesAt(). depotFilePattern is passed as is to p4: @ # % *
+//	in names must be escaped (%40 %23 %25 %2A).
 func (p *Perforce) GetP4Files(depotFilePattern string) (properties []T_FilesProperties, err error) {
 	p.logThis(fmt.Sprintf("GetP4Files(%s)", depotFilePattern))
 
-	var out []byte
+	return p.p4Files([]string{depotFilePattern})
+}
 
-	if len(p.user) > 0 {
-		// fmt.Printf(p4Cmd + " -u " + user + " files -e" + " " + depotFile + "\n")
-		out, err = exec.Command(p.p4Cmd, "-u", p.user, "files", "-e", depotFilePattern).CombinedOutput()
-		//fmt.Printf("P4 command line result - err=%s\n out=%s\n", err, out)
-	} else {
-		//fmt.Printf(p.p4Cmd  + " files -e" + " " + depotFileName + "\n")
-		out, err = exec.Command(p.p4Cmd, "files", "-e", depotFilePattern).CombinedOutput()
-		// out, err := exec.Command(p.p4Cmd, "info").Output()
-	}
-	if err != nil {
-		return properties, fmt.Errorf("P4 command line error %v  out=%s", err, out)
+// GetP4FilesAt()
+//	Same as GetP4Files() with file specifiers, i.e. to list the files of a label or
+//	at a changelist. The paths are not escaped (see the path conventions in filespec.go).
+//	Long lists are split in batches (see SetBatchSize()).
+func (p *Perforce) GetP4FilesAt(files ...FileSpec) (properties []T_FilesProperties, err error) {
+	p.logThis(fmt.Sprintf("GetP4FilesAt(%v)", files))
+
+	args := make([]string, len(files))
+	for i, f := range files {
+		if args[i], err = p.fileSpecArg(f); err != nil {
+			return properties, err
+		}
 	}
+	return p.p4Files(args)
+}
+
+func (p *Perforce) p4Files(depotFilePatterns []string) (properties []T_FilesProperties, err error) {
+	out, err := p.execP4Files([]string{"files", "-e"}, depotFilePatterns)
 
 	p.logThis(fmt.Sprintf("	received from P4: %s", out))
 
-	// Parse response
-	if strings.HasSuffix(strings.TrimRight(string(out), "\t\r\n "), "no such file(s).") {
-		return properties, nil // If p4 returns that file not found, skip the rest and return empty list but no error.
+	pattern, rerr := regexp.Compile(`(?m)^(//.*)#([0-9]*) - ([a-z/]*) change ([0-9]*) \((.*)\)[\r\n]*`)
+	if rerr != nil {
+		return properties, fmt.Errorf("Regex compile error: %v", rerr)
 	}
 
-	pattern, err := regexp.Compile(`(?m)^(//.*)#([0-9]*) - ([a-z]*) change ([0-9]*) \((.*)\)[\r\n]*`)
 	if err != nil {
-		return properties, fmt.Errorf("Regex compile error: %v", err)
+		// If p4 returns that files are not found, skip them - no error.
+		for _, line := range strings.Split(strings.TrimRight(string(out), "\t\r\n "), "\n") {
+			line = strings.TrimRight(line, "\t\r ")
+			if !pattern.MatchString(line) && !strings.HasSuffix(line, "no such file(s).") {
+				return properties, p.errorf("P4 command line error %v  out=%s", err, out)
+			}
+		}
 	}
 
 	list := pattern.FindAllSubmatch(out, -1)
 
 	for _, line := range list {
 		if len(line) < 6 {
-			return properties, fmt.Errorf("Parsing error - %d field found in %s ", len(line), line)
+			return properties, p.errorf("Parsing error - %d field found in %s ", len(line), line)
 		}
 
 		var det T_FilesProperties
-		det.DepotfileLoc = string(line[1])
+		det.DepotfileLoc = UnescapePath(string(line[1]))
 		rev, err := strconv.Atoi(string(line[2])) // Check format
 		if err != nil {
 			return properties, fmt.Errorf("Format error conv to number: %v", err)
@@ -192,13 +322,13 @@ func (p *Perforce) GetP4Files(depotFilePattern string) (properties []T_FilesProp
 
 // GetHeadRev()
 //	Get from P4 the head revision number of a file from depot
-// 	depotFileName: file path and name in P4
+// 	depotFileName: file path and name in P4 - not escaped (i.e. //depot/icon@2x.png)
 //	If file is not found returns rev negative
 //	err not nil if processing error
 func (p *Perforce) GetHeadRev(depotFileName string) (rev int, err error) {
 	p.logThis(fmt.Sprintf("GetHeadRev(%s)", depotFileName))
 
-	res, err := p.GetP4Files(depotFileName)
+	res, err := p.GetP4FilesAt(NewFileSpec(depotFileName, RevSpec{}))
 
 	if len(res) > 0 {
 		rev = res[0].HeadRevision
@@ -213,12 +343,12 @@ func (p *Perforce) GetHeadRev(depotFileName string) (rev int, err error) {
 
 // CheckFileExitsInDepot()
 //	Check if a path exists in the depot.
-// 	depotFileName: file path and name in P4
+// 	depotFileName: file path and name in P4 - not escaped (i.e. //depot/icon@2x.png)
 //	Returns a boolean and err.
 func (p *Perforce) CheckFileExitsInDepot(depotFileName string) (exists bool, err error) {
 	p.logThis(fmt.Sprintf("CheckFileExitsInDepot(%s)", depotFileName))
 
-	res, err := p.GetP4Files(depotFileName)
+	res, err := p.GetP4FilesAt(NewFileSpec(depotFileName, RevSpec{}))
 
 	if len(res) > 0 {
 		exists = true
@@ -230,6 +360,7 @@ func (p *Perforce) CheckFileExitsInDepot(depotFileName string) (exists bool, err
 // GetCLContent()
 //	Get content from a Change List
 //	Do a: p4 -uxxxxx describe -s 6102201
+//	The first call of the instance also runs p4 info for the server timezone (see ServerLocation()).
 // 	Input:
 //		- Change List number
 //  Return:
@@ -254,6 +385,7 @@ type T_CLProperties struct {
 	User      string
 	Workspace string
 	DateStamp string
+	Time      time.Time // DateStamp in the server timezone
 	Pending   bool
 	Comment   string
 	List      map[string]T_CLFileProperties // map file path/name and properties
@@ -262,19 +394,9 @@ type T_CLProperties struct {
 func (p *Perforce) GetCLContent(changeList int) (properties T_CLProperties, err error) {
 	p.logThis(fmt.Sprintf("GetCLContent(%d)", changeList))
 
-	var out []byte
-
-	if len(p.user) > 0 {
-		// fmt.Printf(p4Cmd + " -u " + user + " describe " + "-s " + strconv.Itoa(changeList) + "\n")
-		out, err = exec.Command(p.p4Cmd, "-u", p.user, "describe", "-s", strconv.Itoa(changeList)).CombinedOutput()
-		//fmt.Printf("P4 command line result - err=%s\n out=%s\n", err, out)
-	} else {
-		//fmt.Printf(p.p4Cmd  + " describe " + "-s " + strconv.Itoa(changeList) + "\n")
-		out, err = exec.Command(p.p4Cmd, "describe", "-s", strconv.Itoa(changeList)).CombinedOutput()
-		// out, err := exec.Command(p.p4Cmd, "info").Output()
-	}
+	out, err := p.execP4(nil, "describe", "-s", strconv.Itoa(changeList))
 	if err != nil {
-		return properties, fmt.Errorf("P4 command line error %v  out=%s", err, out)
+		return properties, p.errorf("P4 command line error %v  out=%s", err, out)
 	}
 
 	// Parse response
@@ -289,7 +411,7 @@ func (p *Perforce) GetCLContent(changeList int) (properties T_CLProperties, err
 
 	matches := pattern.FindSubmatch(out)
 	if len(matches) < 6 { // Not enough fields identified and parsed
-		return properties, fmt.Errorf("Error parsing - nb field read: %d received from p4: %s", len(matches), out)
+		return properties, p.errorf("Error parsing - nb field read: %d received from p4: %s", len(matches), out)
 	}
 
 	// Record CL global properties
@@ -301,6 +423,7 @@ func (p *Perforce) GetCLContent(changeList int) (properties T_CLProperties, err
 	properties.User = strings.Trim(string(matches[2]), " \r\n\t")
 	properties.Workspace = strings.Trim(string(matches[3]), " \r\n\t")
 	properties.DateStamp = strings.Trim(string(matches[4]), " \r\n\t")
+	properties.Time = p.dateOf(properties.DateStamp)
 	if strings.Trim(string(matches[5]), " \r\n\t") == "*pending*" {
 		properties.Pending = true
 	}
@@ -321,7 +444,7 @@ func (p *Perforce) GetCLContent(changeList int) (properties T_CLProperties, err
 	out = out[idxs[2]:] // Keep list of files only - trash everything before
 
 	// Get all the files
-	pattern, err = regexp.Compile(`(?m)^\.\.\. (//.*)#([0-9]*) ([a-z]*)[\r\n]*`)
+	pattern, err = regexp.Compile(`(?m)^\.\.\. (//.*)#([0-9]*) ([a-z/]*)[\r\n]*`)
 	if err != nil {
 		return properties, fmt.Errorf("regex compile error: %v", err)
 	}
@@ -332,7 +455,7 @@ func (p *Perforce) GetCLContent(changeList int) (properties T_CLProperties, err
 	// Check result validity
 	if len(list) > 0 {
 		if len(list[0]) < 4 {
-			return properties, fmt.Errorf("Parsing workspace error - reading files in CL incorrect: %s", out)
+			return properties, p.errorf("Parsing workspace error - reading files in CL incorrect: %s", out)
 		}
 		// Get results in map
 		properties.List = make(map[string]T_CLFileProperties)
@@ -341,7 +464,7 @@ func (p *Perforce) GetCLContent(changeList int) (properties T_CLProperties, err
 			if err != nil {
 				return properties, fmt.Errorf("Error parsing - Format error conv to number: %v", err)
 			}
-			filename := strings.Trim(string(v[1]), " \t\r\n")
+			filename := UnescapePath(strings.Trim(string(v[1]), " \t\r\n"))
 			action := strings.Trim(string(v[3]), " \t\r\n")
 			properties.List[filename] = T_CLFileProperties{Rev: rev, Action: action}
 		}
@@ -349,7 +472,7 @@ func (p *Perforce) GetCLContent(changeList int) (properties T_CLProperties, err
 
 	// Check that we received the correct CL - returns the properties even if wrong
 	if changeList != properties.CLNb {
-		return properties, fmt.Errorf("Perforce error - Wrong change list data received: %d, %v", properties.CLNb, properties)
+		return properties, p.errorf("Perforce error - Wrong change list data received: %d, %v", properties.CLNb, properties)
 	}
 
 	return properties, nil
@@ -393,6 +516,7 @@ func (p *Perforce) GetPendingCLContent(changeList int) (m_files map[string]int,
 //	Get the properties from a file in the depot from: p4 -c wwww -u xxxxx p4 filelog -m 1
 //  User and workspace don't seem to be necessary but leaving them anyway
 //	We get a truncated version of the comments (no -l or -L). They are ' delimited so safer to parse that way.
+//	The first call of the instance also runs p4 info for the server timezone (see ServerLocation()).
 // 	Input:
 //		- path to file in depot
 //  Return:
@@ -405,6 +529,7 @@ type T_FileProperties struct {
 	CL          int
 	Action      string
 	EditDate    string
+	EditTime    time.Time // EditDate in the server timezone
 	Owner       string
 	Workspace   string
 	Type        string
@@ -414,19 +539,23 @@ type T_FileProperties struct {
 func (p *Perforce) GetFileInDepotProperties(FileInDepot string) (properties T_FileProperties, err error) {
 	p.logThis(fmt.Sprintf("GetFileInDepotProperties(%s)", FileInDepot))
 
-	var out []byte
+	return p.GetFileInDepotPropertiesAt(NewFileSpec(FileInDepot, RevSpec{}))
+}
 
-	if len(p.user) > 0 {
-		// fmt.Printf(p4Cmd + " -u " + user + "-c" + p.workspace + " filelog -m 1 ",FileInDepot,"\n")
-		out, err = exec.Command(p.p4Cmd, "-u", p.user, "-c", p.workspace, "filelog", "-m 1", FileInDepot).CombinedOutput()
-		//fmt.Printf("P4 command line result - err=%s\n out=%s\n", err, out)
-	} else {
-		// fmt.Printf(p4Cmd + "-c" + workspace + " filelog -m 1 ",FileInDepot,"\n")
-		out, err = exec.Command(p.p4Cmd, "-c", p.workspace, "filelog", "-m 1", FileInDepot).CombinedOutput()
-		// out, err := exec.Command(p.p4Cmd, "info").Output()
+// GetFileInDepotPropertiesAt()
+//	Same as GetFileInDepotProperties() for a revision of the file: properties of the
+//	last revision up to the specifier.
+//	The first call of the instance also runs p4 info for the server timezone (see ServerLocation()).
+func (p *Perforce) GetFileInDepotPropertiesAt(file FileSpec) (properties T_FileProperties, err error) {
+	p.logThis(fmt.Sprintf("GetFileInDepotPropertiesAt(%s)", file))
+
+	arg, err := p.fileSpecArg(file)
+	if err != nil {
+		return properties, err
 	}
+	out, err := p.execP4(nil, "filelog", "-m 1", arg)
 	if err != nil {
-		return properties, fmt.Errorf("P4 command line error %v  out=%s", err, out)
+		return properties, p.errorf("P4 command line error %v  out=%s", err, out)
 	}
 
 	// Get the individual parameters
@@ -437,11 +566,11 @@ func (p *Perforce) GetFileInDepotProperties(FileInDepot string) (properties T_Fi
 
 	matches := pattern.FindSubmatch(out)
 	if len(matches) < 10 { // Not enough fields identified and parsed
-		return properties, fmt.Errorf("Error parsing - nb field read: %d received from p4: %s", len(matches), out)
+		return properties, p.errorf("Error parsing - nb field read: %d received from p4: %s", len(matches), out)
 	}
 
-	properties.Path = strings.Trim(string(matches[1]), " \r\n\t")
-	if properties.Path != FileInDepot {
+	properties.Path = UnescapePath(strings.Trim(string(matches[1]), " \r\n\t"))
+	if properties.Path != file.Path {
 		return properties, fmt.Errorf("Error parsing - wrong file properties returned by p4: %s", properties.Path)
 	}
 	properties.LastVersion, err = strconv.Atoi(string(matches[2]))
@@ -454,6 +583,7 @@ func (p *Perforce) GetFileInDepotProperties(FileInDepot string) (properties T_Fi
 	}
 	properties.Action = strings.Trim(string(matches[4]), " \r\n\t")
 	properties.EditDate = strings.Trim(string(matches[5]), " \r\n\t")
+	properties.EditTime = p.dateOf(properties.EditDate)
 	properties.Owner = strings.Trim(string(matches[6]), " \r\n\t")
 	properties.Workspace = strings.Trim(string(matches[7]), " \r\n\t")
 	properties.Type = strings.Trim(string(matches[8]), " \r\n\t")
@@ -464,6 +594,7 @@ func (p *Perforce) GetFileInDepotProperties(FileInDepot string) (properties T_Fi
 
 // GetWorkspaceProperties()
 //	Get workspace properties from: p4 -c wwww -u xxxxx p4 client -o
+//	The first call of the instance also runs p4 info for the server case handling of ViewMap.
 // 	Input:
 //		- workspace - optional if not present uses current workspace
 //  Return:
@@ -480,82 +611,58 @@ type T_WSProperties struct {
 	Options       []string
 	SubmitOptions []string
 	LineEnd       string
-	View          map[string]string
+	Stream        string            // Stream of a stream workspace, see SwitchStream()
+	View          map[string]string // Depot/workspace pairs - exclusion and overlay lines are not listed
+	ViewMap       *ViewMap          // Complete view to translate paths locally
 }
 
 func (p *Perforce) GetWorkspaceProperties(workspace string) (properties T_WSProperties, err error) {
 	p.logThis(fmt.Sprintf("GetWorkspaceProperties(%s)", workspace))
 
-	var out []byte
-
 	if len(workspace) <= 0 {
 		workspace = p.workspace
 	}
 
-	if len(p.user) > 0 {
-		// fmt.Printf(p4Cmd + " -u " + user + "-c" + workspace + " client -o\n")
-		out, err = exec.Command(p.p4Cmd, "-u", p.user, "-c", workspace, "client", "-o").CombinedOutput()
-		//fmt.Printf("P4 command line result - err=%s\n out=%s\n", err, out)
-	} else {
-		// fmt.Printf(p4Cmd + "-c" + workspace + " client -o\n")
-		out, err = exec.Command(p.p4Cmd, "-c", workspace, "client", "-o").CombinedOutput()
-		// out, err := exec.Command(p.p4Cmd, "info").Output()
-	}
-	if err != nil {
-		return properties, fmt.Errorf("P4 command line error %v  out=%s", err, out)
-	}
-
-	// Get the individual parameters
-	pattern, err := regexp.Compile(`(?m).*^Client:(.*)[\n\r]*^Update:(.*)[\n\r]*^Access:(.*)[\n\r]*^Owner:(.*)[\n\r]*^Description:[\n\r]{1,2}(.*)[\n\r]*^Root:(.*)[\n\r]*^Options:(.*)[\n\r]*^SubmitOptions:(.*)[\n\r]*^LineEnd:(.*)[\n\r]*^View:[\n\r]*\t(//.*) "?(//.*)"?`)
+	spec, err := p.GetSpec("client", workspace)
 	if err != nil {
-		return properties, fmt.Errorf("regex compile error: %v", err)
+		return properties, err
 	}
-
-	matches := pattern.FindSubmatch(out)
-	if len(matches) < 10 { // Not enough fields identified and parsed
-		return properties, fmt.Errorf("Error parsing - nb field read: %d received from p4: %s", len(matches), out)
+	if !spec.Has("Client") || !spec.Has("View") {
+		return properties, p.errorf("Error parsing - not a workspace spec received from p4: %s", spec)
 	}
 
-	properties.Name = strings.Trim(string(matches[1]), " \t\r\n")
-	properties.Update = strings.Trim(string(matches[2]), " \t\r\n")
-	properties.Access = strings.Trim(string(matches[3]), " \t\r\n")
-	properties.Owner = strings.Trim(string(matches[4]), " \t\r\n")
-	properties.Description = strings.Trim(string(matches[5]), " \t\r\n")
-	properties.Root = strings.Trim(string(matches[6]), " \t\r\n")
-	properties.Options = strings.Split(strings.Trim(string(matches[7]), " \t\r\n"), " ")
-	properties.SubmitOptions = strings.Split(strings.Trim(string(matches[8]), " \t\r\n"), " ")
+	properties.Name = spec.Get("Client")
+	properties.Update = spec.Get("Update")
+	properties.Access = spec.Get("Access")
+	properties.Owner = spec.Get("Owner")
+	properties.Description = spec.Get("Description")
+	properties.Root = spec.Get("Root")
+	properties.Options = strings.Fields(spec.Get("Options"))
+	properties.SubmitOptions = strings.Fields(spec.Get("SubmitOptions"))
+	properties.LineEnd = spec.Get("LineEnd")
+	properties.Stream = spec.Get("Stream")
 
-	// Get the list of files depot/workspace
-	// First find the index of the begining of the list dans le Buffer
-	pattern, err = regexp.Compile(`(?m).*^(View:[\n\r]*)\t//.* "?//.*"?`)
+	properties.ViewMap, err = ParseViewMap(spec.GetLines("View"))
 	if err != nil {
-		return properties, fmt.Errorf("regex compile error: %v", err)
+		return properties, err
 	}
-	idxs := pattern.FindSubmatchIndex(out)
-	if len(idxs) < 3 {
-		return properties, fmt.Errorf("Parsing workspace error - can't find list of depot/ws files")
+	properties.ViewMap.Client = properties.Name
+	properties.ViewMap.Root = properties.Root
+	if info, err := p.serverInfo(); err == nil {
+		properties.ViewMap.CaseInsensitive = info.CaseInsensitive
+	} else {
+		p.logThis(fmt.Sprintf("	Warning - case handling of the server unknown: %v", err))
 	}
-	// fmt.Printf("match=%s\n", out[idxs[2]:idxs[3]])
-
-	out = out[idxs[3]:] // Keep list of of depot/ws files only - trash everything before
 
 	// Get all the pairs depot/ws files
-	pattern, err = regexp.Compile(`(?m).*^\t(//.*) "?(//[^"\n\n]*)`)
-	if err != nil {
-		return properties, fmt.Errorf("regex compile error: %v", err)
-	}
-	list := pattern.FindAllSubmatch(out, -1)
-
-	// Check result validity
-	if len(list) > 0 {
-		if len(list[0]) < 3 {
-			return properties, fmt.Errorf("Parsing workspace error - reading pair depot/workspace file incorrect: %s", out)
+	for _, m := range properties.ViewMap.Mappings {
+		if m.Type != MapInclude {
+			continue
 		}
-		// Get results in a map
-		properties.View = make(map[string]string)
-		for _, v := range list {
-			properties.View[strings.Trim(string(v[1]), " \t\r\n")] = strings.Trim(string(v[2]), " \t\r\n")
+		if properties.View == nil {
+			properties.View = make(map[string]string)
 		}
+		properties.View[m.Left] = m.Right
 	}
 
 	return properties, nil
@@ -563,263 +670,109 @@ func (p *Perforce) GetWorkspaceProperties(workspace string) (properties T_WSProp
 
 // Changelist specification definiton:
 type T_CLSpecProperties struct {
-	ChangeList  int    // The change list number. (-1) on a new changelist.
-	Date        string // The date this specification was last modified.
-	Client      string // The client (workspace) on which the changelist was created.  Read-only.
-	User        string // The user who created the changelist.
-	Status      string // Either 'pending' or 'submitted'. Read-only. Or 'new'!!
-	Type        string // Either 'public' or 'restricted'. Default is 'public'.
-	Description string // Comments about the changelist.  Required.
+	ChangeList  int       // The change list number. (-1) on a new changelist.
+	Date        string    // The date this specification was last modified.
+	Time        time.Time // Date in the server timezone. Read-only.
+	Client      string    // The client (workspace) on which the changelist was created.  Read-only.
+	User        string    // The user who created the changelist.
+	Status      string    // Either 'pending' or 'submitted'. Read-only. Or 'new'!!
+	Type        string    // Either 'public' or 'restricted'. Default is 'public'.
+	Description string    // Comments about the changelist.  Required. Lines are separated by "\n".
 	// can't test: ImportedBy		string			// The user who fetched or pushed this change to this server.
 	// can't test: Identity			string			// Identifier for this change.
-	// can't test: Jobs					[]string		// What opened jobs are to be closed by this changelist.
-	// You may delete jobs from this list.  (New changelists only.)
 	// can't test: Stream				[]string  	// What opened stream is to be added to this changelist.
 	// You may remove an opened stream from this list.
+	Jobs  []string          // Jobs fixed by this changelist, their status is set when it's submitted (i.e. closed).
 	Files map[string]string // File/action. What opened files from the default changelist are to be added
 	// to this changelist.  You may delete files from this list.
 	// (New changelists only.)
-	Eol 				string // Detect what kind of end of line we receive from the server.
-	Form 				string // Form as it was received
+	Eol  string // Detect what kind of end of line we receive from the server.
+	Form string // Form as it was received
 }
 
-
 // GetCLSpecProperties()
 //	Get a CL specification properties from a p4 change -o command.
 //	Probably the main use of this function: if cl == 0
 //	then moves default changelist into a numbered changelist.
+//	The first call of the instance also runs p4 info for the server timezone (see ServerLocation()).
 //
 func (p *Perforce) GetCLSpecProperties(cl int) (properties T_CLSpecProperties, err error) {
 	p.logThis(fmt.Sprintf("GetCLSpecProperties(%d)", cl))
 
-	var out []byte
-
 	var sCL string
 	if cl > 0 {
 		sCL = strconv.Itoa(cl)
 	}
 
-	if len(p.user) > 0 {
-		out, err = exec.Command(p.p4Cmd, "-u", p.user, "-c", p.workspace, "change", "-o", sCL).CombinedOutput()
-	} else {
-		out, err = exec.Command(p.p4Cmd, "-c", p.workspace, "change", "-o", sCL).CombinedOutput()
-	}
-
-	p.logThis(fmt.Sprintf("P4 response: %s",out))
-
+	spec, err := p.GetSpec("change", sCL)
 	if err != nil {
-		return properties, fmt.Errorf("P4 command line error %v  out=%s", err, out)
+		return properties, err
 	}
 
-	// Parsing result
-
-	// Detect what kind of end of line we receive from the perforce server
-	if strings.Count(string(out),"\n") >= strings.Count(string(out),"\r\n") {
-		properties.Eol = "\n"
-	} else {
-		properties.Eol = "\r\n"
-	}
+	properties.Eol = spec.Eol
 
 	// Get Change list number - check 1st if it's a 'new' changelist
-	pattern, err := regexp.Compile(`(?m)[\n\r]*^Change:\t(new|[0-9]*)[\n\r]*`)
-	if err != nil {
-		return properties, fmt.Errorf("Regex (changelist#) compile error: %v", err)
-	}
-
-	matches := pattern.FindSubmatch(out)
-	if len(matches) > 0 {
-		if string(matches[1]) != "new" {
-			properties.ChangeList, err = strconv.Atoi(string(matches[1]))
-			if err != nil {
-				return properties, fmt.Errorf("Parsing changelist# error %v  out=%s", err, out)
-			}
-		} else {
-			properties.ChangeList = -1  // 'new' changelist
-		}
-	}
-
-	// Get Date
-	pattern, err = regexp.Compile(`(?m)[\n\r]*^Date:\t([0-9/ :]*)[\n\r]*`)
-	if err != nil {
-		return properties, fmt.Errorf("Regex (date) compile error: %v", err)
-	}
-	matches = pattern.FindSubmatch(out)
-	if len(matches) > 0 {
-		properties.Date = string(matches[1])
-	}
-	// Get Client (workspace)
-	pattern, err = regexp.Compile(`(?m)[\n\r]*^Client:\t(.*)[\n\r]*`)
-	if err != nil {
-		return properties, fmt.Errorf("Regex (workspace) compile error: %v", err)
-	}
-	matches = pattern.FindSubmatch(out)
-	if len(matches) > 0 {
-		properties.Client = string(matches[1])
-	}
-
-	// Get User
-	pattern, err = regexp.Compile(`(?m)[\n\r]*^User:\t(.*)[\n\r]*`)
-	if err != nil {
-		return properties, fmt.Errorf("Regex (user) compile error: %v", err)
-	}
-	matches = pattern.FindSubmatch(out)
-	if len(matches) > 0 {
-		properties.User = string(matches[1])
-	}
-
-	// Get Status
-	pattern, err = regexp.Compile(`(?m)[\n\r]*^Status:\t(new|pending|submitted)[\n\r]*`)
-	if err != nil {
-		return properties, fmt.Errorf("Regex (status) compile error: %v", err)
-	}
-	matches = pattern.FindSubmatch(out)
-	if len(matches) > 0 {
-		properties.Status = string(matches[1])
-	}
-
-	// Get Type
-	pattern, err = regexp.Compile(`(?m)[\n\r]*^Type:\t(public|restricted)[\n\r]*`)
-	if err != nil {
-		return properties, fmt.Errorf("Regex (type) compile error: %v", err)
-	}
-	matches = pattern.FindSubmatch(out)
-	if len(matches) > 0 {
-		properties.Type = string(matches[1])
-	}
-
-	// Get Description
-	pattern, err = regexp.Compile(`(?m)[\n\r]*^Description:[\n\r]*((^\t.*[\n\r]*)*[\n\r]*)^[\n\r]*`)
-	if err != nil {
-		return properties, fmt.Errorf("Regex (description) compile error: %v", err)
-	}
-
-	matches = pattern.FindSubmatch(out)
-	if len(matches) > 0 {
-		str := strings.TrimPrefix(string(matches[1]), "\t") // Remove the leading tabs
-		str  = strings.ReplaceAll(str, "\r\n\t", "\r\n")		// windows
-		str  = strings.ReplaceAll(str, "\n\t", "\n")				// linux
-		properties.Description = str
-	}
-
-	// Get Files
-	pattern, err = regexp.Compile(`(?m)[\n\r]*^Files:[\n\r]*^(\t//.*)\t# .*[\n\r]*`)
-	if err != nil {
-		return properties, fmt.Errorf("Regex (files) compile error: %v", err)
-	}
-
-	idx := pattern.FindIndex(out)  // find Files of 1st occurrence if any
-	if idx != nil {
-
-		pattern, err = regexp.Compile(`(?m)^\t(//.*)\t# (.*)[\n\r]*`)
+	if change := spec.Get("Change"); change == "new" {
+		properties.ChangeList = -1 // 'new' changelist
+	} else if len(change) > 0 {
+		properties.ChangeList, err = strconv.Atoi(change)
 		if err != nil {
-			return properties, fmt.Errorf("Regex (files) compile error: %v", err)
-		}
-
-		list := pattern.FindAllSubmatch(out[idx[0]:], -1) // Get the other Files if any
-		if len(list) > 0 {
-			if len(list[0]) <= 0 {
-				return properties, fmt.Errorf("Parsing workspace error - reading file details: %s", out)
-			}
-			properties.Files = make(map[string]string)
-			for _, v := range list {
-				properties.Files[string(v[1])] = string(v[2])
-			}
+			return properties, p.errorf("Parsing changelist# error %v  out=%s", err, spec)
 		}
 	}
 
-	properties.Form = string(out)
+	properties.Date = spec.Get("Date")
+	properties.Time = p.dateOf(properties.Date)
+	properties.Client = spec.Get("Client")
+	properties.User = spec.Get("User")
+	properties.Status = spec.Get("Status")
+	properties.Type = spec.Get("Type")
+	properties.Description = spec.Get("Description")
+	properties.Jobs = specJobs(spec)
+	properties.Files = specFiles(spec)
+
+	properties.Form = spec.String()
 
 	return properties, nil
 }
 
-
 // PutCLSpecProperties()
 //	Write a CL specification properties using a p4 change -i command.
 //	Get properties from a T_CLSpecProperties var
+//	If properties.Form is set (i.e. returned by GetCLSpecProperties()) it's used
+//	as a base and only the modified fields are rewritten.
 //	Returns a changelist number
 //
 func (p *Perforce) PutCLSpecProperties(properties T_CLSpecProperties) (CL int, err error) {
 	p.logThis(fmt.Sprintf("PutCLSpecProperties()"))
 
-  var cmd *exec.Cmd
-	if len(p.user) > 0 {
-		cmd = exec.Command(p.p4Cmd, "-u", p.user, "-c", p.workspace, "change", "-i")
-		// out, err = exec.Command(p.p4Cmd, "-u", p.user, "-c", p.workspace, "change", "-o", sCL).CombinedOutput()
-	} else {
-		cmd = exec.Command(p.p4Cmd, "-u", "-c", p.workspace, "change", "-i")
-	}
+	spec, err := clSpec(properties)
 	if err != nil {
-		return 0, fmt.Errorf("P4 command line error %v  cmd=%s", err, cmd)
+		return 0, err
 	}
 
-	stdin, err := cmd.StdinPipe()
+	out, err := p.PutSpec("change", spec)
 	if err != nil {
-		return 0, fmt.Errorf("P4 command line error (pipe) %v", err)
-	}
-
-	// Build and write the CL specification to stdin
-	go func() {
-		defer stdin.Close()
-		eol := properties.Eol
-		if properties.ChangeList == -1 {
-			io.WriteString(stdin, eol + "Change:\t" + "new" + eol)
-		} else {
-			io.WriteString(stdin, eol + "Change:\t" + strconv.Itoa(properties.ChangeList) + "new" + eol)
-		}
-		if len(properties.Date) > 0 {
-			io.WriteString(stdin, "Date:\t" + properties.Date + eol)
-		}
-		if len(properties.Client) > 0 {
-			io.WriteString(stdin, "Client:\t" + properties.Client + eol)
-		}
-		if len(properties.User) > 0 {
-			io.WriteString(stdin, "User:\t" + properties.User + eol)
-		}
-		if len(properties.Status) > 0 {
-			io.WriteString(stdin, "Status:\t" + properties.Status + eol)
-		}
-		if len(properties.Type) > 0 {
-			io.WriteString(stdin, "Type:\t" + properties.Type + eol)
-		}
-		descr := "\t" + properties.Description  // Prefix each line with a tab
-		descr = strings.ReplaceAll(descr, "\n", "\n\t")
-		descr = strings.TrimSuffix(descr, "\t")
-		io.WriteString(stdin, "Description:" + eol)
-		io.WriteString(stdin, descr + eol)
-		if len(properties.Files) > 0 {
-			io.WriteString(stdin, "Files:" + eol)
-			for k, v := range properties.Files {
-				io.WriteString(stdin, "\t" + k + " #" + v + eol)
-			}
-		}
-	}()
-
-	// Read response string
-	out, err := cmd.CombinedOutput()
-
-	p.logThis(fmt.Sprintf("P4 response: %s",out))
-
-	if err != nil {
-		return 0, fmt.Errorf("P4 command line error (CombinedOutput) %v - out=%s", err, out)
+		return 0, err
 	}
 
 	// Parse response
 	// 			"Change 1234567 created with 23 open file(s)."
 	//  or	"Change 1234567 created" if empty change list
-	// pattern, err := regexp.Compile(`^Change ([0-9]*) created with ([0-9]*) open file\(s\)`)
-	pattern, err := regexp.Compile(`^Change ([0-9]*) created`)
+	//  or	"Change 1234567 updated." if existing change list
+	pattern, err := regexp.Compile(`^Change ([0-9]*) (created|updated)`)
 	if err != nil {
 		return 0, fmt.Errorf("Regex compile error: %v", err)
 	}
 
-	matches := pattern.FindSubmatch(out)
+	matches := pattern.FindStringSubmatch(out)
 	if len(matches) < 2 {
-		return 0, fmt.Errorf("Error unexpected response. Received %s", out)
+		return 0, p.errorf("Error unexpected response. Received %s", out)
 	}
 
-	cl, err := strconv.Atoi(string(matches[1]))
+	cl, err := strconv.Atoi(matches[1])
 	if err != nil {
-		return 0, fmt.Errorf("Error changelist format: %v, received %s", err, out)
+		return 0, p.errorf("Error changelist format: %v, received %s", err, out)
 	}
 	p.logThis(fmt.Sprintf("Changelist#: %d", cl))
 
@@ -829,105 +782,267 @@ func (p *Perforce) PutCLSpecProperties(properties T_CLSpecProperties) (CL int, e
 		return 0, fmt.Errorf("Regex compile error: %v", err)
 	}
 
-	nbfiles := 0
-	matches = pattern.FindSubmatch(out)
-	if len(matches) >= 2 {
-		nbfiles, err =  strconv.Atoi(string(matches[1]))
+	if matches = pattern.FindStringSubmatch(out); len(matches) >= 2 {
+		nbfiles, err := strconv.Atoi(matches[1])
 		if err != nil { // just a warning since a apparenlty valid cl has been received
 			p.logThis(fmt.Sprintf("Warning - nb files format incorrect: %v, received %s", err, out))
 		}
+		if nbfiles != len(properties.Files) { // sanity check
+			p.logThis(fmt.Sprintf("Warning - nb files in response doesn't match changelist: %d vs %d", nbfiles, len(properties.Files)))
+		}
 	}
 
-	if nbfiles != len(properties.Files) { // sanity check
-		p.logThis(fmt.Sprintf("Warning - nb files in response doesn't match changelist: %d vs %d", nbfiles, len(properties.Files)))
+	return cl, nil
+}
+
+// Build a change spec from CL properties.
+// Start from the form received if any so that the fields not managed here are kept.
+func clSpec(properties T_CLSpecProperties) (spec *Spec, err error) {
+	if len(properties.Form) > 0 {
+		spec, err = ParseSpec(properties.Form)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		spec = NewSpec()
+	}
+	if len(properties.Eol) > 0 {
+		spec.Eol = properties.Eol
 	}
 
-	return cl, nil
+	if properties.ChangeList > 0 {
+		spec.Set("Change", strconv.Itoa(properties.ChangeList))
+	} else {
+		spec.Set("Change", "new")
+	}
+	if len(properties.Date) > 0 {
+		spec.Set("Date", properties.Date)
+	}
+	if len(properties.Client) > 0 {
+		spec.Set("Client", properties.Client)
+	}
+	if len(properties.User) > 0 {
+		spec.Set("User", properties.User)
+	}
+	if len(properties.Status) > 0 {
+		spec.Set("Status", properties.Status)
+	}
+	if len(properties.Type) > 0 {
+		spec.Set("Type", properties.Type)
+	}
+	descr := strings.TrimRight(strings.ReplaceAll(properties.Description, "\r\n", "\n"), "\n")
+	spec.SetLines("Description", strings.Split(descr, "\n"))
+
+	// Rewrite the list of jobs only if it changed - the status comments are kept
+	if !equalLines(specJobs(spec), properties.Jobs) {
+		if len(properties.Jobs) > 0 {
+			spec.SetLines("Jobs", properties.Jobs)
+		} else {
+			spec.Delete("Jobs")
+		}
+	}
+
+	// Rewrite the list of files only if it changed - map order is random
+	if !equalFiles(specFiles(spec), properties.Files) {
+		if len(properties.Files) > 0 {
+			var files []string
+			for k, v := range properties.Files {
+				files = append(files, EscapePath(k)+"\t# "+v)
+			}
+			sort.Strings(files)
+			spec.SetLines("Files", files)
+		} else {
+			spec.Delete("Files")
+		}
+	}
+
+	return spec, nil
 }
 
+// Files/actions of a change spec:
+//	//depot/a/file.txt	# edit
+func specFiles(spec *Spec) (files map[string]string) {
+	for _, line := range spec.GetLines("Files") {
+		file, action := line, ""
+		if i := strings.Index(line, "#"); i >= 0 {
+			file, action = line[:i], line[i+1:]
+		}
+		file = strings.Trim(file, " \t")
+		if len(file) <= 0 {
+			continue
+		}
+		if files == nil {
+			files = make(map[string]string)
+		}
+		files[UnescapePath(file)] = strings.Trim(action, " \t")
+	}
+	return files
+}
+
+func equalFiles(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
 
 // SubmitCL()
 //	Submit a changelist.
 //	In:
 //		- changelist number - 0 means default changelist
-//		- description (optional and valid only when changelist ==0)
+//		- description (needed and valid only when changelist ==0)
 //		If changelist == 0 submit the default changelist
 //  	If description not nil and changelist == 0 do a submit -d
 //  	If cl != 0 and description not nil, ignore description
 //	Returns a new changelist number or an error.
 //		- if cl==0 and no error means that the CL was empty.
-//
+//		- the default changelist isn't submitted without a description: error,
+//		  p4 isn't run.
+//	See Submit() for the other options and the files submitted.
 func (p *Perforce) SubmitCL(changelist int, description string) (newChangelist int, err error) {
-	p.logThis(fmt.Sprintf("SubmitCL(%d, %s)",changelist, description))
+	p.logThis(fmt.Sprintf("SubmitCL(%d, %s)", changelist, p.redactDescription(description)))
 
-	var opt string
-	if changelist > 0 {
-		opt = "-c" + strconv.Itoa(changelist)
-	} else {
-		opt = "-d " + description
-	}
-	// fmt.Printf("Opt=%s\n",opt)
-	// Submit CL
-	var out []byte
-	if len(p.user) > 0 {
-		if len(opt) > 0 {
-			out, err = exec.Command(p.p4Cmd, "-u", p.user, "-c", p.workspace, "submit", opt).CombinedOutput()
-		} else {
-			out, err = exec.Command(p.p4Cmd, "-u", p.user, "-c", p.workspace, "submit").CombinedOutput()
-		}
-	} else {
-		if len(opt) > 0 {
-			out, err = exec.Command(p.p4Cmd, "-c", p.workspace, "submit", opt).CombinedOutput()
-		} else {
-			out, err = exec.Command(p.p4Cmd, "-c", p.workspace, "submit").CombinedOutput()
-		}
+	opts := SubmitOptions{Changelist: changelist}
+	if changelist <= 0 {
+		opts.Description = description
 	}
+	res, err := p.Submit(opts)
+	return res.Change, err
+}
 
-	p.logThis(fmt.Sprintf("P4 response: %s",out))
+// UpdateCL()
+//	Update the description of an existing changelist.
+//	Submitted changelists are updated with p4 change -f which requires admin
+//	permission, otherwise the server error is returned.
+//	In:
+//		- changelist number
+//		- new description
+//
+func (p *Perforce) UpdateCL(changelist int, description string) (err error) {
+	p.logThis(fmt.Sprintf("UpdateCL(%d, %s)", changelist, p.redactDescription(description)))
+
+	if changelist <= 0 {
+		return fmt.Errorf("UpdateCL() - Invalid changelist: %d", changelist)
+	}
 
+	properties, err := p.GetCLSpecProperties(changelist)
 	if err != nil {
-		if strings.HasPrefix(string(out), "No files to submit from the default changelist.") ||
-			 strings.HasSuffix(strings.TrimRight(string(out),"\r\n\t "), "No files to submit.") {  //Submitting change 7654321\n No files to submit.
-			return 0, nil		// OK the CL was empty
-		} else {
-			return 0, fmt.Errorf("P4 command line error %v  out=%s", err, out)
-		}
+		return err
 	}
+	if properties.ChangeList != changelist {
+		return fmt.Errorf("Perforce error - Wrong change list data received: %d", properties.ChangeList)
+	}
+	properties.Description = description
 
-	// Parse response
-	// 2 responses possible depending whether submitting default or a pending cl:
-	// "Change 5008806 submitted." or "Change 4990122 renamed change 4990128 and submitted."
-	// Anything else raise an error.
+	spec, err := clSpec(properties)
+	if err != nil {
+		return err
+	}
 
-	// trying to parse a default cl submit response:
-	pattern, err := regexp.Compile(`(?m)^Change ([0-9]*) submitted.`)
+	var flags []string
+	if properties.Status == "submitted" {
+		flags = append(flags, "-f")
+	}
+	out, err := p.PutSpec("change", spec, flags...)
 	if err != nil {
-		return 0, fmt.Errorf("Regex compile error: %v", err)
+		return err
 	}
 
-	matches := pattern.FindSubmatch(out)
-	if len(matches) >= 2 {
-		cl, err := strconv.Atoi(string(matches[1]))
-		if err != nil {
-			return 0, fmt.Errorf("Error changelist format: %v, received %s", err, out)
-		}
-		return cl, nil     // OK
+	// "Change 1234567 updated."
+	if !strings.HasPrefix(out, "Change "+strconv.Itoa(changelist)+" updated") {
+		return p.errorf("Error unexpected response. Received %s", out)
 	}
+	return nil
+}
+
+// DeleteCL()
+//	Delete an empty pending changelist: p4 change -d <changelist>
+//	Files and shelved files need to be reverted, moved or deleted beforehand.
+//
+func (p *Perforce) DeleteCL(changelist int) (err error) {
+	p.logThis(fmt.Sprintf("DeleteCL(%d)", changelist))
+
+	if changelist <= 0 {
+		return fmt.Errorf("DeleteCL() - Invalid changelist: %d", changelist)
+	}
+
+	out, err := p.execP4(nil, "change", "-d", strconv.Itoa(changelist))
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
 
-	// it's not a default cl response so trying to parse the other type
-	pattern, err = regexp.Compile(`(?m)^Change ([0-9]*) renamed change ([0-9]*) and submitted.`)
 	if err != nil {
-		return 0, fmt.Errorf("Regex compile error: %v", err)
+		return p.errorf("P4 command line error %v  out=%s", err, out)
 	}
 
-	matches = pattern.FindSubmatch(out)
-	if len(matches) < 3 {
-		return 0, fmt.Errorf("Error parsing submit response: %v, received %s", err, out)
+	// "Change 1234567 deleted."
+	// or "Change 1234567 has 2 open file(s) associated with it and can't be deleted."
+	if !strings.HasPrefix(string(out), "Change "+strconv.Itoa(changelist)+" deleted") {
+		return p.errorf("Error unexpected response. Received %s", out)
 	}
+	return nil
+}
+
+// Reopen()
+//	Move opened files to another changelist and/or change their filetype: p4 reopen
+//	In:
+//		- changelist number, 0 means default changelist and -1 leaves the files where they are
+//		- filetype i.e. "binary+l", "+x". Empty leaves the filetype unchanged.
+//		- files (depot or workspace syntax, patterns allowed) - p4 syntax: @ # % * in names
+//		  escaped (%40 %23 %25 %2A), see the path conventions in filespec.go
+//	Returns the list of depot files reopened or an error if none were.
+//
+/*
+p4 reopen -c 1234567 -t binary+l //depot/a/file.bin
+//depot/a/file.bin#3 - reopened; change 1234567; type binary+l
+*/
+func (p *Perforce) Reopen(changelist int, fileType string, files ...string) (reopened []string, err error) {
+	p.logThis(fmt.Sprintf("Reopen(%d, %s, %v)", changelist, fileType, files))
 
-	cl, err := strconv.Atoi(string(matches[2]))
+	if len(files) <= 0 {
+		return reopened, fmt.Errorf("Reopen() - No file specified")
+	}
+
+	args := []string{"reopen"}
+	if changelist > 0 {
+		args = append(args, "-c", strconv.Itoa(changelist))
+	} else if changelist == 0 {
+		args = append(args, "-c", "default")
+	}
+	if len(fileType) > 0 {
+		args = append(args, "-t", fileType)
+	}
+	if changelist < 0 && len(fileType) <= 0 {
+		return reopened, fmt.Errorf("Reopen() - Nothing to do: no changelist or filetype specified")
+	}
+	fileArgs := make([]string, len(files))
+	for i, f := range files {
+		if fileArgs[i], err = p.fileArg(f); err != nil {
+			return reopened, err
+		}
+	}
+	out, err := p.execP4Files(args, fileArgs)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if err != nil {
+		return reopened, p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	pattern, err := regexp.Compile(`(?m)^(//.*)#([0-9]+|none) - reopened`)
 	if err != nil {
-		return 0, fmt.Errorf("Error changelist format: %v, received %s", err, out)
+		return reopened, fmt.Errorf("Regex compile error: %v", err)
+	}
+	for _, v := range pattern.FindAllSubmatch(out, -1) {
+		reopened = append(reopened, UnescapePath(string(v[1])))
 	}
-	return cl, nil		// OK
+	if len(reopened) <= 0 {
+		return reopened, p.errorf("No file reopened. Received %s", out)
+	}
+
+	return reopened, nil
 }
@@ -0,0 +1,224 @@
+package perforce_test
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	perforce "github.com/fabdem/go-perforce"
+	"github.com/fabdem/go-perforce/perforcetest"
+)
+
+// Server with a workspace ws, files //depot/a.txt and //depot/b@1.txt
+func newChangeServer(t *testing.T) (srv *perforcetest.Server, p *perforce.Perforce) {
+	srv = perforcetest.NewServer()
+	if err := srv.AddClient("ws", t.TempDir(), "//depot/... //ws/..."); err != nil {
+		t.Fatal(err)
+	}
+	srv.AddFile("//depot/a.txt", "text", "a\n")
+	srv.AddFile("//depot/b@1.txt", "text", "b\n")
+	if err := srv.Sync("ws"); err != nil {
+		t.Fatal(err)
+	}
+	return srv, srv.Perforce("bob", "ws")
+}
+
+// Last command line received by the server, without the global options
+func lastCommand(srv *perforcetest.Server) string {
+	commands := srv.Commands()
+	if len(commands) <= 0 {
+		return ""
+	}
+	c := commands[len(commands)-1]
+	for len(c) > 0 && strings.HasPrefix(c[0], "-") {
+		if c[0] == "-u" || c[0] == "-c" || c[0] == "-x" {
+			c = c[1:]
+		}
+		c = c[1:]
+	}
+	return strings.Join(c, " ")
+}
+
+func TestUpdateCL(t *testing.T) {
+	srv, p := newChangeServer(t)
+	cl := srv.CreateChange("bob", "ws", "first")
+	if err := p.UpdateCL(cl, "second\nline"); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := lastCommand(srv); cmd != "change -i" {
+		t.Errorf("pending: %s", cmd)
+	}
+	if c, err := p.GetCLSpecProperties(cl); err != nil || c.Description != "second\nline" {
+		t.Errorf("%+v %v", c, err)
+	}
+
+	// Submitted changelist: forced
+	srv.Open("ws", "edit", "//depot/a.txt", cl)
+	submitted, err := p.SubmitCL(cl, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.UpdateCL(submitted, "fixed"); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := lastCommand(srv); cmd != "change -i -f" {
+		t.Errorf("submitted: %s", cmd)
+	}
+
+	n := len(srv.Commands())
+	if err = p.UpdateCL(0, "x"); err == nil || len(srv.Commands()) != n {
+		t.Errorf("default changelist: %v", err)
+	}
+	if err = p.UpdateCL(99, "x"); err == nil {
+		t.Errorf("unknown changelist: no error")
+	}
+}
+
+func TestDeleteCL(t *testing.T) {
+	srv, p := newChangeServer(t)
+	empty := srv.CreateChange("bob", "ws", "empty")
+	full := srv.CreateChange("bob", "ws", "full")
+	srv.Open("ws", "edit", "//depot/a.txt", full)
+
+	if err := p.DeleteCL(empty); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := lastCommand(srv); cmd != "change -d "+strconv.Itoa(empty) {
+		t.Errorf("%s", cmd)
+	}
+	if err := p.DeleteCL(full); err == nil || !strings.Contains(err.Error(), "can't be deleted") {
+		t.Errorf("changelist with files: %v", err)
+	}
+	if err := p.DeleteCL(0); err == nil {
+		t.Errorf("default changelist: no error")
+	}
+}
+
+func TestReopen(t *testing.T) {
+	srv, p := newChangeServer(t)
+	cl := srv.CreateChange("bob", "ws", "reopen")
+	srv.Open("ws", "edit", "//depot/a.txt", 0)
+	srv.Open("ws", "edit", "//depot/b@1.txt", 0)
+
+	// Files in p4 syntax
+	reopened, err := p.Reopen(cl, "", "//depot/a.txt", "//depot/b%401.txt")
+	if err != nil || strings.Join(reopened, " ") != "//depot/a.txt //depot/b@1.txt" {
+		t.Fatalf("%v %v", reopened, err)
+	}
+	if cmd := lastCommand(srv); cmd != "reopen -c "+strconv.Itoa(cl)+" //depot/a.txt //depot/b%401.txt" {
+		t.Errorf("%s", cmd)
+	}
+	opened, _ := p.Opened(perforce.OpenedFilter{Changelist: cl})
+	if len(opened) != 2 {
+		t.Errorf("%+v", opened)
+	}
+
+	// Filetype only, then back to the default changelist
+	if reopened, err = p.Reopen(-1, "text+x", "//depot/a.txt"); err != nil || len(reopened) != 1 {
+		t.Fatalf("%v %v", reopened, err)
+	}
+	if cmd := lastCommand(srv); cmd != "reopen -t text+x //depot/a.txt" {
+		t.Errorf("%s", cmd)
+	}
+	if _, err = p.Reopen(0, "", "//depot/..."); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := lastCommand(srv); cmd != "reopen -c default //depot/..." {
+		t.Errorf("%s", cmd)
+	}
+	opened, _ = p.Opened(perforce.OpenedFilter{}, perforce.NewFileSpec("//depot/a.txt", perforce.RevSpec{}))
+	if len(opened) != 1 || opened[0].Change != 0 || opened[0].FileType != "text+x" {
+		t.Errorf("%+v", opened)
+	}
+
+	if _, err = p.Reopen(-1, "", "//depot/a.txt"); err == nil {
+		t.Errorf("nothing to do: no error")
+	}
+	if _, err = p.Reopen(cl, "", "//depot/none.txt"); err == nil {
+		t.Errorf("file not opened: no error")
+	}
+}
+
+// Single file helpers take paths not escaped, GetP4Files() takes p4 arguments
+func TestFilePathConventions(t *testing.T) {
+	srv, p := newChangeServer(t)
+	srv.AddFile("//depot/icon@2x.png", "binary", "1")
+	srv.AddFile("//depot/icon@2x.png", "binary", "2")
+
+	if rev, err := p.GetHeadRev("//depot/icon@2x.png"); err != nil || rev != 2 {
+		t.Errorf("GetHeadRev(): %d %v", rev, err)
+	}
+	if cmd := lastCommand(srv); cmd != "files -e //depot/icon%402x.png" {
+		t.Errorf("%s", cmd)
+	}
+	if exists, err := p.CheckFileExitsInDepot("//depot/icon@2x.png"); err != nil || !exists {
+		t.Errorf("CheckFileExitsInDepot(): %t %v", exists, err)
+	}
+	if exists, err := p.CheckFileExitsInDepot("//depot/icon@3x.png"); err != nil || exists {
+		t.Errorf("CheckFileExitsInDepot() no such file: %t %v", exists, err)
+	}
+	if tempFile, _, err := p.GetFile("//depot/icon@2x.png", 1); err != nil {
+		t.Errorf("GetFile(): %v", err)
+	} else {
+		os.Remove(tempFile)
+	}
+
+	files, err := p.GetP4Files("//depot/icon%402x.png#1")
+	if err != nil || len(files) != 1 || files[0].HeadRevision != 1 || files[0].DepotfileLoc != "//depot/icon@2x.png" {
+		t.Errorf("GetP4Files(): %+v %v", files, err)
+	}
+	if cmd := lastCommand(srv); cmd != "files -e //depot/icon%402x.png#1" {
+		t.Errorf("%s", cmd)
+	}
+	files, err = p.GetP4FilesAt(perforce.NewFileSpec("//depot/icon@2x.png", perforce.RevNum(1)))
+	if err != nil || len(files) != 1 || files[0].HeadRevision != 1 {
+		t.Errorf("GetP4FilesAt(): %+v %v", files, err)
+	}
+}
+
+// Runner counting the command lines sent to the server
+type countingRunner struct {
+	perforce.Runner
+	calls int
+}
+
+func (r *countingRunner) Run(args []string, stdin io.Reader) (stdout []byte, stderr []byte, exitCode int, err error) {
+	r.calls++
+	return r.Runner.Run(args, stdin)
+}
+
+// The getters with dates run p4 info on the first call of the instance only
+func TestGettersServerInfo(t *testing.T) {
+	srv, _ := newChangeServer(t)
+	cl := srv.CreateChange("bob", "ws", "pending")
+
+	getters := map[string]func(p *perforce.Perforce) error{
+		"GetCLContent": func(p *perforce.Perforce) error {
+			_, err := p.GetCLContent(1)
+			return err
+		},
+		"GetFileInDepotPropertiesAt": func(p *perforce.Perforce) error {
+			_, err := p.GetFileInDepotPropertiesAt(perforce.NewFileSpec("//depot/a.txt", perforce.RevSpec{}))
+			return err
+		},
+		"GetCLSpecProperties": func(p *perforce.Perforce) error {
+			_, err := p.GetCLSpecProperties(cl)
+			return err
+		},
+	}
+	for name, get := range getters {
+		runner := &countingRunner{Runner: srv}
+		p := perforce.NewWithRunner("bob", "ws", runner)
+		for i, want := range []int{2, 1} {
+			runner.calls = 0
+			if err := get(p); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if runner.calls != want {
+				t.Errorf("%s call %d: %d commands, want %d", name, i+1, runner.calls, want)
+			}
+		}
+	}
+}
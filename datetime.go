@@ -0,0 +1,192 @@
+package perforce
+
+// Dates and times reported by the server.
+//
+// p4 reports dates in the server local time without timezone: "2020/09/20 21:02:41"
+// or "2020/09/20". They're converted to time.Time in the timezone of the server,
+// obtained from p4 info once per instance (and the instances derived with With...()).
+// Dates sent to the server (i.e. AtDate() revisions) are converted to its timezone.
+//
+// p4 info reports the UTC offset and the name of the timezone, not its rules:
+// "2020/09/20 21:02:41 -0700 PDT". Common names are mapped to their IANA zone
+// (PDT: America/Los_Angeles) so that the dates on the other side of a daylight
+// saving time change are right. For other names the offset is fixed: such dates
+// are one hour off.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerLocal - location of the dates parsed from p4 syntax without the server timezone
+// (i.e. by ParseRevSpec()). Their wall clock is the server's and they're sent unchanged.
+var ServerLocal = time.FixedZone("server local time", 0)
+
+// Formats of the dates in p4 output
+var p4DateLayouts = []string{"2006/01/02 15:04:05", "2006/01/02:15:04:05", "2006/01/02"}
+
+// Data about the server shared by an instance and its derived instances - nothing
+// specific to a user or a workspace
+type serverCache struct {
+	mu      sync.Mutex
+	info    *ServerInfo
+	jobSpec *T_JobSpec
+}
+
+// Guards the creation of the cache of the instances not made by New() or NewWithRunner()
+var serverCacheInit sync.Mutex
+
+// Cache of the instance, created on first use if the instance has none
+func (p *Perforce) serverData() *serverCache {
+	serverCacheInit.Lock()
+	defer serverCacheInit.Unlock()
+	if p.cache == nil {
+		p.cache = &serverCache{}
+	}
+	return p.cache
+}
+
+// ServerLocation()
+//	Timezone of the server, from the server date returned by p4 info.
+//	The result is cached: p4 info is run once (see GetServerInfo()).
+func (p *Perforce) ServerLocation() (loc *time.Location, err error) {
+	info, err := p.serverInfo()
+	if err != nil {
+		return nil, err
+	}
+	return info.Location, nil
+}
+
+// Timezone of a server date: "2020/09/20 21:02:41 -0700 PDT"
+func parseServerDateLocation(serverDate string) (loc *time.Location, err error) {
+	fields := strings.Fields(serverDate)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("Error parsing server date: %s", serverDate)
+	}
+	t, err := time.Parse("2006/01/02 15:04:05 -0700", strings.Join(fields[:3], " "))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing server date: %s", serverDate)
+	}
+	name := strings.Join(fields[3:], " ") // "PDT" or "Pacific Daylight Time" on windows
+	_, offset := t.Zone()
+
+	// Zone with the daylight saving time rules if it has the offset of the server date
+	for _, zone := range serverZones[name] {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			continue
+		}
+		if _, o := t.In(loc).Zone(); o == offset {
+			return loc, nil
+		}
+	}
+	return time.FixedZone(name, offset), nil
+}
+
+// IANA zones of the timezone names with daylight saving time reported by servers,
+// in order of preference (i.e. CST is US central time or China standard time)
+var serverZones = map[string][]string{
+	"PST": {"America/Los_Angeles"}, "PDT": {"America/Los_Angeles"},
+	"MST": {"America/Denver", "America/Phoenix"}, "MDT": {"America/Denver"},
+	"CST": {"America/Chicago", "Asia/Shanghai"}, "CDT": {"America/Chicago"},
+	"EST": {"America/New_York"}, "EDT": {"America/New_York"},
+	"BST": {"Europe/London"},
+	"WET": {"Europe/Lisbon"}, "WEST": {"Europe/Lisbon"},
+	"CET": {"Europe/Paris"}, "CEST": {"Europe/Paris"},
+	"EET": {"Europe/Helsinki"}, "EEST": {"Europe/Helsinki"},
+	"AEST": {"Australia/Sydney", "Australia/Brisbane"}, "AEDT": {"Australia/Sydney"},
+	"NZST": {"Pacific/Auckland"}, "NZDT": {"Pacific/Auckland"},
+	// Windows names
+	"Pacific Standard Time": {"America/Los_Angeles"}, "Pacific Daylight Time": {"America/Los_Angeles"},
+	"Mountain Standard Time": {"America/Denver"}, "Mountain Daylight Time": {"America/Denver"},
+	"Central Standard Time": {"America/Chicago"}, "Central Daylight Time": {"America/Chicago"},
+	"Eastern Standard Time": {"America/New_York"}, "Eastern Daylight Time": {"America/New_York"},
+	"GMT Standard Time": {"Europe/London"}, "GMT Daylight Time": {"Europe/London"},
+	"W. Europe Standard Time": {"Europe/Berlin"}, "W. Europe Daylight Time": {"Europe/Berlin"},
+	"Romance Standard Time": {"Europe/Paris"}, "Romance Daylight Time": {"Europe/Paris"},
+	"Central Europe Standard Time": {"Europe/Budapest"}, "Central Europe Daylight Time": {"Europe/Budapest"},
+	"FLE Standard Time": {"Europe/Helsinki"}, "FLE Daylight Time": {"Europe/Helsinki"},
+	"AUS Eastern Standard Time": {"Australia/Sydney"}, "AUS Eastern Daylight Time": {"Australia/Sydney"},
+}
+
+// ParseDate()
+//	Convert a date reported by p4 ("2020/09/20 21:02:41", "2020/09/20:21:02:41" or
+//	"2020/09/20") into a time.Time in the server timezone.
+func (p *Perforce) ParseDate(raw string) (t time.Time, err error) {
+	raw = strings.TrimSpace(raw)
+	loc, err := p.ServerLocation()
+	if err != nil {
+		return t, err
+	}
+	for _, layout := range p4DateLayouts {
+		if t, err = time.ParseInLocation(layout, raw, loc); err == nil {
+			return t, nil
+		}
+	}
+	return t, fmt.Errorf("Error parsing date: %q", raw)
+}
+
+// FormatDate()
+//	Date in p4 syntax (2020/09/20:21:02:41) in the server timezone.
+//	Dates in ServerLocal are formatted as is.
+func (p *Perforce) FormatDate(t time.Time) (date string, err error) {
+	if t.Location() != ServerLocal {
+		loc, err := p.ServerLocation()
+		if err != nil {
+			return date, err
+		}
+		t = t.In(loc)
+	}
+	return t.Format(revDateFormat), nil
+}
+
+// Date of the output - zero time if it can't be parsed.
+// Tagged output of some commands (i.e. streams) reports dates in seconds since epoch.
+func (p *Perforce) dateOf(raw string) time.Time {
+	raw = strings.TrimSpace(raw)
+	if len(raw) <= 0 {
+		return time.Time{}
+	}
+	if isDigits(raw) {
+		sec, _ := strconv.ParseInt(raw, 10, 64)
+		t := time.Unix(sec, 0)
+		if loc, err := p.ServerLocation(); err == nil {
+			t = t.In(loc)
+		}
+		return t
+	}
+	t, err := p.ParseDate(raw)
+	if err != nil {
+		p.logThis(fmt.Sprintf("	Warning - %v", err))
+	}
+	return t
+}
+
+// File argument in p4 syntax (escaped path, optional revision) as sent to the server
+func (p *Perforce) fileArg(arg string) (string, error) {
+	file, err := ParseFileSpec(arg)
+	if err != nil {
+		return arg, err
+	}
+	return p.fileSpecArg(file)
+}
+
+// File specifier as sent to the server: dates converted to the server timezone
+func (p *Perforce) fileSpecArg(file FileSpec) (arg string, err error) {
+	if err = file.Validate(); err != nil {
+		return arg, err
+	}
+	for _, rev := range []*RevSpec{&file.From, &file.Rev} {
+		if rev.Kind == RevDate && rev.Date.Location() != ServerLocal {
+			loc, err := p.ServerLocation()
+			if err != nil {
+				return arg, err
+			}
+			rev.Date = rev.Date.In(loc)
+		}
+	}
+	return file.String(), nil
+}
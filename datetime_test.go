@@ -0,0 +1,38 @@
+package perforce
+
+import (
+	"io"
+	"testing"
+)
+
+// Runner answering p4 info only, counting the calls
+type infoRunner struct {
+	calls int
+}
+
+func (r *infoRunner) Run(args []string, stdin io.Reader) (stdout []byte, stderr []byte, exitCode int, err error) {
+	r.calls++
+	return []byte("... serverDate 2020/09/20 21:02:41 -0700 PDT\n... serverVersion P4D/LINUX26X86_64/2020.1/1234567 (2020/06/01)\n"), nil, 0, nil
+}
+
+// Instance not made by New() or NewWithRunner(): the server data is cached all the same
+func TestServerCacheCreatedOnFirstUse(t *testing.T) {
+	runner := &infoRunner{}
+	p := &Perforce{runner: runner}
+	for i := 0; i < 3; i++ {
+		if _, err := p.ParseDate("2020/09/20 21:02:41"); err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := p.Supports(FeatureStreams); err != nil || !ok {
+			t.Fatalf("%t %v", ok, err)
+		}
+	}
+	if runner.calls != 1 {
+		t.Errorf("p4 info run %d times", runner.calls)
+	}
+
+	// Shared with the instances derived afterwards
+	if _, err := p.WithUser("alice").ServerLocation(); err != nil || runner.calls != 1 {
+		t.Errorf("derived instance: p4 info run %d times %v", runner.calls, err)
+	}
+}
@@ -0,0 +1,133 @@
+package perforce
+
+// Text encodings of the files: utf8 or utf16 (little or big endian).
+//
+// p4 handles the content of text files as bytes: utf16 content stored in a text
+// file is split in lines on the '\n' bytes, which leaves the other byte of the
+// '\n' code unit at the start (LE) or the end (BE) of the next/current line.
+// Used by the diffs (line count of utf16 cr/lf files) and Annotate().
+
+import (
+	"bytes"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encodings detected
+const (
+	EncodingUTF8    = "utf8"
+	EncodingUTF16LE = "utf16le"
+	EncodingUTF16BE = "utf16be"
+)
+
+var (
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+
+	// cr/lf line endings
+	utf16LESep = []byte{'\r', 0x00, '\n', 0x00}
+	utf16BESep = []byte{0x00, '\r', 0x00, '\n'}
+)
+
+// DetectEncoding()
+//	Encoding of text content: utf16 if it starts with a utf16 BOM or if most of
+//	the bytes of an even or odd rank are nul, utf8 otherwise.
+func DetectEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return EncodingUTF16LE
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return EncodingUTF16BE
+	}
+
+	even, odd := 0, 0
+	for i, c := range data {
+		if c != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			even++
+		} else {
+			odd++
+		}
+	}
+	half := len(data) / 2
+	switch {
+	case half > 0 && odd > half*3/4 && even <= half/4:
+		return EncodingUTF16LE
+	case half > 0 && even > half*3/4 && odd <= half/4:
+		return EncodingUTF16BE
+	}
+	return EncodingUTF8
+}
+
+// Whether utf16 content has cr/lf line endings
+func isUTF16CRLF(data []byte) bool {
+	return bytes.Contains(data, utf16LESep) || bytes.Contains(data, utf16BESep)
+}
+
+// DecodeText()
+//	Convert text content to utf8: utf16 content is decoded, BOMs are removed.
+func DecodeText(data []byte) (text string, encoding string) {
+	encoding = DetectEncoding(data)
+	if encoding == EncodingUTF8 {
+		return string(bytes.TrimPrefix(data, bomUTF8)), encoding
+	}
+	return decodeUTF16(data, encoding == EncodingUTF16BE), encoding
+}
+
+// Decode utf16 content, an odd trailing byte is ignored
+func decodeUTF16(data []byte, bigEndian bool) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		if bigEndian {
+			units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+		} else {
+			units = append(units, uint16(data[i+1])<<8|uint16(data[i]))
+		}
+	}
+	if len(units) > 0 && units[0] == 0xfeff {
+		units = units[1:]
+	}
+	return string(utf16.Decode(units))
+}
+
+// decodeLines()
+//	Convert to utf8 the lines of a text as split by p4 on the '\n' bytes.
+//	End of lines are removed.
+func decodeLines(lines [][]byte) (text []string, encoding string) {
+	encoding = DetectEncoding(bytes.Join(lines, []byte{'\n'}))
+	text = make([]string, len(lines))
+	if encoding == EncodingUTF8 {
+		for i, l := range lines {
+			if i == 0 {
+				l = bytes.TrimPrefix(l, bomUTF8)
+			}
+			text[i] = string(bytes.TrimRight(l, "\r"))
+			if !utf8.ValidString(text[i]) {
+				text[i] = string(bytes.ToValidUTF8(bytes.TrimRight(l, "\r"), []byte("�")))
+			}
+		}
+		return text, encoding
+	}
+
+	// Realign the lines on the code units: offset of each line in the whole text
+	bigEndian := encoding == EncodingUTF16BE
+	offset := 0
+	for i, l := range lines {
+		start, end := 0, len(l)
+		if offset%2 != 0 && start < end {
+			start++ // other byte of the '\n' of the previous line (LE)
+		}
+		if (offset+end)%2 != 0 && end > start {
+			end-- // other byte of the '\n' ending this line (BE)
+		}
+		text[i] = decodeUTF16(l[start:end], bigEndian)
+		for len(text[i]) > 0 && (text[i][len(text[i])-1] == '\r' || text[i][len(text[i])-1] == 0) {
+			text[i] = text[i][:len(text[i])-1]
+		}
+		offset += len(l) + 1
+	}
+	return text, encoding
+}
@@ -0,0 +1,331 @@
+package perforce
+
+// File and revision specifiers.
+//
+// A FileSpec is a path with an optional revision or range of revisions:
+//	//depot/a.txt#3			FileSpec{Path: "//depot/a.txt", Rev: RevNum(3)}
+//	//depot/a.txt@label		FileSpec{Path: "//depot/a.txt", Rev: AtLabel("label")}
+//	//depot/...#3,#5		FileSpec{Path: "//depot/...", Pattern: true, From: RevNum(3), Rev: RevNum(5)}
+//
+// The path is stored unescaped: @ # % * are escaped (%40 %23 %25 %2A) by String()
+// and unescaped by ParseFileSpec(). The wildcards * and ... of a pattern are kept.
+//
+// Path conventions of the package: file paths passed and returned as strings are not
+// escaped, as in the file system (i.e. //depot/icon@2x.png). The exceptions are:
+//	- GetP4Files() (deprecated) and Reopen() which take p4 command line arguments: escaped
+//	  paths or patterns with an optional revision (i.e. //depot/icon%402x.png#3, //depot/...@123).
+//	  GetP4FilesAt() takes FileSpecs instead.
+//	- views and paths of specs (workspace, label, branch, stream), kept as in the spec.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RevKind - kind of revision specifier
+type RevKind int
+
+const (
+	RevUnspecified RevKind = iota // no revision: head for most commands
+	RevHead                       // #head
+	RevHave                       // #have - revision synced in the workspace
+	RevNone                       // #none - nonexistent revision
+	RevNumber                     // #n
+	RevChange                     // @n - revision at changelist n
+	RevLabel                      // @label
+	RevClient                     // @client - revisions synced in a workspace
+	RevDate                       // @yyyy/mm/dd:hh:mm:ss - server local time
+	RevShelf                      // @=n - shelved in changelist n
+)
+
+// RevSpec - revision specifier
+type RevSpec struct {
+	Kind   RevKind
+	Number int       // RevNumber, RevChange, RevShelf
+	Name   string    // RevLabel, RevClient
+	Date   time.Time // RevDate - converted to the server timezone when sent, unless in ServerLocal
+}
+
+// FileSpec - path with an optional revision or range of revisions
+type FileSpec struct {
+	Path    string  // depot, client or local path - not escaped
+	Pattern bool    // path contains wildcards (* ...) which aren't escaped - a literal * is written %2A
+	From    RevSpec // start of a range, RevUnspecified if not a range
+	Rev     RevSpec // revision or end of a range
+}
+
+const revDateFormat = "2006/01/02:15:04:05"
+
+// Revision specifiers
+func HeadRev() RevSpec               { return RevSpec{Kind: RevHead} }
+func HaveRev() RevSpec               { return RevSpec{Kind: RevHave} }
+func NoneRev() RevSpec               { return RevSpec{Kind: RevNone} }
+func RevNum(rev int) RevSpec         { return RevSpec{Kind: RevNumber, Number: rev} }
+func AtChange(cl int) RevSpec        { return RevSpec{Kind: RevChange, Number: cl} }
+func AtLabel(label string) RevSpec   { return RevSpec{Kind: RevLabel, Name: label} }
+func AtClient(client string) RevSpec { return RevSpec{Kind: RevClient, Name: client} }
+func AtDate(date time.Time) RevSpec  { return RevSpec{Kind: RevDate, Date: date} }
+func AtShelf(cl int) RevSpec         { return RevSpec{Kind: RevShelf, Number: cl} }
+
+// ParseRevSpec()
+//	Parse a revision specifier: #head, #have, #none, #n, @n, @=n, @yyyy/mm/dd[:hh:mm:ss] or @name.
+//	@name is parsed as a label: p4 looks for a label then a workspace of that name.
+//	Dates are server local times: they're parsed in ServerLocal.
+func ParseRevSpec(s string) (rev RevSpec, err error) {
+	if len(s) < 2 || (s[0] != '#' && s[0] != '@') {
+		return rev, fmt.Errorf("Invalid revision specifier: %q", s)
+	}
+	value := s[1:]
+
+	if s[0] == '#' {
+		switch value {
+		case "head":
+			return HeadRev(), nil
+		case "have":
+			return HaveRev(), nil
+		case "none":
+			return NoneRev(), nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return rev, fmt.Errorf("Invalid revision specifier: %q", s)
+		}
+		return RevNum(n), nil
+	}
+
+	switch {
+	case strings.HasPrefix(value, "="):
+		n, err := strconv.Atoi(value[1:])
+		if err != nil || n <= 0 {
+			return rev, fmt.Errorf("Invalid shelf specifier: %q", s)
+		}
+		return AtShelf(n), nil
+	case isDigits(value):
+		n, _ := strconv.Atoi(value)
+		return AtChange(n), nil
+	case strings.Count(value, "/") == 2:
+		for _, layout := range []string{revDateFormat, "2006/01/02 15:04:05", "2006/01/02"} {
+			if t, err := time.ParseInLocation(layout, value, ServerLocal); err == nil {
+				return AtDate(t), nil
+			}
+		}
+		return rev, fmt.Errorf("Invalid date specifier: %q", s)
+	}
+	rev = AtLabel(value)
+	return rev, rev.Validate()
+}
+
+// String()
+//	Revision specifier as expected by p4, "" if unspecified.
+func (r RevSpec) String() string {
+	switch r.Kind {
+	case RevHead:
+		return "#head"
+	case RevHave:
+		return "#have"
+	case RevNone:
+		return "#none"
+	case RevNumber:
+		return "#" + strconv.Itoa(r.Number)
+	case RevChange:
+		return "@" + strconv.Itoa(r.Number)
+	case RevLabel, RevClient:
+		return "@" + r.Name
+	case RevDate:
+		if r.Date.Hour() == 0 && r.Date.Minute() == 0 && r.Date.Second() == 0 {
+			return "@" + r.Date.Format("2006/01/02")
+		}
+		return "@" + r.Date.Format(revDateFormat)
+	case RevShelf:
+		return "@=" + strconv.Itoa(r.Number)
+	}
+	return ""
+}
+
+// Validate()
+func (r RevSpec) Validate() error {
+	switch r.Kind {
+	case RevUnspecified, RevHead, RevHave, RevNone:
+		return nil
+	case RevNumber:
+		if r.Number < 0 {
+			return fmt.Errorf("Invalid revision number: %d", r.Number)
+		}
+	case RevChange, RevShelf:
+		if r.Number <= 0 {
+			return fmt.Errorf("Invalid changelist number: %d", r.Number)
+		}
+	case RevLabel, RevClient:
+		if len(r.Name) <= 0 || isDigits(r.Name) || strings.ContainsAny(r.Name, "@#%*, \t\r\n") || strings.Contains(r.Name, "...") {
+			return fmt.Errorf("Invalid label or workspace name: %q", r.Name)
+		}
+	case RevDate:
+		if r.Date.IsZero() {
+			return fmt.Errorf("Invalid date: not set")
+		}
+	default:
+		return fmt.Errorf("Invalid revision kind: %d", r.Kind)
+	}
+	return nil
+}
+
+// NewFileSpec()
+//	File specifier for a path (not escaped) and a revision.
+func NewFileSpec(path string, rev RevSpec) FileSpec {
+	return FileSpec{Path: path, Rev: rev}
+}
+
+// ParseFileSpec()
+//	Parse a file specifier in p4 syntax: escaped path followed by an optional
+//	revision or range (i.e. //depot/a%40b.txt#3 or //depot/...@5,@8).
+//	Paths with * or ... are patterns.
+func ParseFileSpec(s string) (file FileSpec, err error) {
+	i := strings.IndexAny(s, "#@")
+	path, revs := s, ""
+	if i >= 0 {
+		path, revs = s[:i], s[i:]
+	}
+	if len(path) <= 0 {
+		return file, fmt.Errorf("Invalid file specifier - no path: %q", s)
+	}
+	file.Pattern = strings.Contains(path, "*") || strings.Contains(path, "...")
+	file.Path = UnescapePath(path)
+	if file.Pattern {
+		file.Path = unescapeChars(path, "@#%")
+	}
+
+	if len(revs) > 0 {
+		parts := strings.Split(revs, ",")
+		if len(parts) > 2 {
+			return file, fmt.Errorf("Invalid revision range: %q", s)
+		}
+		if len(parts) == 2 {
+			if len(parts[1]) > 0 && parts[1][0] != '#' && parts[1][0] != '@' {
+				parts[1] = revs[:1] + parts[1] // #3,5 is #3,#5
+			}
+			if file.From, err = ParseRevSpec(parts[0]); err != nil {
+				return file, err
+			}
+		}
+		if file.Rev, err = ParseRevSpec(parts[len(parts)-1]); err != nil {
+			return file, err
+		}
+	}
+	return file, file.Validate()
+}
+
+// String()
+//	File specifier in p4 syntax: escaped path and revision.
+func (f FileSpec) String() string {
+	path := EscapePath(f.Path)
+	if f.Pattern {
+		path = escapePattern(f.Path)
+	}
+	if f.From.Kind != RevUnspecified {
+		return path + f.From.String() + "," + f.Rev.String()
+	}
+	return path + f.Rev.String()
+}
+
+// Validate()
+func (f FileSpec) Validate() error {
+	if len(f.Path) <= 0 {
+		return fmt.Errorf("Invalid file specifier - no path")
+	}
+	if strings.ContainsAny(f.Path, "\r\n") {
+		return fmt.Errorf("Invalid file specifier - path with a new line: %q", f.Path)
+	}
+	if f.From.Kind != RevUnspecified && f.Rev.Kind == RevUnspecified {
+		return fmt.Errorf("Invalid revision range - no end: %s", f.Path)
+	}
+	if err := f.From.Validate(); err != nil {
+		return err
+	}
+	return f.Rev.Validate()
+}
+
+// EscapePath()
+//	Escape the characters p4 reserves in file names: @ # % * as %40 %23 %25 %2A.
+func EscapePath(path string) string {
+	return escapeChars(path, "%@#*")
+}
+
+// UnescapePath()
+//	Reverse of EscapePath(): path as stored in the file system.
+func UnescapePath(path string) string {
+	return unescapeChars(path, "@#%*")
+}
+
+var escapeCodes = map[rune]string{'@': "%40", '#': "%23", '%': "%25", '*': "%2A"}
+
+func escapeChars(path string, chars string) string {
+	if !strings.ContainsAny(path, chars) {
+		return path
+	}
+	var b strings.Builder
+	for _, c := range path {
+		if strings.ContainsRune(chars, c) {
+			b.WriteString(escapeCodes[c])
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// Escape a pattern: the wildcards and the literal * (%2A) are kept as is
+func escapePattern(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '%' && i+2 < len(path) && strings.EqualFold(path[i:i+3], "%2A"):
+			b.WriteString(path[i : i+3])
+			i += 2
+		case path[i] == '%' || path[i] == '@' || path[i] == '#':
+			b.WriteString(escapeCodes[rune(path[i])])
+		default:
+			b.WriteByte(path[i])
+		}
+	}
+	return b.String()
+}
+
+func unescapeChars(path string, chars string) string {
+	if !strings.Contains(path, "%") {
+		return path
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '%' && i+2 < len(path) {
+			code := strings.ToUpper(path[i : i+3])
+			found := false
+			for _, c := range chars {
+				if escapeCodes[c] == code {
+					b.WriteRune(c)
+					i += 2
+					found = true
+					break
+				}
+			}
+			if found {
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+func isDigits(s string) bool {
+	if len(s) <= 0 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package perforce_test
+
+import (
+	"testing"
+	"time"
+
+	perforce "github.com/fabdem/go-perforce"
+)
+
+func TestParseRevSpec(t *testing.T) {
+	tests := []struct {
+		in   string
+		want perforce.RevSpec
+		out  string // String(), in if empty
+	}{
+		{"#head", perforce.HeadRev(), ""},
+		{"#have", perforce.HaveRev(), ""},
+		{"#none", perforce.NoneRev(), ""},
+		{"#0", perforce.RevNum(0), ""},
+		{"#12", perforce.RevNum(12), ""},
+		{"@42", perforce.AtChange(42), ""},
+		{"@=42", perforce.AtShelf(42), ""},
+		{"@rel-1.0", perforce.AtLabel("rel-1.0"), ""},
+		{"@2024/03/10", perforce.AtDate(time.Date(2024, 3, 10, 0, 0, 0, 0, perforce.ServerLocal)), ""},
+		{"@2024/03/10:02:30:00", perforce.AtDate(time.Date(2024, 3, 10, 2, 30, 0, 0, perforce.ServerLocal)), ""},
+		{"@2024/03/10 02:30:00", perforce.AtDate(time.Date(2024, 3, 10, 2, 30, 0, 0, perforce.ServerLocal)), "@2024/03/10:02:30:00"},
+	}
+	for _, tt := range tests {
+		got, err := perforce.ParseRevSpec(tt.in)
+		if err != nil || got.Kind != tt.want.Kind || got.Number != tt.want.Number || got.Name != tt.want.Name || !got.Date.Equal(tt.want.Date) {
+			t.Errorf("%s: %+v %v, want %+v", tt.in, got, err, tt.want)
+			continue
+		}
+		out := tt.out
+		if out == "" {
+			out = tt.in
+		}
+		if got.String() != out {
+			t.Errorf("%s: String() %s, want %s", tt.in, got.String(), out)
+		}
+	}
+
+	for _, in := range []string{"", "#", "3", "#-1", "#x", "@=0", "@=x", "@2024/13/40", "@my label", "@a,b", "@x..."} {
+		if rev, err := perforce.ParseRevSpec(in); err == nil {
+			t.Errorf("%q: no error, %+v", in, rev)
+		}
+	}
+}
+
+func TestParseFileSpec(t *testing.T) {
+	date := func(d int) perforce.RevSpec { return perforce.AtDate(time.Date(2024, 1, d, 0, 0, 0, 0, perforce.ServerLocal)) }
+	tests := []struct {
+		in   string
+		want perforce.FileSpec
+		out  string // String(), in if empty
+	}{
+		{"//depot/a.txt", perforce.FileSpec{Path: "//depot/a.txt"}, ""},
+		{"//depot/a.txt#3", perforce.FileSpec{Path: "//depot/a.txt", Rev: perforce.RevNum(3)}, ""},
+		{"//depot/icon%402x.png@5", perforce.FileSpec{Path: "//depot/icon@2x.png", Rev: perforce.AtChange(5)}, ""},
+		{"//depot/100%25%23%2A.txt#head", perforce.FileSpec{Path: "//depot/100%#*.txt", Rev: perforce.HeadRev()}, ""},
+		{"//depot/a%2a.txt", perforce.FileSpec{Path: "//depot/a*.txt"}, "//depot/a%2A.txt"},
+		{"//depot/...@=7", perforce.FileSpec{Path: "//depot/...", Pattern: true, Rev: perforce.AtShelf(7)}, ""},
+		// Patterns: the wildcards are kept, a literal * stays escaped
+		{"//depot/*.c", perforce.FileSpec{Path: "//depot/*.c", Pattern: true}, ""},
+		{"//depot/%40x/...%2A.c", perforce.FileSpec{Path: "//depot/@x/...%2A.c", Pattern: true}, ""},
+		// Ranges
+		{"//depot/...#3,#5", perforce.FileSpec{Path: "//depot/...", Pattern: true, From: perforce.RevNum(3), Rev: perforce.RevNum(5)}, ""},
+		{"//depot/...#3,5", perforce.FileSpec{Path: "//depot/...", Pattern: true, From: perforce.RevNum(3), Rev: perforce.RevNum(5)}, "//depot/...#3,#5"},
+		{"//depot/...@5,8", perforce.FileSpec{Path: "//depot/...", Pattern: true, From: perforce.AtChange(5), Rev: perforce.AtChange(8)}, "//depot/...@5,@8"},
+		{"//depot/...@rel-1,@rel-2", perforce.FileSpec{Path: "//depot/...", Pattern: true, From: perforce.AtLabel("rel-1"), Rev: perforce.AtLabel("rel-2")}, ""},
+		{"//depot/a.txt@rel-1,@now", perforce.FileSpec{Path: "//depot/a.txt", From: perforce.AtLabel("rel-1"), Rev: perforce.AtLabel("now")}, ""},
+		{"//depot/...@2024/01/01,@2024/01/31", perforce.FileSpec{Path: "//depot/...", Pattern: true, From: date(1), Rev: date(31)}, ""},
+		{"//depot/a.txt@2024/01/01,@12", perforce.FileSpec{Path: "//depot/a.txt", From: date(1), Rev: perforce.AtChange(12)}, ""},
+	}
+	for _, tt := range tests {
+		got, err := perforce.ParseFileSpec(tt.in)
+		if err != nil || got.Path != tt.want.Path || got.Pattern != tt.want.Pattern ||
+			got.From.String() != tt.want.From.String() || got.Rev.String() != tt.want.Rev.String() {
+			t.Errorf("%s: %+v %v, want %+v", tt.in, got, err, tt.want)
+			continue
+		}
+		out := tt.out
+		if out == "" {
+			out = tt.in
+		}
+		if got.String() != out {
+			t.Errorf("%s: String() %s, want %s", tt.in, got.String(), out)
+		}
+	}
+
+	for _, in := range []string{"", "#3", "//depot/a.txt#3,", "//depot/a.txt#1,#2,#3", "//depot/a.txt#x", "//depot/a.txt@=0,@=1"} {
+		if file, err := perforce.ParseFileSpec(in); err == nil {
+			t.Errorf("%q: no error, %+v", in, file)
+		}
+	}
+	if err := (perforce.FileSpec{Path: "//depot/a.txt", From: perforce.RevNum(1)}).Validate(); err == nil {
+		t.Errorf("range without end: no error")
+	}
+	if err := perforce.NewFileSpec("//depot/a\n.txt", perforce.HeadRev()).Validate(); err == nil {
+		t.Errorf("new line: no error")
+	}
+}
+
+func TestEscapePath(t *testing.T) {
+	tests := []struct{ path, escaped string }{
+		{"//depot/a.txt", "//depot/a.txt"},
+		{"//depot/icon@2x.png", "//depot/icon%402x.png"},
+		{"//depot/#1.txt", "//depot/%231.txt"},
+		{"//depot/100%.txt", "//depot/100%25.txt"},
+		{"//depot/*.txt", "//depot/%2A.txt"},
+		{"//depot/%40@#*.txt", "//depot/%2540%40%23%2A.txt"},
+		{"//depot/été ü.txt", "//depot/été ü.txt"},
+	}
+	for _, tt := range tests {
+		if got := perforce.EscapePath(tt.path); got != tt.escaped {
+			t.Errorf("EscapePath(%s) = %s, want %s", tt.path, got, tt.escaped)
+		}
+		if got := perforce.UnescapePath(tt.escaped); got != tt.path {
+			t.Errorf("UnescapePath(%s) = %s, want %s", tt.escaped, got, tt.path)
+		}
+	}
+	// Lower case codes, unknown codes and truncated codes
+	for escaped, want := range map[string]string{"a%2a%40": "a*@", "a%41%2": "a%41%2", "100%": "100%"} {
+		if got := perforce.UnescapePath(escaped); got != want {
+			t.Errorf("UnescapePath(%s) = %s, want %s", escaped, got, want)
+		}
+	}
+}
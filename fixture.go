@@ -0,0 +1,298 @@
+package perforce
+
+// Record and replay of p4 command transcripts.
+//
+// A Recorder wraps a Runner and saves every p4 invocation (args, stdin, stdout,
+// stderr, exit code) in a fixture file, one JSON object per line.
+// A Replayer serves the invocations of a fixture file back, without p4 or server,
+// i.e. to reproduce a field issue offline or build regression tests of the parsers.
+//
+// The fixture files are redacted like the traces: passwords and tickets are masked,
+// descriptions and file contents only if the policy of the recorder says so.
+// A masked value of a fixture matches any value when it's replayed.
+//
+//	rec := perforce.NewRecorder(p4.GetRunner(), "fixture.jsonl")
+//	rec.SetRedactPolicy(p4.GetRedactPolicy())
+//	p4.SetRunner(rec)
+//	...
+//	rep, err := perforce.NewReplayer("fixture.jsonl")
+//	p4 := perforce.NewWithRunner("user", "ws", rep)
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Recording - one p4 invocation
+type Recording struct {
+	Args       []string    `json:"args"`
+	Stdin      FixtureData `json:"stdin,omitempty"`
+	Stdout     FixtureData `json:"stdout,omitempty"`
+	Stderr     FixtureData `json:"stderr,omitempty"`
+	ExitCode   int         `json:"exitCode"`
+	Error      string      `json:"error,omitempty"`      // the command couldn't be run
+	OutputFile FixtureData `json:"outputFile,omitempty"` // content written by p4 print -o
+}
+
+// FixtureData - bytes saved as a JSON string when valid utf8 (readable fixtures),
+// or as {"base64": "..."} otherwise.
+type FixtureData []byte
+
+func (d FixtureData) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(d) {
+		return json.Marshal(string(d))
+	}
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(d)})
+}
+
+func (d *FixtureData) UnmarshalJSON(b []byte) (err error) {
+	var s string
+	if err = json.Unmarshal(b, &s); err == nil {
+		*d = FixtureData(s)
+		return nil
+	}
+	var m map[string]string
+	if err = json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	*d, err = base64.StdEncoding.DecodeString(m["base64"])
+	return err
+}
+
+// SetRunner()
+//	Set the runner executing the p4 commands, i.e. a Recorder or a Replayer.
+//	Not safe if the instance is shared between goroutines - see WithRunner()
+func (p *Perforce) SetRunner(runner Runner) {
+	p.runner = runner
+}
+
+// GetRunner()
+func (p *Perforce) GetRunner() (runner Runner) {
+	return p.runner
+}
+
+// ---------------------------------------
+// Recorder
+
+// Recorder - runner saving all the invocations in a fixture file
+type Recorder struct {
+	runner       Runner
+	path         string
+	redactPolicy RedactPolicy // what is masked in the fixture file
+	mu           sync.Mutex
+}
+
+// NewRecorder()
+//	Create a recorder running the commands with runner and appending them to a fixture file.
+//	WARNING: the fixture file holds the command lines, the forms and the outputs.
+//	Only passwords and tickets are masked by default: set the redaction policy of the
+//	instance (SetRedactPolicy()) before committing fixtures with descriptions or
+//	file contents.
+func NewRecorder(runner Runner, fixtureFile string) *Recorder {
+	return &Recorder{runner: runner, path: fixtureFile}
+}
+
+// SetRedactPolicy()
+//	Set what is masked in the fixture file, i.e. the policy of the instance
+//	(see Perforce.GetRedactPolicy()).
+//	To be called before the recorder is used.
+func (r *Recorder) SetRedactPolicy(policy RedactPolicy) {
+	r.redactPolicy = policy
+}
+
+// Run()
+//	Run the command and append it to the fixture file, redacted.
+//	A failure to write the fixture file is returned as a run error.
+func (r *Recorder) Run(args []string, stdin io.Reader) (stdout []byte, stderr []byte, exitCode int, err error) {
+	policy := r.redactPolicy
+	rec := Recording{Args: policy.redactArgs(args)}
+	if out := printOutputFile(args); len(out) > 0 { // temporary file, not a secret
+		for i := range args {
+			if args[i] == out {
+				rec.Args[i] = out
+			}
+		}
+	}
+	if stdin != nil {
+		in, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		rec.Stdin = FixtureData(policy.redact(string(in)))
+		stdin = bytes.NewReader(in)
+	}
+
+	stdout, stderr, exitCode, err = r.runner.Run(args, stdin)
+	rec.Stdout = FixtureData(policy.redact(string(stdout)))
+	rec.Stderr = FixtureData(policy.redact(string(stderr)))
+	rec.ExitCode = exitCode
+	if err != nil {
+		rec.Error = policy.redact(err.Error())
+	}
+	if out := printOutputFile(args); len(out) > 0 {
+		rec.OutputFile, _ = os.ReadFile(out)
+		if policy.FileContents && !policy.Disabled && len(rec.OutputFile) > 0 {
+			rec.OutputFile = FixtureData(redactMask)
+		}
+	}
+
+	line, jerr := json.Marshal(rec)
+	if jerr != nil {
+		return stdout, stderr, exitCode, jerr
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ferr := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if ferr != nil {
+		return stdout, stderr, exitCode, fmt.Errorf("Unable to write fixture file - %v", ferr)
+	}
+	defer f.Close()
+	if _, ferr = f.Write(append(line, '\n')); ferr != nil {
+		return stdout, stderr, exitCode, fmt.Errorf("Unable to write fixture file - %v", ferr)
+	}
+
+	return stdout, stderr, exitCode, err
+}
+
+// ---------------------------------------
+// Replayer
+
+// Replayer - runner serving the invocations of a fixture file
+type Replayer struct {
+	recordings []Recording
+	used       []bool
+	mu         sync.Mutex
+}
+
+// NewReplayer()
+//	Load a fixture file written by a Recorder.
+func NewReplayer(fixtureFile string) (r *Replayer, err error) {
+	f, err := os.Open(fixtureFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadFixture(f)
+}
+
+// ReadFixture()
+//	Create a replayer from fixture data: one JSON Recording per line.
+func ReadFixture(in io.Reader) (r *Replayer, err error) {
+	r = &Replayer{}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 256*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) <= 0 {
+			continue
+		}
+		var rec Recording
+		if err = json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("Error parsing fixture line %d: %v", n, err)
+		}
+		r.recordings = append(r.recordings, rec)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	r.used = make([]bool, len(r.recordings))
+	return r, nil
+}
+
+// Run()
+//	Serve the first recording not used yet with the same args and stdin.
+//	The temporary output file of p4 print -o may differ: the recorded content is written to it.
+//	The values masked in the fixture (redacted) match any value.
+//	Returns an error if no recording matches.
+func (r *Replayer) Run(args []string, stdin io.Reader) (stdout []byte, stderr []byte, exitCode int, err error) {
+	var in []byte
+	if stdin != nil {
+		if in, err = io.ReadAll(stdin); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, rec := range r.recordings {
+		if r.used[i] || !sameArgs(rec.Args, args) || !sameRedacted(string(rec.Stdin), string(in)) {
+			continue
+		}
+		r.used[i] = true
+		if out := printOutputFile(args); len(out) > 0 && rec.OutputFile != nil {
+			if err = os.WriteFile(out, rec.OutputFile, 0644); err != nil {
+				return nil, nil, 0, err
+			}
+		}
+		if len(rec.Error) > 0 {
+			return rec.Stdout, rec.Stderr, rec.ExitCode, fmt.Errorf("%s", rec.Error)
+		}
+		return rec.Stdout, rec.Stderr, rec.ExitCode, nil
+	}
+	return nil, nil, 0, fmt.Errorf("No recorded p4 invocation for: p4 %s", strings.Join(args, " "))
+}
+
+// Unused()
+//	Returns the recordings not replayed yet, i.e. to check a test replayed the whole fixture.
+func (r *Replayer) Unused() (recordings []Recording) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, rec := range r.recordings {
+		if !r.used[i] {
+			recordings = append(recordings, rec)
+		}
+	}
+	return recordings
+}
+
+// Compare recorded args with args - the output file of p4 print -o is a temporary file and is ignored
+func sameArgs(recorded []string, args []string) bool {
+	if len(recorded) != len(args) {
+		return false
+	}
+	outA, outB := printOutputFile(recorded), printOutputFile(args)
+	for i := range recorded {
+		if !sameRedacted(recorded[i], args[i]) && !(recorded[i] == outA && args[i] == outB) {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare recorded data with data - the masked parts of the recorded data match anything
+func sameRedacted(recorded string, data string) bool {
+	if !strings.Contains(recorded, redactMask) {
+		return recorded == data
+	}
+	parts := strings.Split(recorded, redactMask)
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return regexp.MustCompile("(?s)^" + strings.Join(parts, ".*") + "$").MatchString(data)
+}
+
+// Output file of a p4 print -o command, "" if none
+func printOutputFile(args []string) string {
+	isPrint := false
+	for i, a := range args {
+		if a == "print" {
+			isPrint = true
+			continue
+		}
+		if isPrint && a == "-o" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
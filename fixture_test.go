@@ -0,0 +1,108 @@
+package perforce_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	perforce "github.com/fabdem/go-perforce"
+	"github.com/fabdem/go-perforce/perforcetest"
+)
+
+// Calls recorded then replayed
+func fixtureCalls(t *testing.T, p *perforce.Perforce, description string) (results []string) {
+	rev, err := p.GetHeadRev("//depot/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	temp, _, err := p.GetFile("//depot/bin.dat", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(temp)
+	content, _ := os.ReadFile(temp)
+	cl, err := p.PutCLSpecProperties(perforce.T_CLSpecProperties{ChangeList: -1, Description: description})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := p.GetCLSpecProperties(cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []string{strconv.Itoa(rev), string(content), strconv.Itoa(cl), spec.Status}
+}
+
+func TestRecordReplay(t *testing.T) {
+	srv := perforcetest.NewServer()
+	srv.AddClient("ws", t.TempDir(), "//depot/... //ws/...")
+	srv.AddFile("//depot/a.txt", "text", "a\n")
+	srv.AddFile("//depot/a.txt", "text", "a\nb\n")
+	srv.AddFile("//depot/bin.dat", "binary", "\xff\xfe\x00token=abc123")
+	fixture := filepath.Join(t.TempDir(), "fixture.jsonl")
+
+	rec := perforce.NewRecorder(srv, fixture)
+	policy := perforce.RedactPolicy{Descriptions: true}
+	rec.SetRedactPolicy(policy)
+	recorded := fixtureCalls(t, perforce.NewWithRunner("bob", "ws", rec).WithRedactPolicy(policy), "secret plan")
+	if _, _, _, err := rec.Run([]string{"-P", "pass1234", "-u", "bob", "login", "-s"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Redacted fixture
+	b, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := string(b)
+	for _, secret := range []string{"secret plan", "pass1234"} {
+		if strings.Contains(data, secret) {
+			t.Errorf("%q in the fixture", secret)
+		}
+	}
+	if !strings.Contains(data, `"-P","********"`) || !strings.Contains(data, `\n\t********\n`) || !strings.Contains(data, `"base64"`) {
+		t.Errorf("fixture:\n%s", data)
+	}
+
+	// Replayed: the masked description matches another one
+	rep, err := perforce.NewReplayer(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := perforce.NewWithRunner("bob", "ws", rep)
+	replayed := fixtureCalls(t, p, "other plan")
+	if strings.Join(replayed, "|") != strings.Join(recorded, "|") || recorded[1] != "\xff\xfe\x00token=abc123" {
+		t.Errorf("replayed %q, recorded %q", replayed, recorded)
+	}
+	if unused := rep.Unused(); len(unused) != 1 || unused[0].Args[1] != "********" {
+		t.Errorf("unused %+v", unused)
+	}
+
+	// Each recording is replayed once, other commands aren't recorded
+	if _, err = p.GetHeadRev("//depot/a.txt"); err == nil || !strings.Contains(err.Error(), "No recorded p4 invocation") {
+		t.Errorf("replayed twice: %v", err)
+	}
+	if _, err = p.WithUser("al").GetWorkspaceProperties(""); err == nil {
+		t.Errorf("other user: no error")
+	}
+}
+
+func TestReadFixtureErrors(t *testing.T) {
+	if _, err := perforce.ReadFixture(strings.NewReader("{\"args\":[\"info\"]}\n\nnot json\n")); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("%v", err)
+	}
+	if _, err := perforce.NewReplayer(filepath.Join(t.TempDir(), "none.jsonl")); err == nil {
+		t.Errorf("missing file: no error")
+	}
+	rep, err := perforce.ReadFixture(strings.NewReader(`{"args":["-u","bob","info"],"stdout":"User name: bob\n","exitCode":0}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = rep.Run([]string{"-u", "al", "info"}, nil); err == nil {
+		t.Errorf("mismatched args: no error")
+	}
+	if out, _, _, err := rep.Run([]string{"-u", "bob", "info"}, nil); err != nil || string(out) != "User name: bob\n" {
+		t.Errorf("%q %v", out, err)
+	}
+}
@@ -0,0 +1,125 @@
+package perforce
+
+// Consumer-facing interfaces grouping the API.
+//
+// Depend on these rather than on *Perforce to substitute a mock in tests
+// (see package perforcemock).
+
+// FileQuerier - queries on depot and workspace files
+type FileQuerier interface {
+	GetP4Where(depotFile string) (fileName string, err error)
+	WhereMany(files []string) (res []T_WhereProperties, err error)
+	GetFile(depotFile string, rev int) (tempFile string, fileName string, err error)
+	GetFileAt(file FileSpec) (tempFile string, fileName string, err error)
+	GetP4Files(depotFilePattern string) (properties []T_FilesProperties, err error)
+	GetP4FilesAt(files ...FileSpec) (properties []T_FilesProperties, err error)
+	GetHeadRev(depotFileName string) (rev int, err error)
+	CheckFileExitsInDepot(depotFileName string) (exists bool, err error)
+	GetFileInDepotProperties(FileInDepot string) (properties T_FileProperties, err error)
+	GetFileInDepotPropertiesAt(file FileSpec) (properties T_FileProperties, err error)
+	Annotate(file FileSpec, opts AnnotateOptions) (res T_AnnotateRes, err error)
+	Opened(filter OpenedFilter, files ...FileSpec) (opened []T_OpenedFile, err error)
+	Fstat(files ...FileSpec) (res []T_FstatFile, err error)
+}
+
+// ChangelistManager - changelists content, creation, update and submit
+type ChangelistManager interface {
+	GetCLContent(changeList int) (properties T_CLProperties, err error)
+	GetPendingCLContent(changeList int) (m_files map[string]int, user string, workspace string, err error)
+	GetCLSpecProperties(cl int) (properties T_CLSpecProperties, err error)
+	PutCLSpecProperties(properties T_CLSpecProperties) (CL int, err error)
+	UpdateCL(changelist int, description string) (err error)
+	DeleteCL(changelist int) (err error)
+	Reopen(changelist int, fileType string, files ...string) (reopened []string, err error)
+	SubmitCL(changelist int, description string) (newChangelist int, err error)
+	Submit(opts SubmitOptions) (res T_SubmitRes, err error)
+}
+
+// WorkspaceManager - workspaces and other specs
+type WorkspaceManager interface {
+	GetWorkspaceProperties(workspace string) (properties T_WSProperties, err error)
+	GetViewMap(workspace string) (v *ViewMap, err error)
+	GetSpec(specType string, name string) (s *Spec, err error)
+	PutSpec(specType string, s *Spec, flags ...string) (response string, err error)
+}
+
+// StreamManager - streams and integrations with their parent
+type StreamManager interface {
+	GetStreams(filter StreamFilter) (streams []T_StreamProperties, err error)
+	GetStream(stream string) (properties T_StreamProperties, err error)
+	PutStream(properties T_StreamProperties) (response string, err error)
+	SwitchStream(stream string) (err error)
+	GetStreamStatus(stream string) (status T_StreamStatus, err error)
+	CopyUp(stream string, changelist int, preview bool) (files []T_IntegratedFile, err error)
+	MergeDown(stream string, changelist int, preview bool) (files []T_IntegratedFile, err error)
+}
+
+// LabelManager - labels and files tagged
+type LabelManager interface {
+	GetLabels(filter LabelFilter) (labels []T_LabelProperties, err error)
+	GetLabel(label string) (properties T_LabelProperties, err error)
+	CreateLabel(properties T_LabelProperties) (response string, err error)
+	UpdateLabel(properties T_LabelProperties, force bool) (response string, err error)
+	DeleteLabel(label string, force bool) (err error)
+	Tag(label string, opts TagOptions, files ...FileSpec) (res []T_LabelFile, err error)
+	Labelsync(label string, opts TagOptions, files ...FileSpec) (res []T_LabelFile, err error)
+}
+
+// BranchManager - branch specs and changes to integrate
+type BranchManager interface {
+	GetBranches(filter BranchFilter) (branches []T_BranchProperties, err error)
+	GetBranch(branch string) (properties T_BranchProperties, err error)
+	PutBranch(properties T_BranchProperties, force bool) (response string, err error)
+	DeleteBranch(branch string, force bool) (err error)
+	Interchanges(branch string, reverse bool, files ...FileSpec) (changes []T_ChangeSummary, err error)
+}
+
+// JobManager - jobs and fixes
+type JobManager interface {
+	GetJobSpec() (jobSpec T_JobSpec, err error)
+	GetJobs(filter JobFilter) (jobs []T_JobProperties, err error)
+	GetJob(job string) (properties T_JobProperties, err error)
+	PutJob(properties T_JobProperties) (job string, err error)
+	Fix(changelist int, status string, jobs ...string) (err error)
+	Unfix(changelist int, jobs ...string) (err error)
+}
+
+// Reconciler - workspace files modified outside of Perforce
+type Reconciler interface {
+	Reconcile(opts ReconcileOptions, files ...FileSpec) (res []T_ReconcileFile, err error)
+	Status(opts ReconcileOptions, files ...FileSpec) (res []T_ReconcileFile, err error)
+}
+
+// FileManager - operations on the files opened in a workspace
+type FileManager interface {
+	Move(from FileSpec, to FileSpec, opts MoveOptions) (pairs []T_MovePair, err error)
+	MovePairs(properties T_CLProperties) (pairs []T_MovePair, unpaired []string, err error)
+	Lock(changelist int, files ...FileSpec) (locked []string, err error)
+	Unlock(opts UnlockOptions, files ...FileSpec) (unlocked []string, err error)
+}
+
+// Differ - diffs between depot and workspace
+type Differ interface {
+	DiffHRvsWS(algo string, depotFile string) (res T_DiffRes, err error)
+	DiffHRvsWSWithOptions(algo string, depotFile string, opts DiffOptions) (res T_DiffRes, err error)
+	DiffHRvsWSFiles(algo string, depotFiles []string) (res []T_DiffRes, err error)
+	DiffChangelist(algo string, changelist int) (res []T_DiffRes, err error)
+}
+
+// Client - the whole API
+type Client interface {
+	FileQuerier
+	ChangelistManager
+	WorkspaceManager
+	StreamManager
+	LabelManager
+	BranchManager
+	JobManager
+	Reconciler
+	FileManager
+	Differ
+	P4Info() (output string, err error)
+	GetServerInfo() (info ServerInfo, err error)
+}
+
+var _ Client = (*Perforce)(nil)
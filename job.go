@@ -0,0 +1,386 @@
+package perforce
+
+// Jobs: list, specs and fixes.
+//
+// The fields of the jobs are defined by the jobspec of the server; they're
+// accessed by name:
+//
+//	job, err := p4.GetJob("job000123")
+//	job.Fields["Status"] = "suspended"
+//	_, err = p4.PutJob(job)
+//	err = p4.Fix(1234, "closed", "job000123")
+//
+// The jobspec is read once per instance (and the instances derived with With...()).
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field of the jobspec: "101 Job word 32 required"
+type T_JobField struct {
+	Code      int      // i.e. 101
+	Name      string   // i.e. Job
+	DataType  string   // word, date, select, line, text or bulk
+	Length    int      // recommended length, 0 for no limit
+	FieldType string   // optional, default, required, once or always
+	Values    []string // select fields: possible values
+	Preset    string   // default value, i.e. $user, $now or open,fix/closed for the status
+}
+
+// Jobspec - fields of the jobs
+type T_JobSpec struct {
+	Fields []T_JobField
+	Form   string // Form as it was received
+}
+
+// Job specification
+type T_JobProperties struct {
+	Job    string            // job name, "new" to create a job named by the server
+	Time   time.Time         // Date field in the server timezone. Read-only.
+	Fields map[string]string // all the fields by name (Job, Status, User, Date, Description...). Lines are separated by "\n".
+	Eol    string            // Detect what kind of end of line we receive from the server.
+	Form   string            // Form as it was received
+}
+
+// JobFilter - jobs listed by GetJobs(). The criteria are combined (and).
+type JobFilter struct {
+	Query string // jobview, i.e. "Status=open User=bob"
+	Path  string // jobs fixed by changelists including files of this path, i.e. //depot/main/... - not escaped
+	Max   int    // max number of jobs, 0 for no limit
+}
+
+// Codes of the standard fields of a jobspec
+const (
+	jobFieldJob  = 101
+	jobFieldDate = 104
+)
+
+// GetJobSpec()
+//	Get the jobspec: p4 jobspec -o
+//	The jobspec used by the other functions is refreshed.
+func (p *Perforce) GetJobSpec() (jobSpec T_JobSpec, err error) {
+	p.logThis("GetJobSpec()")
+
+	cache := p.serverData()
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	jobSpec, err = p.p4JobSpec()
+	if err != nil {
+		return jobSpec, err
+	}
+	cache.jobSpec = &jobSpec
+	return jobSpec, nil
+}
+
+// Jobspec cached - p4 jobspec is run the first time only
+func (p *Perforce) jobSpec() (jobSpec T_JobSpec, err error) {
+	cache := p.serverData()
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.jobSpec != nil {
+		return *cache.jobSpec, nil
+	}
+	jobSpec, err = p.p4JobSpec()
+	if err != nil {
+		return jobSpec, err
+	}
+	cache.jobSpec = &jobSpec
+	return jobSpec, nil
+}
+
+// Run and parse p4 jobspec -o
+func (p *Perforce) p4JobSpec() (jobSpec T_JobSpec, err error) {
+	spec, err := p.GetSpec("jobspec", "")
+	if err != nil {
+		return jobSpec, err
+	}
+	if !spec.Has("Fields") {
+		return jobSpec, p.errorf("Error parsing - not a jobspec received from p4: %s", spec)
+	}
+
+	values := specFieldValues(spec.GetLines("Values"))
+	presets := specFieldValues(spec.GetLines("Presets"))
+	for _, line := range spec.GetLines("Fields") {
+		words := strings.Fields(line)
+		if len(words) < 5 {
+			return jobSpec, p.errorf("Error parsing jobspec field: %s", line)
+		}
+		var f T_JobField
+		if f.Code, err = strconv.Atoi(words[0]); err != nil {
+			return jobSpec, p.errorf("Error parsing jobspec field: %s", line)
+		}
+		f.Name, f.DataType, f.FieldType = words[1], words[2], words[4]
+		f.Length, _ = strconv.Atoi(words[3])
+		if v, ok := values[f.Name]; ok {
+			f.Values = strings.Split(v, "/")
+		}
+		f.Preset = presets[f.Name]
+		jobSpec.Fields = append(jobSpec.Fields, f)
+	}
+	jobSpec.Form = spec.String()
+
+	return jobSpec, nil
+}
+
+// Values and Presets lines of a jobspec: "Status open/suspended/closed"
+func specFieldValues(lines []string) (values map[string]string) {
+	values = make(map[string]string)
+	for _, line := range lines {
+		if words := strings.SplitN(strings.TrimSpace(line), " ", 2); len(words) == 2 {
+			values[words[0]] = strings.TrimSpace(words[1])
+		}
+	}
+	return values
+}
+
+// Field()
+//	Field of the jobspec by name.
+func (s T_JobSpec) Field(name string) (field T_JobField, ok bool) {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return field, false
+}
+
+// Name of a field by code, "" if not defined
+func (s T_JobSpec) fieldName(code int) string {
+	for _, f := range s.Fields {
+		if f.Code == code {
+			return f.Name
+		}
+	}
+	return ""
+}
+
+// GetJobs()
+//	List the jobs: p4 jobs -l [-e query] [-m max] [path]
+func (p *Perforce) GetJobs(filter JobFilter) (jobs []T_JobProperties, err error) {
+	p.logThis(fmt.Sprintf("GetJobs(%+v)", filter))
+
+	jobSpec, err := p.jobSpec()
+	if err != nil {
+		return jobs, err
+	}
+
+	args := []string{"-ztag", "jobs", "-l"}
+	if len(filter.Query) > 0 {
+		args = append(args, "-e", filter.Query)
+	}
+	if filter.Max > 0 {
+		args = append(args, "-m", strconv.Itoa(filter.Max))
+	}
+	if len(filter.Path) > 0 {
+		args = append(args, FileSpec{Path: filter.Path, Pattern: true}.String())
+	}
+
+	out, err := p.execP4(nil, args...)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if err != nil {
+		return jobs, p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	// Text fields of the jobspec may span several lines
+	multiLine := make(map[string]bool)
+	for _, f := range jobSpec.Fields {
+		multiLine[f.Name] = f.DataType == "text" || f.DataType == "bulk"
+	}
+	records, _ := parseZtagFields(out, multiLine)
+	for _, r := range records {
+		job := T_JobProperties{Job: r[jobSpec.fieldName(jobFieldJob)], Fields: r}
+		if len(job.Job) <= 0 {
+			continue
+		}
+		job.Time = p.dateOf(r[jobSpec.fieldName(jobFieldDate)])
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// GetJob()
+//	Get a job spec: p4 job -o job
+//	The server returns a default spec if the job doesn't exist or if job is "" or "new".
+func (p *Perforce) GetJob(job string) (properties T_JobProperties, err error) {
+	p.logThis(fmt.Sprintf("GetJob(%s)", job))
+
+	jobSpec, err := p.jobSpec()
+	if err != nil {
+		return properties, err
+	}
+
+	spec, err := p.GetSpec("job", job)
+	if err != nil {
+		return properties, err
+	}
+	jobField := jobSpec.fieldName(jobFieldJob)
+	if !spec.Has(jobField) {
+		return properties, p.errorf("Error parsing - not a job spec received from p4: %s", spec)
+	}
+
+	properties.Eol = spec.Eol
+	properties.Job = spec.Get(jobField)
+	properties.Fields = make(map[string]string)
+	for _, name := range spec.Fields() {
+		properties.Fields[name] = spec.Get(name)
+	}
+	properties.Time = p.dateOf(properties.Fields[jobSpec.fieldName(jobFieldDate)])
+
+	properties.Form = spec.String()
+
+	return properties, nil
+}
+
+// PutJob()
+//	Create or update a job: p4 job -i
+//	The fields are checked against the jobspec: unknown fields, values of select
+//	fields and required fields. The fields set by the server (always) aren't written.
+//	If properties.Form is set (i.e. returned by GetJob()) it's used as a base and
+//	only the modified fields are rewritten.
+//	Returns the name of the job, i.e. job000123 for a new job.
+func (p *Perforce) PutJob(properties T_JobProperties) (job string, err error) {
+	p.logThis(fmt.Sprintf("PutJob(%s)", properties.Job))
+
+	jobSpec, err := p.jobSpec()
+	if err != nil {
+		return job, err
+	}
+
+	spec := NewSpec()
+	if len(properties.Form) > 0 {
+		spec, err = ParseSpec(properties.Form)
+		if err != nil {
+			return job, err
+		}
+	}
+	if len(properties.Eol) > 0 {
+		spec.Eol = properties.Eol
+	}
+
+	for name := range properties.Fields {
+		if _, ok := jobSpec.Field(name); !ok {
+			return job, fmt.Errorf("PutJob() - Field %s not in the jobspec", name)
+		}
+	}
+
+	name := properties.Job
+	if len(name) <= 0 {
+		name = "new"
+	}
+	for _, f := range jobSpec.Fields {
+		value, ok := properties.Fields[f.Name]
+		if f.Code == jobFieldJob {
+			value, ok = name, true
+		}
+		if !ok || f.FieldType == "always" {
+			continue
+		}
+		value = strings.TrimRight(strings.ReplaceAll(value, "\r\n", "\n"), "\n")
+		if f.DataType == "select" && len(value) > 0 && !containsString(f.Values, value) {
+			return job, fmt.Errorf("PutJob() - Invalid value for %s: %s - expected one of %v", f.Name, value, f.Values)
+		}
+		if f.DataType == "text" || f.DataType == "bulk" {
+			spec.SetLines(f.Name, strings.Split(value, "\n"))
+		} else {
+			spec.Set(f.Name, value)
+		}
+	}
+	for _, f := range jobSpec.Fields {
+		if f.FieldType == "required" && len(f.Preset) <= 0 && len(strings.TrimSpace(spec.Get(f.Name))) <= 0 {
+			return job, fmt.Errorf("PutJob() - Required field %s missing", f.Name)
+		}
+	}
+
+	out, err := p.PutSpec("job", spec)
+	if err != nil {
+		return job, err
+	}
+
+	// "Job job000123 saved." or "Job job000123 not changed."
+	matches := jobSavedPattern.FindStringSubmatch(out)
+	if len(matches) < 2 {
+		return job, p.errorf("Error unexpected response. Received %s", out)
+	}
+	return matches[1], nil
+}
+
+var jobSavedPattern = regexp.MustCompile(`(?m)^Job (\S+) (?:saved|not changed)`)
+
+// Fix()
+//	Link jobs to a changelist: p4 fix [-s status] -c changelist job...
+//	The status of the jobs is set when the changelist is submitted, or
+//	immediately if it's already submitted.
+//	Long lists of jobs are split in batches (see SetBatchSize()).
+// 	Input:
+//		- changelist
+//		- status of the jobs, "" for the default of the jobspec (usually closed)
+//		- jobs
+func (p *Perforce) Fix(changelist int, status string, jobs ...string) (err error) {
+	p.logThis(fmt.Sprintf("Fix(%d, %s, %v)", changelist, status, jobs))
+
+	args := []string{"fix"}
+	if len(status) > 0 {
+		args = append(args, "-s", status)
+	}
+	return p.fix("Fix()", args, changelist, jobs)
+}
+
+// Unfix()
+//	Remove the link between jobs and a changelist: p4 fix -d -c changelist job...
+//	The status of the jobs isn't changed.
+func (p *Perforce) Unfix(changelist int, jobs ...string) (err error) {
+	p.logThis(fmt.Sprintf("Unfix(%d, %v)", changelist, jobs))
+	return p.fix("Unfix()", []string{"fix", "-d"}, changelist, jobs)
+}
+
+func (p *Perforce) fix(caller string, args []string, changelist int, jobs []string) (err error) {
+	if changelist <= 0 {
+		return fmt.Errorf("%s - Invalid changelist: %d", caller, changelist)
+	}
+	if len(jobs) <= 0 {
+		return fmt.Errorf("%s - No job specified", caller)
+	}
+
+	args = append(args, "-c", strconv.Itoa(changelist))
+	out, err := p.execP4Files(args, jobs)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if err != nil {
+		return p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	return nil
+}
+
+// Jobs of a change spec:
+//	job000123	# open
+func specJobs(spec *Spec) (jobs []string) {
+	for _, line := range spec.GetLines("Jobs") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if job := strings.TrimSpace(line); len(job) > 0 {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package perforce_test
+
+import (
+	"reflect"
+	"testing"
+
+	perforce "github.com/fabdem/go-perforce"
+)
+
+func TestJobSpec(t *testing.T) {
+	_, p := newChangeServer(t)
+
+	spec, err := p.GetJobSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Fields) != 5 {
+		t.Fatalf("%+v", spec.Fields)
+	}
+	status, ok := spec.Field("Status")
+	want := perforce.T_JobField{Code: 102, Name: "Status", DataType: "select", Length: 10, FieldType: "required",
+		Values: []string{"open", "suspended", "closed"}, Preset: "open"}
+	if !ok || !reflect.DeepEqual(status, want) {
+		t.Errorf("%+v", status)
+	}
+	if date, _ := spec.Field("Date"); date.Code != 104 || date.FieldType != "always" || date.Preset != "$now" {
+		t.Errorf("%+v", date)
+	}
+	if _, ok = spec.Field("Severity"); ok {
+		t.Errorf("field not in the jobspec found")
+	}
+}
+
+func TestJobs(t *testing.T) {
+	srv, p := newChangeServer(t)
+
+	job, err := p.PutJob(perforce.T_JobProperties{Job: "new", Fields: map[string]string{"Status": "open", "User": "bob", "Description": "Crash\non start\n"}})
+	if err != nil || job != "job000001" {
+		t.Fatalf("%s %v", job, err)
+	}
+	if _, err = p.PutJob(perforce.T_JobProperties{Fields: map[string]string{"Status": "closed", "User": "alice", "Description": "Slow"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.PutJob(perforce.T_JobProperties{Fields: map[string]string{"Status": "fixed", "Description": "Leak"}}); err == nil {
+		t.Errorf("invalid status: no error")
+	}
+	if _, err = p.PutJob(perforce.T_JobProperties{Fields: map[string]string{"Severity": "A", "Description": "Leak"}}); err == nil {
+		t.Errorf("unknown field: no error")
+	}
+
+	// Round trip: the date is set by the server
+	j, err := p.GetJob("job000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Job != "job000001" || j.Fields["Status"] != "open" || j.Fields["User"] != "bob" || j.Fields["Description"] != "Crash\non start" ||
+		j.Time.IsZero() || j.Time.Format("2006/01/02 15:04:05") != j.Fields["Date"] {
+		t.Errorf("%+v", j)
+	}
+
+	// Update from the form received: only the modified fields are rewritten
+	j.Fields = map[string]string{"Status": "suspended"}
+	if job, err = p.PutJob(j); err != nil || job != "job000001" {
+		t.Fatalf("%s %v", job, err)
+	}
+	if j, err = p.GetJob("job000001"); err != nil || j.Fields["Status"] != "suspended" || j.Fields["Description"] != "Crash\non start" {
+		t.Errorf("%+v %v", j, err)
+	}
+
+	jobs, err := p.GetJobs(perforce.JobFilter{Query: "User=bob"})
+	if err != nil || len(jobs) != 1 || jobs[0].Job != "job000001" || jobs[0].Fields["Description"] != "Crash\non start" || jobs[0].Time.IsZero() {
+		t.Fatalf("%+v %v", jobs, err)
+	}
+	if cmd := lastCommand(srv); cmd != "jobs -l -e User=bob" {
+		t.Errorf("%s", cmd)
+	}
+	if jobs, _ = p.GetJobs(perforce.JobFilter{Max: 1}); len(jobs) != 1 {
+		t.Errorf("max: %+v", jobs)
+	}
+}
+
+func TestFix(t *testing.T) {
+	srv, p := newChangeServer(t)
+	for _, desc := range []string{"Crash", "Slow"} {
+		if _, err := p.PutJob(perforce.T_JobProperties{Fields: map[string]string{"Status": "open", "User": "bob", "Description": desc}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cl := srv.CreateChange("bob", "ws", "fix a")
+	srv.Open("ws", "edit", "//depot/a.txt", cl)
+
+	if err := p.Fix(cl, "", "job000001", "job000002"); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := p.GetCLSpecProperties(cl); err != nil || !reflect.DeepEqual(c.Jobs, []string{"job000001", "job000002"}) {
+		t.Errorf("%+v %v", c, err)
+	}
+	// Status set at submit only
+	if j, _ := p.GetJob("job000001"); j.Fields["Status"] != "open" {
+		t.Errorf("status %s", j.Fields["Status"])
+	}
+
+	if err := p.Unfix(cl, "job000001"); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := p.GetCLSpecProperties(cl); err != nil || !reflect.DeepEqual(c.Jobs, []string{"job000002"}) {
+		t.Errorf("%+v %v", c, err)
+	}
+	if err := p.Unfix(cl, "job000001"); err == nil {
+		t.Errorf("fix not found: no error")
+	}
+	if err := p.Fix(cl, "", "job000099"); err == nil {
+		t.Errorf("unknown job: no error")
+	}
+	if err := p.Fix(cl, ""); err == nil {
+		t.Errorf("no job: no error")
+	}
+
+	// Fixed by the submitted change 1 (add of a.txt): the status is set immediately
+	if err := p.Fix(1, "suspended", "job000001"); err != nil {
+		t.Fatal(err)
+	}
+	if j, _ := p.GetJob("job000001"); j.Fields["Status"] != "suspended" {
+		t.Errorf("status %s", j.Fields["Status"])
+	}
+	if jobs, err := p.GetJobs(perforce.JobFilter{Path: "//depot/a.txt"}); err != nil || len(jobs) != 1 || jobs[0].Job != "job000001" {
+		t.Errorf("jobs of a.txt: %+v %v", jobs, err)
+	}
+	if jobs, err := p.GetJobs(perforce.JobFilter{Path: "//depot/b@1.txt"}); err != nil || len(jobs) != 0 {
+		t.Errorf("jobs of b@1.txt: %+v %v", jobs, err)
+	}
+}
@@ -0,0 +1,364 @@
+package perforce
+
+// Labels: list, specs and files tagged.
+//
+//	_, err := p4.CreateLabel(perforce.T_LabelProperties{Label: "rel-1.0", Description: "Release 1.0",
+//		View: []string{"//depot/main/..."}})
+//	files, err := p4.Labelsync("rel-1.0", perforce.TagOptions{}, perforce.FileSpec{Path: "//depot/main/...", Pattern: true, Rev: perforce.AtChange(1234)})
+//
+// Label views are in p4 syntax (escaped), like workspace views.
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Label specification
+type T_LabelProperties struct {
+	Label       string
+	Update      string    // The date this specification was last modified.
+	Time        time.Time // Update in the server timezone. Read-only.
+	Access      string
+	Owner       string
+	Description string   // Lines are separated by "\n".
+	Options     []string // unlocked/locked, noautoreload/autoreload
+	Revision    string   // automatic labels: revision of the files in the view, i.e. @1234 - "" for a static label
+	ServerID    string   // edge servers: server of a local label - not set by GetLabels()
+	View        []string // depot paths, i.e. //depot/main/... - not set by GetLabels()
+	Eol         string   // Detect what kind of end of line we receive from the server.
+	Form        string   // Form as it was received
+}
+
+// LabelFilter - labels listed by GetLabels(). The criteria are combined (and).
+type LabelFilter struct {
+	Owner           string
+	Name            string // name or pattern with * wildcards, i.e. rel-1.*
+	CaseInsensitive bool   // match of Name
+	Path            string // labels containing files of this path, i.e. //depot/main/... - not escaped
+	Max             int    // max number of labels, 0 for no limit
+	Unloaded        bool   // unloaded labels (-U)
+}
+
+// TagOptions - options of Tag() and Labelsync()
+type TagOptions struct {
+	Preview bool // list the files without updating the label (-n)
+	Delete  bool // remove the files from the label (-d)
+	Add     bool // Labelsync() only: add the files without removing the others (-a)
+}
+
+// File added, updated or deleted by Tag() or Labelsync()
+type T_LabelFile struct {
+	DepotFile string
+	Rev       int    // revision tagged
+	Action    string // added, updated or deleted
+}
+
+// GetLabels()
+//	List the labels: p4 labels [-U] [-u owner] [-e|-E name] [-m max] [path]
+//	The views of the specs aren't returned, see GetLabel().
+func (p *Perforce) GetLabels(filter LabelFilter) (labels []T_LabelProperties, err error) {
+	p.logThis(fmt.Sprintf("GetLabels(%+v)", filter))
+
+	args := []string{"-ztag", "labels"}
+	if filter.Unloaded {
+		args = append(args, "-U")
+	}
+	if len(filter.Owner) > 0 {
+		args = append(args, "-u", filter.Owner)
+	}
+	if len(filter.Name) > 0 {
+		if filter.CaseInsensitive {
+			args = append(args, "-E", filter.Name)
+		} else {
+			args = append(args, "-e", filter.Name)
+		}
+	}
+	if filter.Max > 0 {
+		args = append(args, "-m", strconv.Itoa(filter.Max))
+	}
+	if len(filter.Path) > 0 {
+		args = append(args, FileSpec{Path: filter.Path, Pattern: true}.String())
+	}
+
+	out, err := p.execP4(nil, args...)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if err != nil {
+		return labels, p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	records, _ := parseZtag(out)
+	for _, r := range records {
+		var l T_LabelProperties
+		if l.Label = r["label"]; len(l.Label) <= 0 {
+			if l.Label = r["Label"]; len(l.Label) <= 0 {
+				continue
+			}
+		}
+		l.Time = p.dateOf(r["Update"])
+		l.Update = r["Update"]
+		if !l.Time.IsZero() {
+			l.Update = l.Time.Format("2006/01/02 15:04:05")
+		}
+		l.Access = r["Access"]
+		if t := p.dateOf(r["Access"]); !t.IsZero() {
+			l.Access = t.Format("2006/01/02 15:04:05")
+		}
+		l.Owner = r["Owner"]
+		l.Description = r["Description"]
+		l.Options = strings.Fields(r["Options"])
+		l.Revision = r["Revision"]
+		labels = append(labels, l)
+	}
+
+	return labels, nil
+}
+
+// GetLabel()
+//	Get a label spec: p4 label -o label
+//	The server returns a default spec if the label doesn't exist.
+func (p *Perforce) GetLabel(label string) (properties T_LabelProperties, err error) {
+	p.logThis(fmt.Sprintf("GetLabel(%s)", label))
+
+	if len(label) <= 0 {
+		return properties, fmt.Errorf("GetLabel() - No label specified")
+	}
+
+	spec, err := p.GetSpec("label", label)
+	if err != nil {
+		return properties, err
+	}
+	if !spec.Has("Label") {
+		return properties, p.errorf("Error parsing - not a label spec received from p4: %s", spec)
+	}
+
+	properties.Eol = spec.Eol
+	properties.Label = spec.Get("Label")
+	properties.Update = spec.Get("Update")
+	properties.Time = p.dateOf(properties.Update)
+	properties.Access = spec.Get("Access")
+	properties.Owner = spec.Get("Owner")
+	properties.Description = spec.Get("Description")
+	properties.Options = strings.Fields(spec.Get("Options"))
+	properties.Revision = spec.Get("Revision")
+	properties.ServerID = spec.Get("ServerID")
+	properties.View = spec.GetLines("View")
+
+	properties.Form = spec.String()
+
+	return properties, nil
+}
+
+// CreateLabel()
+//	Create a label: p4 label -i
+//	Fails if the label exists. A label without view contains any file (//...).
+//	Returns the server response, i.e. "Label rel-1.0 saved."
+func (p *Perforce) CreateLabel(properties T_LabelProperties) (response string, err error) {
+	p.logThis(fmt.Sprintf("CreateLabel(%s)", properties.Label))
+
+	if len(properties.Label) <= 0 {
+		return response, fmt.Errorf("CreateLabel() - No label specified")
+	}
+	if strings.ContainsAny(properties.Label, "*") || strings.Contains(properties.Label, "...") {
+		return response, fmt.Errorf("CreateLabel() - Invalid label name: %s", properties.Label)
+	}
+
+	existing, err := p.GetLabels(LabelFilter{Name: properties.Label})
+	if err != nil {
+		return response, err
+	}
+	if len(existing) > 0 {
+		return response, fmt.Errorf("CreateLabel() - Label %s already exists", properties.Label)
+	}
+
+	return p.putLabel(properties, false)
+}
+
+// UpdateLabel()
+//	Update a label: p4 label -i [-f]
+//	If properties.Form is set (i.e. returned by GetLabel()) it's used
+//	as a base and only the modified fields are rewritten.
+//	force (-f) allows the update of a label owned by another user (admin).
+//	Returns the server response, i.e. "Label rel-1.0 saved."
+func (p *Perforce) UpdateLabel(properties T_LabelProperties, force bool) (response string, err error) {
+	p.logThis(fmt.Sprintf("UpdateLabel(%s, %t)", properties.Label, force))
+
+	if len(properties.Label) <= 0 {
+		return response, fmt.Errorf("UpdateLabel() - No label specified")
+	}
+
+	return p.putLabel(properties, force)
+}
+
+// DeleteLabel()
+//	Delete a label: p4 label -d [-f] label
+//	force (-f) allows the deletion of a locked label or of a label owned by another user (admin).
+func (p *Perforce) DeleteLabel(label string, force bool) (err error) {
+	p.logThis(fmt.Sprintf("DeleteLabel(%s, %t)", label, force))
+
+	if len(label) <= 0 {
+		return fmt.Errorf("DeleteLabel() - No label specified")
+	}
+
+	args := []string{"label", "-d"}
+	if force {
+		args = append(args, "-f")
+	}
+	out, err := p.execP4(nil, append(args, label)...)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if err != nil {
+		return p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+	if !strings.Contains(string(out), "deleted") {
+		return p.errorf("Error unexpected response. Received %s", out)
+	}
+
+	return nil
+}
+
+func (p *Perforce) putLabel(properties T_LabelProperties, force bool) (response string, err error) {
+	spec := NewSpec()
+	if len(properties.Form) > 0 {
+		spec, err = ParseSpec(properties.Form)
+		if err != nil {
+			return response, err
+		}
+	}
+	if len(properties.Eol) > 0 {
+		spec.Eol = properties.Eol
+	}
+
+	spec.Set("Label", properties.Label)
+	if len(properties.Owner) > 0 {
+		spec.Set("Owner", properties.Owner)
+	}
+	descr := strings.TrimRight(strings.ReplaceAll(properties.Description, "\r\n", "\n"), "\n")
+	spec.SetLines("Description", strings.Split(descr, "\n"))
+	if len(properties.Options) > 0 {
+		spec.Set("Options", strings.Join(properties.Options, " "))
+	}
+	if len(properties.Revision) > 0 {
+		spec.Set("Revision", properties.Revision)
+	} else {
+		spec.Delete("Revision")
+	}
+	if len(properties.ServerID) > 0 {
+		spec.Set("ServerID", properties.ServerID)
+	}
+	if len(properties.View) > 0 {
+		spec.SetLines("View", properties.View)
+	} else if !spec.Has("View") {
+		spec.SetLines("View", []string{"//..."})
+	}
+
+	var flags []string
+	if force {
+		flags = append(flags, "-f")
+	}
+	return p.PutSpec("label", spec, flags...)
+}
+
+// Tag()
+//	Tag files with a label: p4 tag [-n] [-d] -l label file...
+//	The files tagged are added to the label, the others are kept.
+// 	Input:
+//		- label
+//		- options: preview (-n), remove the files from the label (-d)
+//		- files with an optional revision, head revision if unspecified
+//  Return:
+//		- the files added, updated or deleted
+//		- err code, nil if okay
+func (p *Perforce) Tag(label string, opts TagOptions, files ...FileSpec) (res []T_LabelFile, err error) {
+	p.logThis(fmt.Sprintf("Tag(%s, %+v, %v)", label, opts, files))
+
+	if len(files) <= 0 {
+		return res, fmt.Errorf("Tag() - No file specified")
+	}
+	return p.labelFiles("tag", label, opts, files)
+}
+
+// Labelsync()
+//	Synchronize a label with files: p4 labelsync [-n] [-a|-d] -l label [file...]
+//	Without -a the files of the label not listed are removed.
+// 	Input:
+//		- label
+//		- options: preview (-n), add the files only (-a), remove the files (-d)
+//		- files with an optional revision, none for the revisions synced in the current workspace
+//  Return:
+//		- the files added, updated or deleted, none if the label is in sync
+//		- err code, nil if okay
+func (p *Perforce) Labelsync(label string, opts TagOptions, files ...FileSpec) (res []T_LabelFile, err error) {
+	p.logThis(fmt.Sprintf("Labelsync(%s, %+v, %v)", label, opts, files))
+
+	if opts.Add && opts.Delete {
+		return res, fmt.Errorf("Labelsync() - Add and Delete are exclusive")
+	}
+	return p.labelFiles("labelsync", label, opts, files)
+}
+
+// Files of tag and labelsync output:
+//	//depot/main/a.txt#3 - added
+var labelFilePattern = regexp.MustCompile(`(?m)^(//[^#\r\n]*)#([0-9]+|none) - (added|updated|deleted)`)
+
+// Nothing to tag
+var labelInSyncPattern = regexp.MustCompile(`(?m)label in sync|no such file\(s\)`)
+
+func (p *Perforce) labelFiles(cmd string, label string, opts TagOptions, files []FileSpec) (res []T_LabelFile, err error) {
+	if len(label) <= 0 {
+		return res, fmt.Errorf("%s - No label specified", cmd)
+	}
+
+	args := []string{cmd}
+	if opts.Preview {
+		args = append(args, "-n")
+	}
+	if opts.Add && cmd == "labelsync" {
+		args = append(args, "-a")
+	}
+	if opts.Delete {
+		args = append(args, "-d")
+	}
+	args = append(args, "-l", label)
+
+	var out []byte
+	if len(files) > 0 {
+		fileArgs := make([]string, len(files))
+		for i, f := range files {
+			if fileArgs[i], err = p.fileSpecArg(f); err != nil {
+				return res, err
+			}
+		}
+		if cmd == "labelsync" && !opts.Add && !opts.Delete {
+			// Not split in chunks: each chunk would remove the files of the previous ones.
+			// p4 -x runs the command per batch of -b files (128 by default): one batch of all.
+			batch := []string{"-x", "-", "-b", strconv.Itoa(len(fileArgs))}
+			out, err = p.execP4(strings.NewReader(strings.Join(fileArgs, "\n")+"\n"), append(batch, args...)...)
+		} else {
+			out, err = p.execP4Files(args, fileArgs)
+		}
+	} else {
+		out, err = p.execP4(nil, args...)
+	}
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if err != nil && !allBenign(otherLines(out, labelFilePattern), labelInSyncPattern) {
+		return res, p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	for _, m := range labelFilePattern.FindAllSubmatch(out, -1) {
+		var f T_LabelFile
+		f.DepotFile = UnescapePath(string(m[1]))
+		f.Rev, _ = strconv.Atoi(string(m[2]))
+		f.Action = string(m[3])
+		res = append(res, f)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,188 @@
+package perforce_test
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	perforce "github.com/fabdem/go-perforce"
+)
+
+func TestLabelSpecs(t *testing.T) {
+	srv, p := newChangeServer(t)
+
+	if _, err := p.CreateLabel(perforce.T_LabelProperties{Label: "rel-1.0", Owner: "bob", Description: "Release\n1.0",
+		Options: []string{"locked", "noautoreload"}, View: []string{"//depot/...", `"//depot/sp ace/..."`}}); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := lastCommand(srv); cmd != "label -i" {
+		t.Errorf("%s", cmd)
+	}
+	if _, err := p.CreateLabel(perforce.T_LabelProperties{Label: "rel-1.0"}); err == nil {
+		t.Errorf("existing label: no error")
+	}
+	if _, err := p.CreateLabel(perforce.T_LabelProperties{Label: "rel-*"}); err == nil {
+		t.Errorf("label name with a wildcard: no error")
+	}
+
+	l, err := p.GetLabel("rel-1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Label != "rel-1.0" || l.Owner != "bob" || l.Description != "Release\n1.0" || l.Revision != "" ||
+		!reflect.DeepEqual(l.Options, []string{"locked", "noautoreload"}) ||
+		!reflect.DeepEqual(l.View, []string{"//depot/...", `"//depot/sp ace/..."`}) {
+		t.Errorf("%+v", l)
+	}
+
+	// Update from the form received: the fields not set are kept
+	l.Description = "Release 1.0 final"
+	l.Revision = "@2"
+	if _, err = p.UpdateLabel(l, false); err != nil {
+		t.Fatal(err)
+	}
+	if l, err = p.GetLabel("rel-1.0"); err != nil || l.Description != "Release 1.0 final" || l.Revision != "@2" || len(l.View) != 2 {
+		t.Errorf("%+v %v", l, err)
+	}
+
+	p.CreateLabel(perforce.T_LabelProperties{Label: "rel-2.0", Owner: "alice"})
+	labels, err := p.GetLabels(perforce.LabelFilter{Name: "REL-*", CaseInsensitive: true, Owner: "bob"})
+	if err != nil || len(labels) != 1 || labels[0].Label != "rel-1.0" || labels[0].Description != "Release 1.0 final" || len(labels[0].View) != 0 {
+		t.Fatalf("%+v %v", labels, err)
+	}
+	if l := labels[0]; l.Time.IsZero() || l.Time.Format("2006/01/02 15:04:05") != l.Update || l.Update != l.Access {
+		t.Errorf("update %q %v access %q", l.Update, l.Time, l.Access)
+	}
+	if cmd := lastCommand(srv); cmd != "labels -u bob -E REL-*" {
+		t.Errorf("%s", cmd)
+	}
+	if labels, _ = p.GetLabels(perforce.LabelFilter{Max: 1}); len(labels) != 1 {
+		t.Errorf("max: %+v", labels)
+	}
+
+	if err = p.DeleteLabel("rel-2.0", false); err != nil {
+		t.Fatal(err)
+	}
+	if labels, _ = p.GetLabels(perforce.LabelFilter{}); len(labels) != 1 {
+		t.Errorf("deleted: %+v", labels)
+	}
+	if err = p.DeleteLabel("rel-3.0", false); err == nil {
+		t.Errorf("unknown label: no error")
+	}
+}
+
+func TestTagAndLabelsync(t *testing.T) {
+	srv, p := newChangeServer(t)
+	srv.AddFile("//depot/a.txt", "text", "a\nb\n")
+	srv.AddFile("//depot/lib/c.txt", "text", "c\n")
+	srv.AddFile("//depot/d.txt", "text", "d\n")
+	if _, err := p.CreateLabel(perforce.T_LabelProperties{Label: "rel", View: []string{"//depot/..."}}); err != nil {
+		t.Fatal(err)
+	}
+	labelled := func() (files []string) {
+		res, err := p.GetP4FilesAt(perforce.FileSpec{Path: "//depot/...", Pattern: true, Rev: perforce.AtLabel("rel")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range res {
+			files = append(files, f.DepotfileLoc+"#"+strconv.Itoa(f.HeadRevision))
+		}
+		return files
+	}
+
+	res, err := p.Tag("rel", perforce.TagOptions{}, perforce.NewFileSpec("//depot/a.txt", perforce.RevNum(1)),
+		perforce.NewFileSpec("//depot/d.txt", perforce.RevSpec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []perforce.T_LabelFile{{DepotFile: "//depot/a.txt", Rev: 1, Action: "added"}, {DepotFile: "//depot/d.txt", Rev: 1, Action: "added"}}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("tag: %+v", res)
+	}
+	if cmd := lastCommand(srv); cmd != "tag -l rel //depot/a.txt#1 //depot/d.txt" {
+		t.Errorf("%s", cmd)
+	}
+
+	// Head revision: updated, then in sync
+	if res, err = p.Tag("rel", perforce.TagOptions{}, perforce.NewFileSpec("//depot/a.txt", perforce.HeadRev())); err != nil ||
+		len(res) != 1 || res[0].Rev != 2 || res[0].Action != "updated" {
+		t.Errorf("tag head: %+v %v", res, err)
+	}
+	if res, err = p.Tag("rel", perforce.TagOptions{}, perforce.NewFileSpec("//depot/a.txt", perforce.HeadRev())); err != nil || len(res) != 0 {
+		t.Errorf("in sync: %+v %v", res, err)
+	}
+	if _, err = p.Tag("rel", perforce.TagOptions{}); err == nil {
+		t.Errorf("tag without file: no error")
+	}
+
+	// Preview: the label is unchanged
+	if res, err = p.Labelsync("rel", perforce.TagOptions{Preview: true}, perforce.NewFileSpec("//depot/lib/c.txt", perforce.RevSpec{})); err != nil || len(res) != 3 {
+		t.Errorf("preview: %+v %v", res, err)
+	}
+	if files := labelled(); strings.Join(files, " ") != "//depot/a.txt#2 //depot/d.txt#1" {
+		t.Errorf("after preview: %v", files)
+	}
+
+	// Files not listed are removed from the label, unless added with -a
+	if res, err = p.Labelsync("rel", perforce.TagOptions{}, perforce.NewFileSpec("//depot/lib/c.txt", perforce.RevSpec{})); err != nil || len(res) != 3 {
+		t.Errorf("labelsync: %+v %v", res, err)
+	}
+	if files := labelled(); strings.Join(files, " ") != "//depot/lib/c.txt#1" {
+		t.Errorf("labelsync: %v", files)
+	}
+	if res, err = p.Labelsync("rel", perforce.TagOptions{Add: true}, perforce.NewFileSpec("//depot/a.txt", perforce.RevNum(1))); err != nil ||
+		!reflect.DeepEqual(res, []perforce.T_LabelFile{{DepotFile: "//depot/a.txt", Rev: 1, Action: "added"}}) {
+		t.Errorf("labelsync -a: %+v %v", res, err)
+	}
+	if res, err = p.Labelsync("rel", perforce.TagOptions{Delete: true}, perforce.NewFileSpec("//depot/lib/c.txt", perforce.RevSpec{})); err != nil ||
+		len(res) != 1 || res[0].Action != "deleted" {
+		t.Errorf("labelsync -d: %+v %v", res, err)
+	}
+	if files := labelled(); strings.Join(files, " ") != "//depot/a.txt#1" {
+		t.Errorf("labelsync -a -d: %v", files)
+	}
+	if _, err = p.Labelsync("rel", perforce.TagOptions{Add: true, Delete: true}); err == nil {
+		t.Errorf("-a and -d: no error")
+	}
+	if _, err = p.Labelsync("none", perforce.TagOptions{}, perforce.NewFileSpec("//depot/a.txt", perforce.RevSpec{})); err == nil {
+		t.Errorf("unknown label: no error")
+	}
+}
+
+// p4 -x runs labelsync per batch of 128 files by default: each batch would remove the
+// files of the previous ones from the label
+func TestLabelsyncManyFiles(t *testing.T) {
+	srv, p := newChangeServer(t)
+	if _, err := p.CreateLabel(perforce.T_LabelProperties{Label: "rel", View: []string{"//depot/..."}}); err != nil {
+		t.Fatal(err)
+	}
+	var files []perforce.FileSpec
+	for i := 0; i < 300; i++ {
+		path := "//depot/many/f" + strconv.Itoa(i) + ".txt"
+		srv.AddFile(path, "text", "x\n")
+		files = append(files, perforce.NewFileSpec(path, perforce.HeadRev()))
+	}
+
+	var events []perforce.CommandEvent
+	hooked := p.WithHooks(perforce.Hooks{AfterCommand: func(e *perforce.CommandEvent) { events = append(events, *e) }})
+	res, err := hooked.Labelsync("rel", perforce.TagOptions{}, files...)
+	if err != nil || len(res) != len(files) {
+		t.Fatalf("%d files labelled %v", len(res), err)
+	}
+	// Command after the batch size of -b
+	if len(events) != 1 || events[0].Command != "labelsync" {
+		t.Errorf("%+v", events)
+	}
+	labelled, err := p.GetP4FilesAt(perforce.FileSpec{Path: "//depot/...", Pattern: true, Rev: perforce.AtLabel("rel")})
+	if err != nil || len(labelled) != len(files) {
+		t.Errorf("%d files in the label %v", len(labelled), err)
+	}
+
+	// Added in chunks
+	p.SetBatchSize(100)
+	more := append(files, perforce.NewFileSpec("//depot/a.txt", perforce.RevSpec{}))
+	if res, err = p.Labelsync("rel", perforce.TagOptions{Add: true}, more...); err != nil || len(res) != 1 {
+		t.Errorf("%d files added %v", len(res), err)
+	}
+}
@@ -0,0 +1,109 @@
+package perforce
+
+// Locks on opened files: a locked file can't be submitted from another workspace.
+//
+//	locked, err := p4.Lock(cl, perforce.FileSpec{Path: "//depot/art/....psd", Pattern: true})
+//	...
+//	_, err = p4.Unlock(perforce.UnlockOptions{Changelist: cl})
+//
+// Files of an exclusive filetype (+l) can be opened in one workspace at a time;
+// see Fstat() and Opened() for the workspaces holding a file.
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// UnlockOptions - p4 unlock options
+type UnlockOptions struct {
+	Changelist int  // files of a pending changelist (-c), 0 for the files of the default changelist
+	Force      bool // unlock files locked by other users (-f), requires admin access
+	Orphaned   bool // unlock the orphaned locks of exclusive files (-x), requires admin access
+}
+
+// Outputs of p4 lock and p4 unlock
+var lockedPattern = regexp.MustCompile(`^(//[^#]*)(?:#[0-9]+)? - (?:locking|already locked)$`)
+var unlockedPattern = regexp.MustCompile(`^(//[^#]*)(?:#[0-9]+)? - unlocking$`)
+
+// Lock()
+//	Lock opened files: p4 lock [-c changelist] [file...]
+//	Long lists are split in batches (see SetBatchSize()).
+// 	Input:
+//		- changelist of the files, 0 for the default changelist
+//		- optional files, patterns allowed - all the files of the changelist if none
+//  Return:
+//		- files locked, the ones already locked by the workspace included
+//		- err code, nil if okay - error if a file couldn't be locked
+func (p *Perforce) Lock(changelist int, files ...FileSpec) (locked []string, err error) {
+	p.logThis(fmt.Sprintf("Lock(%d, %v)", changelist, files))
+
+	args := []string{"lock"}
+	if changelist > 0 {
+		args = append(args, "-c", strconv.Itoa(changelist))
+	}
+	return p.lock(args, lockedPattern, files)
+}
+
+// Unlock()
+//	Release locks: p4 unlock [-c changelist | -x] [-f] [file...]
+//	Long lists are split in batches (see SetBatchSize()).
+// 	Input:
+//		- options
+//		- optional files, patterns allowed - all the files of the changelist if none
+//  Return:
+//		- files unlocked
+//		- err code, nil if okay
+func (p *Perforce) Unlock(opts UnlockOptions, files ...FileSpec) (unlocked []string, err error) {
+	p.logThis(fmt.Sprintf("Unlock(%+v, %v)", opts, files))
+
+	args := []string{"unlock"}
+	switch {
+	case opts.Orphaned && opts.Changelist > 0:
+		return unlocked, fmt.Errorf("Unlock() - Orphaned locks aren't in a changelist: %d", opts.Changelist)
+	case opts.Orphaned:
+		args = append(args, "-x")
+	case opts.Changelist > 0:
+		args = append(args, "-c", strconv.Itoa(opts.Changelist))
+	}
+	if opts.Force {
+		args = append(args, "-f")
+	}
+	return p.lock(args, unlockedPattern, files)
+}
+
+func (p *Perforce) lock(args []string, pattern *regexp.Regexp, files []FileSpec) (res []string, err error) {
+	fileArgs := make([]string, len(files))
+	for i, f := range files {
+		if fileArgs[i], err = p.fileSpecArg(f); err != nil {
+			return res, err
+		}
+	}
+
+	out, err := p.execP4Files(args, fileArgs)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if err != nil {
+		return res, p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	var failed []string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if m := pattern.FindStringSubmatch(line); m != nil {
+			res = append(res, UnescapePath(m[1]))
+		} else if strings.HasPrefix(line, "//") {
+			failed = append(failed, line)
+		}
+	}
+	if len(failed) > 0 {
+		return res, p.errorf("Files not %sed: %s", args[0], strings.Join(failed, "; "))
+	}
+	if len(res) <= 0 {
+		return res, p.errorf("No file %sed. Received %s", args[0], out)
+	}
+
+	return res, nil
+}
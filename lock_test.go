@@ -0,0 +1,86 @@
+package perforce_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	perforce "github.com/fabdem/go-perforce"
+)
+
+// Locks seen from the workspace holding them and from another one
+func TestLocks(t *testing.T) {
+	srv, p := newChangeServer(t)
+	cl := srv.CreateChange("bob", "ws", "fix a")
+	if err := srv.Open("ws", "edit", "//depot/a.txt", cl); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.AddClient("ws2", t.TempDir(), "//depot/... //ws2/..."); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Open("ws2", "edit", "//depot/a.txt", 0); err != nil {
+		t.Fatal(err)
+	}
+	alice := srv.Perforce("alice", "ws2")
+	a := perforce.NewFileSpec("//depot/a.txt", perforce.RevSpec{})
+
+	if locked, err := p.Lock(cl); err != nil || strings.Join(locked, " ") != "//depot/a.txt" {
+		t.Fatalf("lock: %v %v", locked, err)
+	}
+	if locked, err := p.Lock(cl, a); err != nil || len(locked) != 1 {
+		t.Errorf("already locked by the workspace: %v %v", locked, err)
+	}
+	if _, err := alice.Lock(0, a); err == nil || !strings.Contains(err.Error(), "already locked by admin@ws") {
+		t.Errorf("locked in another workspace: %v", err)
+	}
+
+	// Locked is set for the workspace holding the lock only
+	opened, err := alice.Opened(perforce.OpenedFilter{AllClients: true}, a)
+	if err != nil || len(opened) != 2 {
+		t.Fatalf("%+v %v", opened, err)
+	}
+	for _, o := range opened {
+		if o.Locked {
+			t.Errorf("opened in %s, seen from ws2: locked", o.Client)
+		}
+	}
+	if opened, _ = p.Opened(perforce.OpenedFilter{}); len(opened) != 1 || !opened[0].Locked {
+		t.Errorf("seen from ws: %+v", opened)
+	}
+
+	// Numbered otherOpenN and otherLockN fields - the files are opened by admin when seeded
+	stat, err := alice.Fstat(a)
+	if err != nil || len(stat) != 1 {
+		t.Fatalf("%+v %v", stat, err)
+	}
+	ws := []perforce.T_FileHolder{{User: "admin", Client: "ws"}}
+	if s := stat[0]; s.OurLock || !reflect.DeepEqual(s.OpenedBy, ws) || !reflect.DeepEqual(s.LockedBy, ws) {
+		t.Errorf("seen from ws2: %+v", s)
+	}
+	stat, _ = p.Fstat(a)
+	ws2 := []perforce.T_FileHolder{{User: "admin", Client: "ws2"}}
+	if s := stat[0]; !s.OurLock || !reflect.DeepEqual(s.OpenedBy, ws2) || len(s.LockedBy) != 0 {
+		t.Errorf("seen from ws: %+v", stat[0])
+	}
+
+	if unlocked, err := p.Unlock(perforce.UnlockOptions{Changelist: cl}); err != nil || strings.Join(unlocked, " ") != "//depot/a.txt" {
+		t.Errorf("unlock: %v %v", unlocked, err)
+	}
+	if _, err := p.Unlock(perforce.UnlockOptions{Changelist: cl}); err == nil {
+		t.Errorf("unlock of files not locked: no error")
+	}
+
+	// Lock released by another user
+	p.Lock(cl)
+	if unlocked, err := alice.Unlock(perforce.UnlockOptions{Force: true}, a); err != nil || len(unlocked) != 1 {
+		t.Errorf("forced unlock: %v %v", unlocked, err)
+	}
+	if cmd := srv.Commands(); strings.Join(cmd[len(cmd)-1], " ") != "-u alice -c ws2 unlock -f //depot/a.txt" {
+		t.Errorf("%v", cmd[len(cmd)-1])
+	}
+
+	n := len(srv.Commands())
+	if _, err := p.Unlock(perforce.UnlockOptions{Orphaned: true, Changelist: cl}); err == nil || len(srv.Commands()) != n {
+		t.Errorf("orphaned locks of a changelist: %v", err)
+	}
+}
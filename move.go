@@ -0,0 +1,248 @@
+package perforce
+
+// Move - rename files keeping their history.
+//
+//	pairs, err := p4.Move(perforce.FileSpec{Path: "//depot/loc/fr/...", Pattern: true},
+//		perforce.FileSpec{Path: "//depot/loc/fr-FR/...", Pattern: true}, perforce.MoveOptions{Changelist: cl})
+//
+// The source files are opened for edit first if they aren't opened yet, and
+// reverted if the move fails. The target can't have a revision. They're submitted as move/delete (source) and
+// move/add (target) pairs.
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MoveOptions - p4 move options
+type MoveOptions struct {
+	Changelist    int    // changelist the files are opened in (-c), 0 for the default changelist
+	KeepWorkspace bool   // the workspace files aren't moved (-k)
+	Force         bool   // move to a target which already exists (-f), i.e. a deleted file
+	Preview       bool   // report the moves without doing them (-n) - the sources must be opened already
+	FileType      string // new filetype of the target (-t), unchanged if empty
+}
+
+// File moved: source and target depot paths
+type T_MovePair struct {
+	From string
+	To   string
+}
+
+// Output of p4 move
+var movedFromPattern = regexp.MustCompile(`(?m)^(//[^#\r\n]*)#(?:[0-9]+|none) - moved from (//[^#\r\n]*)#(?:[0-9]+|none)`)
+
+// Files opened by p4 edit - not the ones "currently opened for edit"
+var openedForEditPattern = regexp.MustCompile(`(?m)^(//[^#\r\n]*)#[0-9]+ - opened for edit`)
+
+// Move()
+//	Move (rename) a file or the files matching a pattern: p4 edit [-c changelist] of the
+//	sources not opened yet (p4 opened from) then p4 move [-c changelist] [-f] [-k] [-n] [-t filetype] from to
+// 	Input:
+//		- source and target, i.e. //depot/old/... and //depot/new/... - the wildcards must match,
+//		  the target without revision
+//		- options
+//  Return:
+//		- files moved, sorted by source
+//		- err code, nil if okay - the sources opened for edit by Move() are reverted
+func (p *Perforce) Move(from FileSpec, to FileSpec, opts MoveOptions) (pairs []T_MovePair, err error) {
+	p.logThis(fmt.Sprintf("Move(%s, %s, %+v)", from, to, opts))
+
+	if from.Pattern != to.Pattern {
+		return pairs, fmt.Errorf("Move() - Source and target must both be patterns or files: %s %s", from, to)
+	}
+	if to.Rev.Kind != RevUnspecified || to.From.Kind != RevUnspecified {
+		return pairs, fmt.Errorf("Move() - Target with a revision: %s", to)
+	}
+	fromArg, err := p.fileSpecArg(from)
+	if err != nil {
+		return pairs, err
+	}
+	toArg, err := p.fileSpecArg(to)
+	if err != nil {
+		return pairs, err
+	}
+
+	var cl []string
+	if opts.Changelist > 0 {
+		cl = []string{"-c", strconv.Itoa(opts.Changelist)}
+	}
+
+	// Source opened for edit - files already opened are left as is
+	var edited []string
+	if !opts.Preview {
+		if edited, err = p.editSources(from, fromArg, cl); err != nil {
+			return pairs, err
+		}
+	}
+
+	args := append([]string{"move"}, cl...)
+	if opts.Force {
+		args = append(args, "-f")
+	}
+	if opts.KeepWorkspace {
+		args = append(args, "-k")
+	}
+	if opts.Preview {
+		args = append(args, "-n")
+	}
+	if len(opts.FileType) > 0 {
+		args = append(args, "-t", opts.FileType)
+	}
+	out, err := p.execP4(nil, append(args, fromArg, toArg)...)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if err != nil {
+		return pairs, p.moveFailed(edited, p.errorf("P4 command line error %v  out=%s", err, out))
+	}
+
+	for _, m := range movedFromPattern.FindAllStringSubmatch(string(out), -1) {
+		pairs = append(pairs, T_MovePair{From: UnescapePath(m[2]), To: UnescapePath(m[1])})
+	}
+	if len(pairs) <= 0 {
+		return pairs, p.errorf("No file moved. Received %s", out)
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].From < pairs[j].From })
+
+	return pairs, nil
+}
+
+// Open for edit the sources of a move not opened yet: the source itself or
+// the files of the pattern not opened. Returns the files opened for edit.
+func (p *Perforce) editSources(from FileSpec, fromArg string, cl []string) (edited []string, err error) {
+	opened, err := p.Opened(OpenedFilter{}, from)
+	if err != nil {
+		return edited, err
+	}
+	fileArgs := []string{fromArg}
+	if len(opened) > 0 && !from.Pattern {
+		return edited, nil
+	} else if len(opened) > 0 {
+		isOpened := make(map[string]bool)
+		for _, o := range opened {
+			isOpened[o.DepotFile] = true
+		}
+		files, err := p.GetP4FilesAt(from)
+		if err != nil {
+			return edited, err
+		}
+		fileArgs = nil
+		for _, f := range files {
+			if !isOpened[f.DepotfileLoc] {
+				fileArgs = append(fileArgs, EscapePath(f.DepotfileLoc))
+			}
+		}
+		if len(fileArgs) <= 0 {
+			return edited, nil
+		}
+	}
+	out, err := p.execP4Files(append([]string{"edit"}, cl...), fileArgs)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	for _, m := range openedForEditPattern.FindAllStringSubmatch(string(out), -1) {
+		edited = append(edited, m[1])
+	}
+	if err != nil {
+		return edited, p.moveFailed(edited, p.errorf("P4 command line error %v  out=%s", err, out))
+	}
+	return edited, nil
+}
+
+// Revert the sources opened for edit by a move which failed
+func (p *Perforce) moveFailed(edited []string, err error) error {
+	if len(edited) <= 0 {
+		return err
+	}
+	out, rerr := p.execP4Files([]string{"revert"}, edited)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if rerr != nil {
+		return p.errorf("%v - the sources opened for edit couldn't be reverted: %v  out=%s", err, rerr, out)
+	}
+	return err
+}
+
+// Link from a move/add revision to its source in p4 filelog output:
+//	//depot/new/a.txt
+//	... #1 change 12 move/add on 2020/09/20 by bob@ws (text) 'rename'
+//	... ... moved from //depot/old/a.txt#3
+var filelogMovedFromPattern = regexp.MustCompile(`^\.\.\. \.\.\. moved from (//[^#\r\n]*)#`)
+
+// MovePairs()
+//	Pair the move/delete and move/add files of a changelist as returned by GetCLContent(),
+//	from the links recorded by the server: p4 opened -a -c changelist for a pending
+//	changelist (the files opened in the workspaces not visible can't be paired),
+//	p4 filelog -m 1 for a submitted one.
+// 	Return:
+//		- files moved, sorted by source
+//		- move/delete and move/add files which couldn't be paired, sorted
+//		- err code, nil if okay
+func (p *Perforce) MovePairs(properties T_CLProperties) (pairs []T_MovePair, unpaired []string, err error) {
+	p.logThis(fmt.Sprintf("MovePairs(%d)", properties.CLNb))
+
+	var added []string
+	for f, fp := range properties.List {
+		if fp.Action == "move/add" {
+			added = append(added, f)
+		}
+	}
+	sort.Strings(added)
+
+	sources := make(map[string]string) // target -> source
+	if len(added) > 0 && properties.Pending {
+		opened, err := p.Opened(OpenedFilter{AllClients: true, Changelist: properties.CLNb})
+		if err != nil {
+			return pairs, unpaired, err
+		}
+		for _, o := range opened {
+			if o.Action == "move/add" && len(o.MovedFile) > 0 {
+				sources[o.DepotFile] = o.MovedFile
+			}
+		}
+	} else if len(added) > 0 {
+		fileArgs := make([]string, len(added))
+		for i, f := range added {
+			fileArgs[i] = EscapePath(f) + "#" + strconv.Itoa(properties.List[f].Rev)
+		}
+		out, err := p.execP4Files([]string{"filelog", "-m", "1"}, fileArgs)
+
+		p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+		if err != nil {
+			return pairs, unpaired, p.errorf("P4 command line error %v  out=%s", err, out)
+		}
+		var target string
+		for _, line := range strings.Split(string(out), "\n") {
+			line = strings.TrimSuffix(line, "\r")
+			if strings.HasPrefix(line, "//") {
+				target = UnescapePath(line)
+			} else if m := filelogMovedFromPattern.FindStringSubmatch(line); m != nil && len(target) > 0 {
+				sources[target] = UnescapePath(m[1])
+			}
+		}
+	}
+
+	paired := make(map[string]bool)
+	for _, a := range added {
+		from, ok := sources[a]
+		if ok && properties.List[from].Action == "move/delete" && !paired[from] {
+			pairs = append(pairs, T_MovePair{From: from, To: a})
+			paired[from], paired[a] = true, true
+		}
+	}
+	for f, fp := range properties.List {
+		if (fp.Action == "move/add" || fp.Action == "move/delete") && !paired[f] {
+			unpaired = append(unpaired, f)
+		}
+	}
+	sort.Strings(unpaired)
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].From < pairs[j].From })
+
+	return pairs, unpaired, nil
+}
@@ -0,0 +1,193 @@
+package perforce_test
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	perforce "github.com/fabdem/go-perforce"
+)
+
+func TestMove(t *testing.T) {
+	srv, p := newChangeServer(t)
+	cl := srv.CreateChange("bob", "ws", "rename")
+
+	pairs, err := p.Move(perforce.NewFileSpec("//depot/a.txt", perforce.RevSpec{}), perforce.NewFileSpec("//depot/moved/a.txt", perforce.RevSpec{}),
+		perforce.MoveOptions{Changelist: cl})
+	if err != nil || !reflect.DeepEqual(pairs, []perforce.T_MovePair{{From: "//depot/a.txt", To: "//depot/moved/a.txt"}}) {
+		t.Fatalf("%+v %v", pairs, err)
+	}
+	if cmd := lastCommand(srv); cmd != "move -c "+strconv.Itoa(cl)+" //depot/a.txt //depot/moved/a.txt" {
+		t.Errorf("%s", cmd)
+	}
+	c, err := p.GetCLContent(cl)
+	if err != nil || len(c.List) != 2 || c.List["//depot/a.txt"].Action != "move/delete" || c.List["//depot/moved/a.txt"].Action != "move/add" {
+		t.Errorf("opened: %+v %v", c.List, err)
+	}
+
+	// Pattern: the wildcards of the source and the target match
+	srv.AddFile("//depot/lib/c.txt", "text", "c\n")
+	srv.AddFile("//depot/lib/d.txt", "text", "d\n")
+	srv.Sync("ws")
+	pairs, err = p.Move(perforce.FileSpec{Path: "//depot/lib/...", Pattern: true}, perforce.FileSpec{Path: "//depot/lib2/...", Pattern: true},
+		perforce.MoveOptions{KeepWorkspace: true})
+	want := []perforce.T_MovePair{{From: "//depot/lib/c.txt", To: "//depot/lib2/c.txt"}, {From: "//depot/lib/d.txt", To: "//depot/lib2/d.txt"}}
+	if err != nil || !reflect.DeepEqual(pairs, want) {
+		t.Errorf("pattern: %+v %v", pairs, err)
+	}
+	if cmd := lastCommand(srv); cmd != "move -k //depot/lib/... //depot/lib2/..." {
+		t.Errorf("%s", cmd)
+	}
+
+	if _, err = p.Move(perforce.FileSpec{Path: "//depot/lib/...", Pattern: true}, perforce.NewFileSpec("//depot/x.txt", perforce.RevSpec{}),
+		perforce.MoveOptions{}); err == nil {
+		t.Errorf("pattern to a file: no error")
+	}
+}
+
+// The sources already opened aren't opened for edit again
+func TestMoveOpenedSources(t *testing.T) {
+	srv, p := newChangeServer(t)
+	cl := srv.CreateChange("bob", "ws", "rename")
+	srv.Open("ws", "edit", "//depot/a.txt", cl)
+
+	pairs, err := p.Move(perforce.NewFileSpec("//depot/a.txt", perforce.RevSpec{}), perforce.NewFileSpec("//depot/moved/a.txt", perforce.RevSpec{}),
+		perforce.MoveOptions{Changelist: cl})
+	if err != nil || len(pairs) != 1 {
+		t.Fatalf("%+v %v", pairs, err)
+	}
+	if cmds := commandsOf(srv, "edit"); len(cmds) != 0 {
+		t.Errorf("edit of an opened source: %q", cmds)
+	}
+
+	// Pattern: the files not opened only
+	srv.AddFile("//depot/lib/c.txt", "text", "c\n")
+	srv.AddFile("//depot/lib/d@1.txt", "text", "d\n")
+	srv.Sync("ws")
+	srv.Open("ws", "edit", "//depot/lib/c.txt", cl)
+	pairs, err = p.Move(perforce.FileSpec{Path: "//depot/lib/...", Pattern: true}, perforce.FileSpec{Path: "//depot/lib2/...", Pattern: true},
+		perforce.MoveOptions{Changelist: cl})
+	if err != nil || len(pairs) != 2 {
+		t.Fatalf("pattern: %+v %v", pairs, err)
+	}
+	if cmds := commandsOf(srv, "edit"); len(cmds) != 1 || !strings.HasSuffix(cmds[0], " edit -c "+strconv.Itoa(cl)+" //depot/lib/d%401.txt") {
+		t.Errorf("pattern: %q", cmds)
+	}
+}
+
+// A target with a revision is rejected before running p4
+func TestMoveTargetRevision(t *testing.T) {
+	srv, p := newChangeServer(t)
+	from := perforce.NewFileSpec("//depot/a.txt", perforce.RevSpec{})
+	n := len(srv.Commands())
+
+	for _, to := range []perforce.FileSpec{
+		perforce.NewFileSpec("//depot/moved/a.txt", perforce.RevNum(1)),
+		{Path: "//depot/moved/a.txt", From: perforce.RevNum(1), Rev: perforce.HeadRev()},
+	} {
+		if _, err := p.Move(from, to, perforce.MoveOptions{}); err == nil {
+			t.Errorf("%s: no error", to)
+		}
+	}
+	if cmds := srv.Commands(); len(cmds) != n {
+		t.Errorf("%q", cmds[n:])
+	}
+}
+
+// Preview: the source must be opened already, nothing is opened
+func TestMovePreview(t *testing.T) {
+	srv, p := newChangeServer(t)
+	cl := srv.CreateChange("bob", "ws", "rename")
+	from, to := perforce.NewFileSpec("//depot/a.txt", perforce.RevSpec{}), perforce.NewFileSpec("//depot/new/a.txt", perforce.RevSpec{})
+
+	if _, err := p.Move(from, to, perforce.MoveOptions{Changelist: cl, Preview: true}); err == nil {
+		t.Errorf("source not opened: no error")
+	}
+	if cmds := commandsOf(srv, "edit"); len(cmds) != 0 {
+		t.Errorf("edit by a preview: %q", cmds)
+	}
+
+	srv.Open("ws", "edit", "//depot/a.txt", cl)
+	pairs, err := p.Move(from, to, perforce.MoveOptions{Changelist: cl, Preview: true})
+	if err != nil || !reflect.DeepEqual(pairs, []perforce.T_MovePair{{From: "//depot/a.txt", To: "//depot/new/a.txt"}}) {
+		t.Errorf("%+v %v", pairs, err)
+	}
+	if c, err := p.GetCLContent(cl); err != nil || !reflect.DeepEqual(c.List, map[string]perforce.T_CLFileProperties{"//depot/a.txt": {Rev: 1, Action: "edit"}}) {
+		t.Errorf("opened: %+v %v", c.List, err)
+	}
+}
+
+// The sources opened for edit by Move() are reverted when p4 move fails,
+// the ones opened before are left as is
+func TestMoveRollback(t *testing.T) {
+	srv, p := newChangeServer(t)
+	srv.Open("ws", "edit", "//depot/a.txt", 0)
+
+	srv.Fail("move", "//depot/moved/b@1.txt - can't move to an existing file\n", 1)
+	if _, err := p.Move(perforce.NewFileSpec("//depot/b@1.txt", perforce.RevSpec{}), perforce.NewFileSpec("//depot/moved/b@1.txt", perforce.RevSpec{}),
+		perforce.MoveOptions{}); err == nil {
+		t.Fatal("no error")
+	}
+	if cmd := lastCommand(srv); cmd != "revert //depot/b%401.txt" {
+		t.Errorf("%s", cmd)
+	}
+	if opened, err := p.Opened(perforce.OpenedFilter{}); err != nil || len(opened) != 1 || opened[0].DepotFile != "//depot/a.txt" {
+		t.Errorf("source left opened: %+v %v", opened, err)
+	}
+
+	srv.Fail("move", "//depot/moved/a.txt - can't move to an existing file\n", 1)
+	if _, err := p.Move(perforce.NewFileSpec("//depot/a.txt", perforce.RevSpec{}), perforce.NewFileSpec("//depot/moved/a.txt", perforce.RevSpec{}),
+		perforce.MoveOptions{}); err == nil {
+		t.Fatal("no error")
+	}
+	if cmds := commandsOf(srv, "revert"); len(cmds) != 1 {
+		t.Errorf("source opened before reverted: %q", cmds)
+	}
+	if opened, err := p.Opened(perforce.OpenedFilter{}); err != nil || len(opened) != 1 || opened[0].Action != "edit" {
+		t.Errorf("opened: %+v %v", opened, err)
+	}
+}
+
+func TestMovePairs(t *testing.T) {
+	srv, p := newChangeServer(t)
+	cl := srv.CreateChange("bob", "ws", "rename")
+	for _, f := range []string{"a.txt", "b@1.txt"} {
+		if _, err := p.Move(perforce.NewFileSpec("//depot/"+f, perforce.RevSpec{}), perforce.NewFileSpec("//depot/moved/"+f, perforce.RevSpec{}),
+			perforce.MoveOptions{Changelist: cl}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []perforce.T_MovePair{{From: "//depot/a.txt", To: "//depot/moved/a.txt"}, {From: "//depot/b@1.txt", To: "//depot/moved/b@1.txt"}}
+
+	// Pending: links of the opened files
+	c, err := p.GetCLContent(cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs, unpaired, err := p.MovePairs(c)
+	if err != nil || !reflect.DeepEqual(pairs, want) || len(unpaired) != 0 {
+		t.Errorf("pending: %+v %v %v", pairs, unpaired, err)
+	}
+
+	// Only one side of a move in the changelist
+	delete(c.List, "//depot/a.txt")
+	if pairs, unpaired, err = p.MovePairs(c); err != nil || len(pairs) != 1 || !reflect.DeepEqual(unpaired, []string{"//depot/moved/a.txt"}) {
+		t.Errorf("unpaired: %+v %v %v", pairs, unpaired, err)
+	}
+
+	// Submitted: links of the filelog
+	submitted, err := p.SubmitCL(cl, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err = p.GetCLContent(submitted); err != nil {
+		t.Fatal(err)
+	}
+	if pairs, unpaired, err = p.MovePairs(c); err != nil || !reflect.DeepEqual(pairs, want) || len(unpaired) != 0 {
+		t.Errorf("submitted: %+v %v %v", pairs, unpaired, err)
+	}
+	if cmd := lastCommand(srv); cmd != "filelog -m 1 //depot/moved/a.txt#1 //depot/moved/b%401.txt#1" {
+		t.Errorf("%s", cmd)
+	}
+}
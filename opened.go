@@ -0,0 +1,208 @@
+package perforce
+
+// Opened files and file status, with the locks held on them.
+//
+//	files, err := p4.Fstat(perforce.NewFileSpec("//depot/art/hero.psd", perforce.RevSpec{}))
+//	for _, l := range files[0].LockedBy {
+//		fmt.Printf("locked by %s on %s\n", l.User, l.Client)
+//	}
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// User and workspace holding a file (opened or locked)
+type T_FileHolder struct {
+	User   string
+	Client string
+}
+
+// OpenedFilter - files listed by Opened(). The criteria are combined (and).
+type OpenedFilter struct {
+	AllClients bool   // files opened in any workspace (-a), only in the current one otherwise
+	Changelist int    // files of a pending changelist (-c), -1 for the default changelist, 0 for any
+	User       string // files opened by a user (-u)
+	Client     string // files opened in a workspace (-C)
+	Max        int    // max number of files, 0 for no limit
+}
+
+// File opened in a workspace
+type T_OpenedFile struct {
+	DepotFile  string
+	ClientFile string // client syntax
+	Rev        int    // revision opened, 0 for an add
+	HaveRev    int
+	Action     string
+	Change     int // 0 for the default changelist
+	FileType   string
+	User       string
+	Client     string
+	Locked     bool   // locked by the workspace of the instance (p4 lock) - see Fstat() for the other locks
+	MovedFile  string // other side of a move/add or move/delete
+}
+
+// Status of a file as returned by p4 fstat
+type T_FstatFile struct {
+	DepotFile  string
+	ClientFile string // local path, empty if the file isn't mapped in the workspace
+	HeadRev    int
+	HeadAction string
+	HeadChange int
+	HeadType   string
+	HaveRev    int            // 0 if not synced
+	Action     string         // action of the file opened in the workspace, empty if not opened
+	Change     int            // changelist of the file opened, 0 for the default changelist
+	Type       string         // filetype of the file opened
+	OurLock    bool           // opened and locked in the workspace
+	OpenedBy   []T_FileHolder // other workspaces where the file is opened - the one holding an exclusive (+l) file
+	LockedBy   []T_FileHolder // other workspaces holding a lock on the file
+}
+
+// Messages of the files not opened (p4 opened) or which don't exist (p4 fstat)
+var notOpenedPattern = regexp.MustCompile(`not opened`)
+var missingFilePattern = regexp.MustCompile(`(?:no such file\(s\)|not in client view)\.$`)
+
+// Opened()
+//	List the opened files: p4 opened [-a] [-c changelist] [-u user] [-C client] [-m max] [file...]
+//	Long lists of files are split in batches (see SetBatchSize()).
+// 	Input:
+//		- filter
+//		- optional files (depot, client or local syntax), patterns allowed
+//  Return:
+//		- opened files - none if no file is opened
+//		- err code, nil if okay
+func (p *Perforce) Opened(filter OpenedFilter, files ...FileSpec) (opened []T_OpenedFile, err error) {
+	p.logThis(fmt.Sprintf("Opened(%+v, %v)", filter, files))
+
+	args := []string{"-ztag", "opened"}
+	if filter.AllClients {
+		args = append(args, "-a")
+	}
+	switch {
+	case filter.Changelist > 0:
+		args = append(args, "-c", strconv.Itoa(filter.Changelist))
+	case filter.Changelist < 0:
+		args = append(args, "-c", "default")
+	}
+	if len(filter.User) > 0 {
+		args = append(args, "-u", filter.User)
+	}
+	if len(filter.Client) > 0 {
+		args = append(args, "-C", filter.Client)
+	}
+	if filter.Max > 0 {
+		args = append(args, "-m", strconv.Itoa(filter.Max))
+	}
+	fileArgs := make([]string, len(files))
+	for i, f := range files {
+		if fileArgs[i], err = p.fileSpecArg(f); err != nil {
+			return opened, err
+		}
+	}
+
+	out, err := p.execP4Files(args, fileArgs)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	records, messages := parseZtag(out)
+	if err != nil && !allBenign(messages, notOpenedPattern) {
+		return opened, p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+	for _, r := range records {
+		if len(r["depotFile"]) <= 0 {
+			continue
+		}
+		f := T_OpenedFile{
+			DepotFile:  UnescapePath(r["depotFile"]),
+			ClientFile: r["clientFile"],
+			Action:     r["action"],
+			FileType:   r["type"],
+			User:       r["user"],
+			Client:     r["client"],
+		}
+		f.Rev, _ = strconv.Atoi(r["rev"])
+		f.HaveRev, _ = strconv.Atoi(r["haveRev"])
+		f.Change, _ = strconv.Atoi(r["change"]) // "default" -> 0
+		// otherLock: locked in another workspace, not necessarily by User
+		_, f.Locked = r["ourLock"]
+		if len(r["movedFile"]) > 0 {
+			f.MovedFile = UnescapePath(r["movedFile"])
+		}
+		opened = append(opened, f)
+	}
+	if filter.Max > 0 && len(opened) > filter.Max { // max applied to each batch
+		opened = opened[:filter.Max]
+	}
+
+	return opened, nil
+}
+
+// Fstat()
+//	Status of files, with the other workspaces where they're opened or locked:
+//	p4 fstat file...
+//	Long lists are split in batches (see SetBatchSize()).
+//	Files which don't exist are skipped.
+func (p *Perforce) Fstat(files ...FileSpec) (res []T_FstatFile, err error) {
+	p.logThis(fmt.Sprintf("Fstat(%v)", files))
+
+	if len(files) <= 0 {
+		return res, fmt.Errorf("Fstat() - No file specified")
+	}
+	args := make([]string, len(files))
+	for i, f := range files {
+		if args[i], err = p.fileSpecArg(f); err != nil {
+			return res, err
+		}
+	}
+
+	out, err := p.execP4Files([]string{"-ztag", "fstat"}, args)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	records, messages := parseZtag(out)
+	if err != nil && !allBenign(messages, missingFilePattern) {
+		return res, p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	for _, r := range records {
+		if len(r["depotFile"]) <= 0 {
+			continue
+		}
+		f := T_FstatFile{
+			DepotFile:  UnescapePath(r["depotFile"]),
+			ClientFile: r["clientFile"],
+			HeadAction: r["headAction"],
+			HeadType:   r["headType"],
+			Action:     r["action"],
+			Type:       r["type"],
+		}
+		f.HeadRev, _ = strconv.Atoi(r["headRev"])
+		f.HeadChange, _ = strconv.Atoi(r["headChange"])
+		f.HaveRev, _ = strconv.Atoi(r["haveRev"])
+		f.Change, _ = strconv.Atoi(r["change"])
+		_, f.OurLock = r["ourLock"]
+		f.OpenedBy = fileHolders(r, "otherOpen")
+		f.LockedBy = fileHolders(r, "otherLock")
+		res = append(res, f)
+	}
+
+	return res, nil
+}
+
+// Numbered user@client fields of fstat, i.e. otherOpen0, otherOpen1...
+func fileHolders(r map[string]string, field string) (holders []T_FileHolder) {
+	for i := 0; ; i++ {
+		v, ok := r[field+strconv.Itoa(i)]
+		if !ok {
+			return holders
+		}
+		h := T_FileHolder{User: v}
+		if j := strings.LastIndex(v, "@"); j >= 0 {
+			h.User, h.Client = v[:j], v[j+1:]
+		}
+		holders = append(holders, h)
+	}
+}
@@ -6,13 +6,28 @@ package perforce
 //
 //
 //   Limitation: timeouts not managed (relies on p4 cli implementation)
+//
+//   Concurrency: an instance can be shared between goroutines as long as its
+//   configuration isn't modified with the Set...() functions. Use the With...()
+//   functions instead: they return a derived instance and leave the original untouched.
 
 // New()                create an instance/workspace
+// NewWithRunner()      create an instance running p4 commands through a Runner (i.e. a fake server)
+// WithUser()           derive an instance using another user
+// WithWorkspace()      derive an instance using another workspace
+// WithOptions()        derive an instance with other options
+// WithLogger()         derive an instance logging to a slog logger
+// WithHooks()          derive an instance calling hooks around each p4 invocation
+// WithRedactPolicy()   derive an instance masking other data in traces and errors
+// WithRetryPolicy()    derive an instance retrying the commands failing with a transient error
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"os/exec"
 	"time"
 )
@@ -24,6 +39,42 @@ type Perforce struct {
 	logWriter       io.Writer
 	debug           bool
 	diffignorespace bool // when set diff ignore spaces and eol
+	batchSize       int  // max number of files per p4 call, 0 for default
+	runner          Runner
+	logger          *slog.Logger // optional structured logger
+	hooks           Hooks        // optional functions called around each p4 invocation
+	redactPolicy    RedactPolicy // what is masked in traces and errors
+	retryPolicy     RetryPolicy  // how transient errors are retried
+	cache           *serverCache // data about the server, shared with the derived instances
+}
+
+// Runner - runs p4 command lines.
+//	Args don't include the p4 command itself, i.e. ["-u", "user", "-c", "ws", "files", "-e", "//depot/..."]
+//	Stdin may be nil.
+//	Returns standard output, standard error and exit code of the command.
+//	err is only set if the command couldn't be run at all.
+type Runner interface {
+	Run(args []string, stdin io.Reader) (stdout []byte, stderr []byte, exitCode int, err error)
+}
+
+// Default runner: executes the p4 command line client
+type execRunner struct {
+	p4Cmd string
+}
+
+func (r *execRunner) Run(args []string, stdin io.Reader) (stdout []byte, stderr []byte, exitCode int, err error) {
+	var outBuf, errBuf bytes.Buffer
+	cmd := exec.Command(r.p4Cmd, args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+	err = cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return outBuf.Bytes(), errBuf.Bytes(), exitErr.ExitCode(), nil
+	}
+	return outBuf.Bytes(), errBuf.Bytes(), 0, err
 }
 
 // Create a new instance
@@ -40,16 +91,93 @@ func New(user string, workspace string) (*Perforce, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Unable to find path to p4 command - %v", err)
 	}
+	p.runner = &execRunner{p4Cmd: p.p4Cmd}
+	p.cache = &serverCache{}
 	p.debug = false // default
 	return p, nil
 }
 
+// Create a new instance running the p4 commands through a runner
+// - no p4 command needed, i.e. for tests with a fake server
+// - Returns instance
+func NewWithRunner(user string, workspace string, runner Runner) *Perforce {
+	return &Perforce{user: user, workspace: workspace, runner: runner, cache: &serverCache{}}
+}
+
+// Options - configuration of an instance
+type Options struct {
+	DiffIgnoreSpace bool         // diff ignore spaces and eol
+	BatchSize       int          // max number of files per p4 call, 0 for default
+	Debug           bool         // traces
+	LogWriter       io.Writer    // where traces go, nil for the standard logger
+	Logger          *slog.Logger // structured logger, see WithLogger()
+	Hooks           Hooks        // see WithHooks()
+	Redact          RedactPolicy // see WithRedactPolicy()
+	Retry           RetryPolicy  // see WithRetryPolicy()
+}
+
+// WithUser()
+//	Returns a copy of the instance using another user.
+func (p *Perforce) WithUser(user string) *Perforce {
+	c := *p
+	c.user = user
+	return &c
+}
+
+// WithWorkspace()
+//	Returns a copy of the instance using another workspace.
+func (p *Perforce) WithWorkspace(workspace string) *Perforce {
+	c := *p
+	c.workspace = workspace
+	return &c
+}
+
+// WithOptions()
+//	Returns a copy of the instance with other options.
+//	Start from GetOptions() to change only some of them.
+func (p *Perforce) WithOptions(options Options) *Perforce {
+	c := *p
+	c.diffignorespace = options.DiffIgnoreSpace
+	c.batchSize = options.BatchSize
+	c.debug = options.Debug
+	c.logWriter = options.LogWriter
+	c.logger = options.Logger
+	c.hooks = options.Hooks
+	c.redactPolicy = options.Redact
+	c.retryPolicy = options.Retry
+	return &c
+}
+
+// WithRunner()
+//	Returns a copy of the instance running the p4 commands through another runner.
+func (p *Perforce) WithRunner(runner Runner) *Perforce {
+	c := *p
+	c.runner = runner
+	return &c
+}
+
+// GetOptions()
+func (p *Perforce) GetOptions() (options Options) {
+	return Options{
+		DiffIgnoreSpace: p.diffignorespace,
+		BatchSize:       p.batchSize,
+		Debug:           p.debug,
+		LogWriter:       p.logWriter,
+		Logger:          p.logger,
+		Hooks:           p.hooks,
+		Redact:          p.redactPolicy,
+		Retry:           p.retryPolicy,
+	}
+}
+
 // SetUser()
+//	Not safe if the instance is shared between goroutines - see WithUser()
 func (p *Perforce) SetUser(user string) {
 	p.user = user
 }
 
 // SetWorkspace()
+//	Not safe if the instance is shared between goroutines - see WithWorkspace()
 func (p *Perforce) SetWorkspace(workspace string) {
 	p.workspace = workspace
 }
@@ -65,11 +193,14 @@ func (p *Perforce) GetWorkspace() (workspace string) {
 }
 
 // SetDiffIgnoreSpace()
+//	Not safe if the instance is shared between goroutines - see WithOptions()
+//	or DiffHRvsWSWithOptions() for a single diff.
 func (p *Perforce) SetDiffIgnoreSpace() {
 	p.diffignorespace = true
 }
 
-// SetDiffIgnoreSpace()
+// ResetDiffIgnoreSpace()
+//	Not safe if the instance is shared between goroutines - see WithOptions()
 func (p *Perforce) ResetDiffIgnoreSpace() {
 	p.diffignorespace = false
 }
@@ -79,6 +210,65 @@ func (p *Perforce) GetDiffIgnoreSpace() (flag bool) {
 	return (p.diffignorespace)
 }
 
+// execP4()
+//	Run a p4 command. User and workspace global options are added when defined.
+//	If stdin isn't nil it's fed to the command (i.e. spec for a -i command).
+//	Transient errors are retried according to the retry policy.
+//	Returns the combined output: standard output followed by standard error.
+func (p *Perforce) execP4(stdin io.Reader, args ...string) (out []byte, err error) {
+	var gargs []string
+	if len(p.user) > 0 {
+		gargs = append(gargs, "-u", p.user)
+	}
+	if len(p.workspace) > 0 {
+		gargs = append(gargs, "-c", p.workspace)
+	}
+	cmdLine := append(gargs, args...)
+
+	if !p.retryPolicy.retries(cmdLine) {
+		return p.runP4(stdin, cmdLine)
+	}
+
+	// Transient errors are retried - stdin is fed again to each attempt
+	var in []byte
+	if stdin != nil {
+		if in, err = io.ReadAll(stdin); err != nil {
+			return nil, err
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		if in != nil {
+			stdin = bytes.NewReader(in)
+		}
+		out, err = p.runP4(stdin, cmdLine)
+		if err == nil || attempt >= p.retryPolicy.MaxAttempts || !p.retryPolicy.retryable(out, err) {
+			return out, err
+		}
+		delay := p.retryPolicy.delay(attempt)
+		p.logThis(fmt.Sprintf("	transient error, attempt %d/%d failed - retry in %v: %s", attempt, p.retryPolicy.MaxAttempts, delay, out))
+		time.Sleep(delay)
+	}
+}
+
+// Single p4 invocation, traced
+func (p *Perforce) runP4(stdin io.Reader, cmdLine []string) (out []byte, err error) {
+	event := newCommandEvent(cmdLine)
+	event.Args = p.redactArgs(cmdLine)
+	if p.hooks.BeforeCommand != nil {
+		p.hooks.BeforeCommand(event)
+	}
+	defer p.traceCommand(event)
+
+	stdout, stderr, exitCode, err := p.runner.Run(cmdLine, stdin)
+	out = append(stdout, stderr...)
+	event.ExitCode, event.BytesOut = exitCode, len(out)
+	if err == nil && exitCode != 0 {
+		err = fmt.Errorf("exit status %d", exitCode)
+	}
+	event.Err = err
+	return out, err
+}
+
 // ---------------------------------------
 // Debug functions
 
@@ -86,14 +276,15 @@ func (p *Perforce) GetDiffIgnoreSpace() (flag bool) {
 // 	Execute p4 info command - recommended to check connection to server
 func (p *Perforce) P4Info() (output string, err error) {
 	p.logThis("\nP4Info()")
-	out, err := exec.Command(p.p4Cmd, "info").CombinedOutput()
+	out, err := p.execP4(nil, "info")
 	if err != nil {
-		return "", fmt.Errorf("\"p4 info\" exec error: %v %s", err, out)
+		return "", p.errorf("\"p4 info\" exec error: %v %s", err, out)
 	}
 	return string(out), nil
 }
 
 // SetDebug - traces errors if it's set to true.
+//	Not safe if the instance is shared between goroutines - see WithOptions()
 func (p *Perforce) SetDebug(debug bool, logWriter io.Writer) {
 	p.debug = debug
 	p.logWriter = logWriter
@@ -101,13 +292,19 @@ func (p *Perforce) SetDebug(debug bool, logWriter io.Writer) {
 
 // Log writer
 func (p *Perforce) logThis(a interface{}) {
+	if p.logger != nil {
+		if p.logger.Enabled(context.Background(), slog.LevelDebug) {
+			p.logger.Debug(p.Redact(fmt.Sprint(a)))
+		}
+		return
+	}
 	if p.debug {
 		if p.logWriter != nil {
 			timestamp := time.Now().Format(time.RFC3339)
-			msg := fmt.Sprintf("%v: %v", timestamp, a)
+			msg := fmt.Sprintf("%v: %v", timestamp, p.Redact(fmt.Sprint(a)))
 			fmt.Fprintln(p.logWriter, msg)
 		} else {
-			log.Println("p4", a)
+			log.Println("p4", p.Redact(fmt.Sprint(a)))
 		}
 	}
 }
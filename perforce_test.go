@@ -0,0 +1,149 @@
+package perforce_test
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	perforce "github.com/fabdem/go-perforce"
+	"github.com/fabdem/go-perforce/perforcetest"
+)
+
+// Instances derived with the With...() functions from one shared instance,
+// used concurrently against one server. Run with go test -race.
+func TestDerivedInstancesConcurrently(t *testing.T) {
+	srv := perforcetest.NewServer()
+	roots := map[string]string{"ws1": t.TempDir(), "ws2": t.TempDir()}
+	for ws, root := range roots {
+		if err := srv.AddClient(ws, root, "//depot/... //"+ws+"/..."); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv.AddFile("//depot/a.txt", "text", "a b\nc\n")
+	srv.AddFile("//depot/b.txt", "text", "b\n")
+	for ws, root := range roots {
+		if err := srv.Sync(ws); err != nil {
+			t.Fatal(err)
+		}
+		if err := srv.Open(ws, "edit", "//depot/a.txt", 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("a  b\nc\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := srv.Perforce("bob", "ws1")
+	var commands int64
+	hooks := perforce.Hooks{AfterCommand: func(e *perforce.CommandEvent) { atomic.AddInt64(&commands, 1) }}
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&lockedWriter{w: &logs}, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ws := fmt.Sprintf("ws%d", i%2+1)
+			q := p.WithWorkspace(ws).WithUser(fmt.Sprintf("user%d", i)).WithHooks(hooks)
+			switch i % 4 {
+			case 0:
+				q = q.WithOptions(perforce.Options{BatchSize: 1 + i%3})
+			case 1:
+				q = q.WithLogger(logger)
+			case 2:
+				q = q.WithRedactPolicy(perforce.RedactPolicy{Descriptions: true})
+			case 3:
+				q = q.WithRetryPolicy(perforce.RetryPolicy{MaxAttempts: 2, InitialDelay: time.Millisecond})
+			}
+
+			opts := q.GetDiffOptions()
+			opts.IgnoreSpace = i%2 == 0
+			diff, err := q.DiffHRvsWSWithOptions("p4", "//depot/a.txt", opts)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if (diff.ChangedLines == 0) != opts.IgnoreSpace {
+				t.Errorf("%d: ignore space %t: %+v", i, opts.IgnoreSpace, diff)
+			}
+			local, err := q.GetP4Where("//depot/b.txt")
+			if err != nil || local != filepath.Join(roots[ws], "b.txt") {
+				t.Errorf("%d: %s %s %v", i, ws, local, err)
+			}
+			if files, err := q.GetP4FilesAt(perforce.NewFileSpec("//depot/a.txt", perforce.RevSpec{}), perforce.NewFileSpec("//depot/b.txt", perforce.RevSpec{})); err != nil || len(files) != 2 {
+				t.Errorf("%d: %+v %v", i, files, err)
+			}
+			if info, err := q.GetServerInfo(); err != nil || info.ServerVersion == "" {
+				t.Errorf("%d: %+v %v", i, info, err)
+			}
+			if opened, err := q.Opened(perforce.OpenedFilter{}); err != nil || len(opened) != 1 {
+				t.Errorf("%d: %+v %v", i, opened, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if p.GetUser() != "bob" || p.GetWorkspace() != "ws1" || p.GetDiffIgnoreSpace() || p.GetBatchSize() != 5000 {
+		t.Errorf("shared instance modified: %s %s %t %d", p.GetUser(), p.GetWorkspace(), p.GetDiffIgnoreSpace(), p.GetBatchSize())
+	}
+	if atomic.LoadInt64(&commands) <= 0 {
+		t.Errorf("hooks not called")
+	}
+}
+
+// Writer shared by the goroutines of a test
+type lockedWriter struct {
+	mu sync.Mutex
+	w  *bytes.Buffer
+}
+
+func (l *lockedWriter) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(b)
+}
+
+// Setters of an instance, instances derived from it aren't modified
+func TestSettings(t *testing.T) {
+	srv := perforcetest.NewServer()
+	srv.AddClient("ws", t.TempDir(), "//depot/... //ws/...")
+	srv.AddFile("//depot/a.txt", "text", "a\n")
+	p := perforce.NewWithRunner("bob", "ws", nil)
+
+	p.SetRunner(srv)
+	if p.GetRunner() != perforce.Runner(srv) {
+		t.Errorf("runner not set")
+	}
+	p.SetBatchSize(2)
+	p.SetDiffIgnoreSpace()
+	if p.GetBatchSize() != 2 || p.GetOptions().BatchSize != 2 || !p.GetDiffIgnoreSpace() || !p.GetDiffOptions().IgnoreSpace {
+		t.Errorf("%+v %+v", p.GetOptions(), p.GetDiffOptions())
+	}
+	p.ResetDiffIgnoreSpace()
+	if p.GetDiffIgnoreSpace() {
+		t.Errorf("ignore space not reset")
+	}
+
+	var logs bytes.Buffer
+	p.SetDebug(true, &logs)
+	if _, err := p.GetP4Where("//depot/a.txt"); err != nil || !bytes.Contains(logs.Bytes(), []byte("GetP4Where(//depot/a.txt)")) {
+		t.Errorf("debug log: %v %q", err, logs.String())
+	}
+	p.SetDebug(false, nil)
+
+	q := p.WithUser("al").WithWorkspace("other").WithOptions(perforce.Options{BatchSize: 7})
+	p.SetUser("carl")
+	if q.GetUser() != "al" || q.GetWorkspace() != "other" || q.GetBatchSize() != 7 || q.GetRunner() != perforce.Runner(srv) {
+		t.Errorf("derived instance: %s %s %d", q.GetUser(), q.GetWorkspace(), q.GetBatchSize())
+	}
+	if p.GetUser() != "carl" || p.GetWorkspace() != "ws" || p.GetBatchSize() != 2 {
+		t.Errorf("instance: %s %s %d", p.GetUser(), p.GetWorkspace(), p.GetBatchSize())
+	}
+}
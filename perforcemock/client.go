@@ -0,0 +1,705 @@
+// Package perforcemock provides a mock of the perforce API for consumers' tests.
+//
+// Client implements perforce.Client (and so each of the FileQuerier, ChangelistManager,
+// WorkspaceManager, StreamManager, LabelManager, BranchManager, JobManager, Reconciler,
+// FileManager and Differ interfaces). Every call is recorded; the value returned is the one of the matching
+// <Method>Func field if set, zero values otherwise.
+//
+//	m := &perforcemock.Client{
+//		GetCLContentFunc: func(changeList int) (perforce.T_CLProperties, error) {
+//			return perforce.T_CLProperties{CLNb: changeList, Pending: true}, nil
+//		},
+//	}
+//	res, _ := service(m).Run()
+//	calls := m.CallsTo("GetCLContent")
+package perforcemock
+
+import (
+	"sync"
+
+	perforce "github.com/fabdem/go-perforce"
+)
+
+// Call - a recorded call
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Client - mock of perforce.Client
+type Client struct {
+	GetP4WhereFunc                 func(string) (string, error)
+	WhereManyFunc                  func([]string) ([]perforce.T_WhereProperties, error)
+	GetFileFunc                    func(string, int) (string, string, error)
+	GetFileAtFunc                  func(perforce.FileSpec) (string, string, error)
+	GetP4FilesFunc                 func(string) ([]perforce.T_FilesProperties, error)
+	GetP4FilesAtFunc               func(...perforce.FileSpec) ([]perforce.T_FilesProperties, error)
+	GetHeadRevFunc                 func(string) (int, error)
+	CheckFileExitsInDepotFunc      func(string) (bool, error)
+	GetFileInDepotPropertiesFunc   func(string) (perforce.T_FileProperties, error)
+	GetFileInDepotPropertiesAtFunc func(perforce.FileSpec) (perforce.T_FileProperties, error)
+	AnnotateFunc                   func(file perforce.FileSpec, opts perforce.AnnotateOptions) (perforce.T_AnnotateRes, error)
+	OpenedFunc                     func(perforce.OpenedFilter, ...perforce.FileSpec) ([]perforce.T_OpenedFile, error)
+	FstatFunc                      func(...perforce.FileSpec) ([]perforce.T_FstatFile, error)
+	GetCLContentFunc               func(int) (perforce.T_CLProperties, error)
+	GetPendingCLContentFunc        func(int) (map[string]int, string, string, error)
+	GetCLSpecPropertiesFunc        func(int) (perforce.T_CLSpecProperties, error)
+	PutCLSpecPropertiesFunc        func(perforce.T_CLSpecProperties) (int, error)
+	UpdateCLFunc                   func(int, string) error
+	DeleteCLFunc                   func(int) error
+	ReopenFunc                     func(int, string, ...string) ([]string, error)
+	SubmitCLFunc                   func(int, string) (int, error)
+	SubmitFunc                     func(perforce.SubmitOptions) (perforce.T_SubmitRes, error)
+	GetWorkspacePropertiesFunc     func(string) (perforce.T_WSProperties, error)
+	GetViewMapFunc                 func(string) (*perforce.ViewMap, error)
+	GetSpecFunc                    func(string, string) (*perforce.Spec, error)
+	PutSpecFunc                    func(string, *perforce.Spec, ...string) (string, error)
+	GetStreamsFunc                 func(perforce.StreamFilter) ([]perforce.T_StreamProperties, error)
+	GetStreamFunc                  func(string) (perforce.T_StreamProperties, error)
+	PutStreamFunc                  func(perforce.T_StreamProperties) (string, error)
+	SwitchStreamFunc               func(string) error
+	GetStreamStatusFunc            func(string) (perforce.T_StreamStatus, error)
+	CopyUpFunc                     func(string, int, bool) ([]perforce.T_IntegratedFile, error)
+	MergeDownFunc                  func(string, int, bool) ([]perforce.T_IntegratedFile, error)
+	GetLabelsFunc                  func(perforce.LabelFilter) ([]perforce.T_LabelProperties, error)
+	GetLabelFunc                   func(string) (perforce.T_LabelProperties, error)
+	CreateLabelFunc                func(perforce.T_LabelProperties) (string, error)
+	UpdateLabelFunc                func(perforce.T_LabelProperties, bool) (string, error)
+	DeleteLabelFunc                func(string, bool) error
+	TagFunc                        func(string, perforce.TagOptions, ...perforce.FileSpec) ([]perforce.T_LabelFile, error)
+	LabelsyncFunc                  func(string, perforce.TagOptions, ...perforce.FileSpec) ([]perforce.T_LabelFile, error)
+	GetBranchesFunc                func(perforce.BranchFilter) ([]perforce.T_BranchProperties, error)
+	GetBranchFunc                  func(string) (perforce.T_BranchProperties, error)
+	PutBranchFunc                  func(perforce.T_BranchProperties, bool) (string, error)
+	DeleteBranchFunc               func(string, bool) error
+	InterchangesFunc               func(string, bool, ...perforce.FileSpec) ([]perforce.T_ChangeSummary, error)
+	GetJobSpecFunc                 func() (perforce.T_JobSpec, error)
+	GetJobsFunc                    func(perforce.JobFilter) ([]perforce.T_JobProperties, error)
+	GetJobFunc                     func(string) (perforce.T_JobProperties, error)
+	PutJobFunc                     func(perforce.T_JobProperties) (string, error)
+	FixFunc                        func(int, string, ...string) error
+	UnfixFunc                      func(int, ...string) error
+	ReconcileFunc                  func(perforce.ReconcileOptions, ...perforce.FileSpec) ([]perforce.T_ReconcileFile, error)
+	StatusFunc                     func(perforce.ReconcileOptions, ...perforce.FileSpec) ([]perforce.T_ReconcileFile, error)
+	MoveFunc                       func(perforce.FileSpec, perforce.FileSpec, perforce.MoveOptions) ([]perforce.T_MovePair, error)
+	MovePairsFunc                  func(perforce.T_CLProperties) ([]perforce.T_MovePair, []string, error)
+	LockFunc                       func(int, ...perforce.FileSpec) ([]string, error)
+	UnlockFunc                     func(perforce.UnlockOptions, ...perforce.FileSpec) ([]string, error)
+	DiffHRvsWSFunc                 func(string, string) (perforce.T_DiffRes, error)
+	DiffHRvsWSWithOptionsFunc      func(string, string, perforce.DiffOptions) (perforce.T_DiffRes, error)
+	DiffHRvsWSFilesFunc            func(string, []string) ([]perforce.T_DiffRes, error)
+	DiffChangelistFunc             func(string, int) ([]perforce.T_DiffRes, error)
+	P4InfoFunc                     func() (string, error)
+	GetServerInfoFunc              func() (perforce.ServerInfo, error)
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+var _ perforce.Client = (*Client)(nil)
+
+// Calls()
+//	Returns all the calls recorded, in order.
+func (m *Client) Calls() (calls []Call) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append(calls, m.calls...)
+}
+
+// CallsTo()
+//	Returns the calls recorded to a method, in order.
+func (m *Client) CallsTo(method string) (calls []Call) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, c := range m.calls {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset()
+//	Forget the calls recorded.
+func (m *Client) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = nil
+}
+
+func (m *Client) record(method string, args ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, Call{Method: method, Args: args})
+}
+
+// GetP4Where()
+func (m *Client) GetP4Where(depotFile string) (fileName string, err error) {
+	m.record("GetP4Where", depotFile)
+	if m.GetP4WhereFunc != nil {
+		return m.GetP4WhereFunc(depotFile)
+	}
+	return fileName, err
+}
+
+// WhereMany()
+func (m *Client) WhereMany(files []string) (res []perforce.T_WhereProperties, err error) {
+	m.record("WhereMany", files)
+	if m.WhereManyFunc != nil {
+		return m.WhereManyFunc(files)
+	}
+	return res, err
+}
+
+// GetFile()
+func (m *Client) GetFile(depotFile string, rev int) (tempFile string, fileName string, err error) {
+	m.record("GetFile", depotFile, rev)
+	if m.GetFileFunc != nil {
+		return m.GetFileFunc(depotFile, rev)
+	}
+	return tempFile, fileName, err
+}
+
+// GetFileAt()
+func (m *Client) GetFileAt(file perforce.FileSpec) (tempFile string, fileName string, err error) {
+	m.record("GetFileAt", file)
+	if m.GetFileAtFunc != nil {
+		return m.GetFileAtFunc(file)
+	}
+	return tempFile, fileName, err
+}
+
+// GetP4Files()
+func (m *Client) GetP4Files(depotFilePattern string) (properties []perforce.T_FilesProperties, err error) {
+	m.record("GetP4Files", depotFilePattern)
+	if m.GetP4FilesFunc != nil {
+		return m.GetP4FilesFunc(depotFilePattern)
+	}
+	return properties, err
+}
+
+// GetP4FilesAt()
+func (m *Client) GetP4FilesAt(files ...perforce.FileSpec) (properties []perforce.T_FilesProperties, err error) {
+	m.record("GetP4FilesAt", files)
+	if m.GetP4FilesAtFunc != nil {
+		return m.GetP4FilesAtFunc(files...)
+	}
+	return properties, err
+}
+
+// GetHeadRev()
+func (m *Client) GetHeadRev(depotFileName string) (rev int, err error) {
+	m.record("GetHeadRev", depotFileName)
+	if m.GetHeadRevFunc != nil {
+		return m.GetHeadRevFunc(depotFileName)
+	}
+	return rev, err
+}
+
+// CheckFileExitsInDepot()
+func (m *Client) CheckFileExitsInDepot(depotFileName string) (exists bool, err error) {
+	m.record("CheckFileExitsInDepot", depotFileName)
+	if m.CheckFileExitsInDepotFunc != nil {
+		return m.CheckFileExitsInDepotFunc(depotFileName)
+	}
+	return exists, err
+}
+
+// GetFileInDepotProperties()
+func (m *Client) GetFileInDepotProperties(FileInDepot string) (properties perforce.T_FileProperties, err error) {
+	m.record("GetFileInDepotProperties", FileInDepot)
+	if m.GetFileInDepotPropertiesFunc != nil {
+		return m.GetFileInDepotPropertiesFunc(FileInDepot)
+	}
+	return properties, err
+}
+
+// GetFileInDepotPropertiesAt()
+func (m *Client) GetFileInDepotPropertiesAt(file perforce.FileSpec) (properties perforce.T_FileProperties, err error) {
+	m.record("GetFileInDepotPropertiesAt", file)
+	if m.GetFileInDepotPropertiesAtFunc != nil {
+		return m.GetFileInDepotPropertiesAtFunc(file)
+	}
+	return properties, err
+}
+
+// Annotate()
+func (m *Client) Annotate(file perforce.FileSpec, opts perforce.AnnotateOptions) (res perforce.T_AnnotateRes, err error) {
+	m.record("Annotate", file, opts)
+	if m.AnnotateFunc != nil {
+		return m.AnnotateFunc(file, opts)
+	}
+	return res, err
+}
+
+// Opened()
+func (m *Client) Opened(filter perforce.OpenedFilter, files ...perforce.FileSpec) (opened []perforce.T_OpenedFile, err error) {
+	m.record("Opened", filter, files)
+	if m.OpenedFunc != nil {
+		return m.OpenedFunc(filter, files...)
+	}
+	return opened, err
+}
+
+// Fstat()
+func (m *Client) Fstat(files ...perforce.FileSpec) (res []perforce.T_FstatFile, err error) {
+	m.record("Fstat", files)
+	if m.FstatFunc != nil {
+		return m.FstatFunc(files...)
+	}
+	return res, err
+}
+
+// GetCLContent()
+func (m *Client) GetCLContent(changeList int) (properties perforce.T_CLProperties, err error) {
+	m.record("GetCLContent", changeList)
+	if m.GetCLContentFunc != nil {
+		return m.GetCLContentFunc(changeList)
+	}
+	return properties, err
+}
+
+// GetPendingCLContent()
+func (m *Client) GetPendingCLContent(changeList int) (m_files map[string]int, user string, workspace string, err error) {
+	m.record("GetPendingCLContent", changeList)
+	if m.GetPendingCLContentFunc != nil {
+		return m.GetPendingCLContentFunc(changeList)
+	}
+	return m_files, user, workspace, err
+}
+
+// GetCLSpecProperties()
+func (m *Client) GetCLSpecProperties(cl int) (properties perforce.T_CLSpecProperties, err error) {
+	m.record("GetCLSpecProperties", cl)
+	if m.GetCLSpecPropertiesFunc != nil {
+		return m.GetCLSpecPropertiesFunc(cl)
+	}
+	return properties, err
+}
+
+// PutCLSpecProperties()
+func (m *Client) PutCLSpecProperties(properties perforce.T_CLSpecProperties) (CL int, err error) {
+	m.record("PutCLSpecProperties", properties)
+	if m.PutCLSpecPropertiesFunc != nil {
+		return m.PutCLSpecPropertiesFunc(properties)
+	}
+	return CL, err
+}
+
+// UpdateCL()
+func (m *Client) UpdateCL(changelist int, description string) (err error) {
+	m.record("UpdateCL", changelist, description)
+	if m.UpdateCLFunc != nil {
+		return m.UpdateCLFunc(changelist, description)
+	}
+	return err
+}
+
+// DeleteCL()
+func (m *Client) DeleteCL(changelist int) (err error) {
+	m.record("DeleteCL", changelist)
+	if m.DeleteCLFunc != nil {
+		return m.DeleteCLFunc(changelist)
+	}
+	return err
+}
+
+// Reopen()
+func (m *Client) Reopen(changelist int, fileType string, files ...string) (reopened []string, err error) {
+	m.record("Reopen", changelist, fileType, files)
+	if m.ReopenFunc != nil {
+		return m.ReopenFunc(changelist, fileType, files...)
+	}
+	return reopened, err
+}
+
+// SubmitCL()
+func (m *Client) SubmitCL(changelist int, description string) (newChangelist int, err error) {
+	m.record("SubmitCL", changelist, description)
+	if m.SubmitCLFunc != nil {
+		return m.SubmitCLFunc(changelist, description)
+	}
+	return newChangelist, err
+}
+
+// Submit()
+func (m *Client) Submit(opts perforce.SubmitOptions) (res perforce.T_SubmitRes, err error) {
+	m.record("Submit", opts)
+	if m.SubmitFunc != nil {
+		return m.SubmitFunc(opts)
+	}
+	return res, err
+}
+
+// GetWorkspaceProperties()
+func (m *Client) GetWorkspaceProperties(workspace string) (properties perforce.T_WSProperties, err error) {
+	m.record("GetWorkspaceProperties", workspace)
+	if m.GetWorkspacePropertiesFunc != nil {
+		return m.GetWorkspacePropertiesFunc(workspace)
+	}
+	return properties, err
+}
+
+// GetViewMap()
+func (m *Client) GetViewMap(workspace string) (v *perforce.ViewMap, err error) {
+	m.record("GetViewMap", workspace)
+	if m.GetViewMapFunc != nil {
+		return m.GetViewMapFunc(workspace)
+	}
+	return v, err
+}
+
+// GetSpec()
+func (m *Client) GetSpec(specType string, name string) (s *perforce.Spec, err error) {
+	m.record("GetSpec", specType, name)
+	if m.GetSpecFunc != nil {
+		return m.GetSpecFunc(specType, name)
+	}
+	return s, err
+}
+
+// PutSpec()
+func (m *Client) PutSpec(specType string, s *perforce.Spec, flags ...string) (response string, err error) {
+	m.record("PutSpec", specType, s, flags)
+	if m.PutSpecFunc != nil {
+		return m.PutSpecFunc(specType, s, flags...)
+	}
+	return response, err
+}
+
+// GetStreams()
+func (m *Client) GetStreams(filter perforce.StreamFilter) (streams []perforce.T_StreamProperties, err error) {
+	m.record("GetStreams", filter)
+	if m.GetStreamsFunc != nil {
+		return m.GetStreamsFunc(filter)
+	}
+	return streams, err
+}
+
+// GetStream()
+func (m *Client) GetStream(stream string) (properties perforce.T_StreamProperties, err error) {
+	m.record("GetStream", stream)
+	if m.GetStreamFunc != nil {
+		return m.GetStreamFunc(stream)
+	}
+	return properties, err
+}
+
+// PutStream()
+func (m *Client) PutStream(properties perforce.T_StreamProperties) (response string, err error) {
+	m.record("PutStream", properties)
+	if m.PutStreamFunc != nil {
+		return m.PutStreamFunc(properties)
+	}
+	return response, err
+}
+
+// SwitchStream()
+func (m *Client) SwitchStream(stream string) (err error) {
+	m.record("SwitchStream", stream)
+	if m.SwitchStreamFunc != nil {
+		return m.SwitchStreamFunc(stream)
+	}
+	return err
+}
+
+// GetStreamStatus()
+func (m *Client) GetStreamStatus(stream string) (status perforce.T_StreamStatus, err error) {
+	m.record("GetStreamStatus", stream)
+	if m.GetStreamStatusFunc != nil {
+		return m.GetStreamStatusFunc(stream)
+	}
+	return status, err
+}
+
+// CopyUp()
+func (m *Client) CopyUp(stream string, changelist int, preview bool) (files []perforce.T_IntegratedFile, err error) {
+	m.record("CopyUp", stream, changelist, preview)
+	if m.CopyUpFunc != nil {
+		return m.CopyUpFunc(stream, changelist, preview)
+	}
+	return files, err
+}
+
+// MergeDown()
+func (m *Client) MergeDown(stream string, changelist int, preview bool) (files []perforce.T_IntegratedFile, err error) {
+	m.record("MergeDown", stream, changelist, preview)
+	if m.MergeDownFunc != nil {
+		return m.MergeDownFunc(stream, changelist, preview)
+	}
+	return files, err
+}
+
+// GetLabels()
+func (m *Client) GetLabels(filter perforce.LabelFilter) (labels []perforce.T_LabelProperties, err error) {
+	m.record("GetLabels", filter)
+	if m.GetLabelsFunc != nil {
+		return m.GetLabelsFunc(filter)
+	}
+	return labels, err
+}
+
+// GetLabel()
+func (m *Client) GetLabel(label string) (properties perforce.T_LabelProperties, err error) {
+	m.record("GetLabel", label)
+	if m.GetLabelFunc != nil {
+		return m.GetLabelFunc(label)
+	}
+	return properties, err
+}
+
+// CreateLabel()
+func (m *Client) CreateLabel(properties perforce.T_LabelProperties) (response string, err error) {
+	m.record("CreateLabel", properties)
+	if m.CreateLabelFunc != nil {
+		return m.CreateLabelFunc(properties)
+	}
+	return response, err
+}
+
+// UpdateLabel()
+func (m *Client) UpdateLabel(properties perforce.T_LabelProperties, force bool) (response string, err error) {
+	m.record("UpdateLabel", properties, force)
+	if m.UpdateLabelFunc != nil {
+		return m.UpdateLabelFunc(properties, force)
+	}
+	return response, err
+}
+
+// DeleteLabel()
+func (m *Client) DeleteLabel(label string, force bool) (err error) {
+	m.record("DeleteLabel", label, force)
+	if m.DeleteLabelFunc != nil {
+		return m.DeleteLabelFunc(label, force)
+	}
+	return err
+}
+
+// Tag()
+func (m *Client) Tag(label string, opts perforce.TagOptions, files ...perforce.FileSpec) (res []perforce.T_LabelFile, err error) {
+	m.record("Tag", label, opts, files)
+	if m.TagFunc != nil {
+		return m.TagFunc(label, opts, files...)
+	}
+	return res, err
+}
+
+// Labelsync()
+func (m *Client) Labelsync(label string, opts perforce.TagOptions, files ...perforce.FileSpec) (res []perforce.T_LabelFile, err error) {
+	m.record("Labelsync", label, opts, files)
+	if m.LabelsyncFunc != nil {
+		return m.LabelsyncFunc(label, opts, files...)
+	}
+	return res, err
+}
+
+// GetBranches()
+func (m *Client) GetBranches(filter perforce.BranchFilter) (branches []perforce.T_BranchProperties, err error) {
+	m.record("GetBranches", filter)
+	if m.GetBranchesFunc != nil {
+		return m.GetBranchesFunc(filter)
+	}
+	return branches, err
+}
+
+// GetBranch()
+func (m *Client) GetBranch(branch string) (properties perforce.T_BranchProperties, err error) {
+	m.record("GetBranch", branch)
+	if m.GetBranchFunc != nil {
+		return m.GetBranchFunc(branch)
+	}
+	return properties, err
+}
+
+// PutBranch()
+func (m *Client) PutBranch(properties perforce.T_BranchProperties, force bool) (response string, err error) {
+	m.record("PutBranch", properties, force)
+	if m.PutBranchFunc != nil {
+		return m.PutBranchFunc(properties, force)
+	}
+	return response, err
+}
+
+// DeleteBranch()
+func (m *Client) DeleteBranch(branch string, force bool) (err error) {
+	m.record("DeleteBranch", branch, force)
+	if m.DeleteBranchFunc != nil {
+		return m.DeleteBranchFunc(branch, force)
+	}
+	return err
+}
+
+// Interchanges()
+func (m *Client) Interchanges(branch string, reverse bool, files ...perforce.FileSpec) (changes []perforce.T_ChangeSummary, err error) {
+	m.record("Interchanges", branch, reverse, files)
+	if m.InterchangesFunc != nil {
+		return m.InterchangesFunc(branch, reverse, files...)
+	}
+	return changes, err
+}
+
+// GetJobSpec()
+func (m *Client) GetJobSpec() (jobSpec perforce.T_JobSpec, err error) {
+	m.record("GetJobSpec")
+	if m.GetJobSpecFunc != nil {
+		return m.GetJobSpecFunc()
+	}
+	return jobSpec, err
+}
+
+// GetJobs()
+func (m *Client) GetJobs(filter perforce.JobFilter) (jobs []perforce.T_JobProperties, err error) {
+	m.record("GetJobs", filter)
+	if m.GetJobsFunc != nil {
+		return m.GetJobsFunc(filter)
+	}
+	return jobs, err
+}
+
+// GetJob()
+func (m *Client) GetJob(job string) (properties perforce.T_JobProperties, err error) {
+	m.record("GetJob", job)
+	if m.GetJobFunc != nil {
+		return m.GetJobFunc(job)
+	}
+	return properties, err
+}
+
+// PutJob()
+func (m *Client) PutJob(properties perforce.T_JobProperties) (job string, err error) {
+	m.record("PutJob", properties)
+	if m.PutJobFunc != nil {
+		return m.PutJobFunc(properties)
+	}
+	return job, err
+}
+
+// Fix()
+func (m *Client) Fix(changelist int, status string, jobs ...string) (err error) {
+	m.record("Fix", changelist, status, jobs)
+	if m.FixFunc != nil {
+		return m.FixFunc(changelist, status, jobs...)
+	}
+	return err
+}
+
+// Unfix()
+func (m *Client) Unfix(changelist int, jobs ...string) (err error) {
+	m.record("Unfix", changelist, jobs)
+	if m.UnfixFunc != nil {
+		return m.UnfixFunc(changelist, jobs...)
+	}
+	return err
+}
+
+// Reconcile()
+func (m *Client) Reconcile(opts perforce.ReconcileOptions, files ...perforce.FileSpec) (res []perforce.T_ReconcileFile, err error) {
+	m.record("Reconcile", opts, files)
+	if m.ReconcileFunc != nil {
+		return m.ReconcileFunc(opts, files...)
+	}
+	return res, err
+}
+
+// Status()
+func (m *Client) Status(opts perforce.ReconcileOptions, files ...perforce.FileSpec) (res []perforce.T_ReconcileFile, err error) {
+	m.record("Status", opts, files)
+	if m.StatusFunc != nil {
+		return m.StatusFunc(opts, files...)
+	}
+	return res, err
+}
+
+// Move()
+func (m *Client) Move(from perforce.FileSpec, to perforce.FileSpec, opts perforce.MoveOptions) (pairs []perforce.T_MovePair, err error) {
+	m.record("Move", from, to, opts)
+	if m.MoveFunc != nil {
+		return m.MoveFunc(from, to, opts)
+	}
+	return pairs, err
+}
+
+// MovePairs()
+func (m *Client) MovePairs(properties perforce.T_CLProperties) (pairs []perforce.T_MovePair, unpaired []string, err error) {
+	m.record("MovePairs", properties)
+	if m.MovePairsFunc != nil {
+		return m.MovePairsFunc(properties)
+	}
+	return pairs, unpaired, err
+}
+
+// Lock()
+func (m *Client) Lock(changelist int, files ...perforce.FileSpec) (locked []string, err error) {
+	m.record("Lock", changelist, files)
+	if m.LockFunc != nil {
+		return m.LockFunc(changelist, files...)
+	}
+	return locked, err
+}
+
+// Unlock()
+func (m *Client) Unlock(opts perforce.UnlockOptions, files ...perforce.FileSpec) (unlocked []string, err error) {
+	m.record("Unlock", opts, files)
+	if m.UnlockFunc != nil {
+		return m.UnlockFunc(opts, files...)
+	}
+	return unlocked, err
+}
+
+// DiffHRvsWS()
+func (m *Client) DiffHRvsWS(algo string, depotFile string) (res perforce.T_DiffRes, err error) {
+	m.record("DiffHRvsWS", algo, depotFile)
+	if m.DiffHRvsWSFunc != nil {
+		return m.DiffHRvsWSFunc(algo, depotFile)
+	}
+	return res, err
+}
+
+// DiffHRvsWSWithOptions()
+func (m *Client) DiffHRvsWSWithOptions(algo string, depotFile string, opts perforce.DiffOptions) (res perforce.T_DiffRes, err error) {
+	m.record("DiffHRvsWSWithOptions", algo, depotFile, opts)
+	if m.DiffHRvsWSWithOptionsFunc != nil {
+		return m.DiffHRvsWSWithOptionsFunc(algo, depotFile, opts)
+	}
+	return res, err
+}
+
+// DiffHRvsWSFiles()
+func (m *Client) DiffHRvsWSFiles(algo string, depotFiles []string) (res []perforce.T_DiffRes, err error) {
+	m.record("DiffHRvsWSFiles", algo, depotFiles)
+	if m.DiffHRvsWSFilesFunc != nil {
+		return m.DiffHRvsWSFilesFunc(algo, depotFiles)
+	}
+	return res, err
+}
+
+// DiffChangelist()
+func (m *Client) DiffChangelist(algo string, changelist int) (res []perforce.T_DiffRes, err error) {
+	m.record("DiffChangelist", algo, changelist)
+	if m.DiffChangelistFunc != nil {
+		return m.DiffChangelistFunc(algo, changelist)
+	}
+	return res, err
+}
+
+// P4Info()
+func (m *Client) P4Info() (output string, err error) {
+	m.record("P4Info")
+	if m.P4InfoFunc != nil {
+		return m.P4InfoFunc()
+	}
+	return output, err
+}
+
+// GetServerInfo()
+func (m *Client) GetServerInfo() (info perforce.ServerInfo, err error) {
+	m.record("GetServerInfo")
+	if m.GetServerInfoFunc != nil {
+		return m.GetServerInfoFunc()
+	}
+	return info, err
+}
@@ -0,0 +1,57 @@
+package perforcemock_test
+
+import (
+	"errors"
+	"testing"
+
+	perforce "github.com/fabdem/go-perforce"
+	"github.com/fabdem/go-perforce/perforcemock"
+)
+
+// Code written against the interfaces accepts the mock
+func headRevs(q perforce.FileQuerier, files ...string) (revs []int, err error) {
+	for _, f := range files {
+		rev, err := q.GetHeadRev(f)
+		if err != nil {
+			return revs, err
+		}
+		revs = append(revs, rev)
+	}
+	return revs, nil
+}
+
+func TestClient(t *testing.T) {
+	m := &perforcemock.Client{
+		GetHeadRevFunc: func(depotFileName string) (int, error) {
+			if depotFileName == "//depot/none.txt" {
+				return 0, errors.New("no such file")
+			}
+			return len(depotFileName), nil
+		},
+	}
+
+	revs, err := headRevs(m, "//depot/a.txt", "//depot/bb.txt")
+	if err != nil || len(revs) != 2 || revs[0] != 13 || revs[1] != 14 {
+		t.Errorf("%v %v", revs, err)
+	}
+	if _, err = headRevs(m, "//depot/none.txt"); err == nil {
+		t.Errorf("no error")
+	}
+
+	// No Func: zero values
+	if res, err := m.Submit(perforce.SubmitOptions{Changelist: 3}); err != nil || res.Change != 0 {
+		t.Errorf("%+v %v", res, err)
+	}
+
+	calls := m.CallsTo("GetHeadRev")
+	if len(calls) != 3 || calls[1].Args[0] != "//depot/bb.txt" {
+		t.Errorf("%+v", calls)
+	}
+	if all := m.Calls(); len(all) != 4 || all[3].Method != "Submit" || all[3].Args[0].(perforce.SubmitOptions).Changelist != 3 {
+		t.Errorf("%+v", all)
+	}
+	m.Reset()
+	if len(m.Calls()) != 0 {
+		t.Errorf("calls not reset")
+	}
+}
@@ -0,0 +1,1894 @@
+package perforcetest
+
+// p4 commands implemented by the fake server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	perforce "github.com/fabdem/go-perforce"
+)
+
+var commands = map[string]func(*Server, *request){
+	"info":         (*Server).cmdInfo,
+	"where":        (*Server).cmdWhere,
+	"print":        (*Server).cmdPrint,
+	"files":        (*Server).cmdFiles,
+	"describe":     (*Server).cmdDescribe,
+	"filelog":      (*Server).cmdFilelog,
+	"annotate":     (*Server).cmdAnnotate,
+	"client":       (*Server).cmdClient,
+	"workspace":    (*Server).cmdClient,
+	"change":       (*Server).cmdChange,
+	"changelist":   (*Server).cmdChange,
+	"reopen":       (*Server).cmdReopen,
+	"submit":       (*Server).cmdSubmit,
+	"diff":         (*Server).cmdDiff,
+	"reconcile":    (*Server).cmdReconcile,
+	"edit":         (*Server).cmdEdit,
+	"move":         (*Server).cmdMove,
+	"revert":       (*Server).cmdRevert,
+	"rename":       (*Server).cmdMove,
+	"lock":         (*Server).cmdLock,
+	"unlock":       (*Server).cmdLock,
+	"opened":       (*Server).cmdOpened,
+	"fstat":        (*Server).cmdFstat,
+	"status":       (*Server).cmdReconcile,
+	"label":        (*Server).cmdSpec,
+	"labels":       (*Server).cmdSpecs,
+	"tag":          (*Server).cmdTag,
+	"labelsync":    (*Server).cmdTag,
+	"branch":       (*Server).cmdSpec,
+	"branches":     (*Server).cmdSpecs,
+	"stream":       (*Server).cmdSpec,
+	"streams":      (*Server).cmdStreams,
+	"copy":         (*Server).cmdStreamInteg,
+	"merge":        (*Server).cmdStreamInteg,
+	"istat":        (*Server).cmdIstat,
+	"interchanges": (*Server).cmdInterchanges,
+	"job":          (*Server).cmdSpec,
+	"jobs":         (*Server).cmdJobs,
+	"jobspec":      (*Server).cmdJobspec,
+	"fix":          (*Server).cmdFix,
+	"user":         (*Server).cmdSpec,
+	"group":        (*Server).cmdSpec,
+	"depot":        (*Server).cmdSpec,
+}
+
+// p4 info
+func (s *Server) cmdInfo(r *request) {
+	root := ""
+	if spec, ok := s.clients[r.client]; ok {
+		root = spec.Get("Root")
+	}
+	date := s.now.Format("2006/01/02 15:04:05 -0700 MST")
+	if r.ztag {
+		r.tag("userName", r.user, "clientName", r.client, "clientRoot", root,
+			"clientHost", "fakehost", "serverAddress", "fake:1666", "serverRoot", "/p4root",
+			"serverDate", date, "serverUptime", "00:00:01",
+			"serverVersion", "P4D/LINUX26X86_64/2020.1/1234567 (2020/06/01)",
+			"serverLicense", "none", "caseHandling", "sensitive", "serverServices", "standard")
+		return
+	}
+	r.out("User name: %s", r.user)
+	r.out("Client name: %s", r.client)
+	r.out("Client host: fakehost")
+	r.out("Client root: %s", root)
+	r.out("Server address: fake:1666")
+	r.out("Server root: /p4root")
+	r.out("Server date: %s", date)
+	r.out("Server uptime: 00:00:01")
+	r.out("Server version: P4D/LINUX26X86_64/2020.1/1234567 (2020/06/01)")
+	r.out("Server license: none")
+	r.out("Server services: standard")
+	r.out("Case Handling: sensitive")
+}
+
+// p4 where file...
+func (s *Server) cmdWhere(r *request) {
+	v, err := s.viewMap(r.client)
+	if err != nil {
+		r.fail("%v", err)
+		return
+	}
+	for _, arg := range r.args {
+		depotFile, _, ok := s.depotSyntax(r.client, arg)
+		var clientFile, local string
+		if ok {
+			clientFile, ok = v.DepotToClient(depotFile)
+		}
+		if ok {
+			local, ok = v.ClientToLocal(clientFile)
+		}
+		if !ok {
+			r.warn("%s - file(s) not in client view.", arg)
+			continue
+		}
+		if r.ztag {
+			r.tag("depotFile", depotFile, "clientFile", clientFile, "path", local)
+		} else {
+			r.out("%s %s %s", depotFile, clientFile, local)
+		}
+	}
+}
+
+// p4 print [-q -k] [-o localFile] file[revSpec]...
+func (s *Server) cmdPrint(r *request) {
+	flags, args := parseFlags(r.args, "o")
+	for _, arg := range args {
+		depotFile, revSpec, ok := s.depotSyntax(r.client, arg)
+		rev := 0
+		if ok {
+			rev = s.revision(r.client, depotFile, revSpec)
+		}
+		if rev <= 0 || isDeleted(s.files[depotFile][rev-1].action) {
+			r.warn("%s - no such file(s).", arg)
+			continue
+		}
+		rv := s.files[depotFile][rev-1]
+		if _, quiet := flags["q"]; !quiet {
+			r.out("%s#%d - %s change %d (%s)", depotFile, rev, rv.action, rv.change, rv.fileType)
+		}
+		if out, ok := flags["o"]; ok {
+			if err := writeFile(out, rv.content); err != nil {
+				r.fail("%v", err)
+			}
+			continue
+		}
+		r.stdout.Write(rv.content)
+	}
+}
+
+// p4 files [-e] [-m max] file[revSpec]...
+func (s *Server) cmdFiles(r *request) {
+	flags, args := parseFlags(r.args, "m")
+	_, existing := flags["e"]
+	max, _ := strconv.Atoi(flags["m"])
+	n := 0
+	for _, arg := range args {
+		pattern, revSpec, ok := s.depotSyntax(r.client, arg)
+		found := false
+		if ok {
+			for _, f := range s.match(pattern) {
+				rev := s.revision(r.client, f, revSpec)
+				if rev <= 0 {
+					continue
+				}
+				rv := s.files[f][rev-1]
+				if existing && isDeleted(rv.action) {
+					continue
+				}
+				if max > 0 && n >= max {
+					return
+				}
+				r.out("%s#%d - %s change %d (%s)", f, rev, rv.action, rv.change, rv.fileType)
+				found = true
+				n++
+			}
+		}
+		if !found {
+			r.warn("%s - no such file(s).", arg)
+		}
+	}
+}
+
+// p4 describe [-s] changelist...
+func (s *Server) cmdDescribe(r *request) {
+	_, args := parseFlags(r.args, "")
+	for _, arg := range args {
+		cl, _ := strconv.Atoi(arg)
+		c, ok := s.changes[cl]
+		if !ok {
+			r.fail("Change %s unknown.", arg)
+			continue
+		}
+		status := ""
+		if c.status == "pending" {
+			status = " *pending*"
+		}
+		r.out("Change %d by %s@%s on %s%s", c.number, c.user, c.client, p4Date(c.time), status)
+		r.out("")
+		for _, l := range strings.Split(c.description, "\n") {
+			r.out("\t%s", l)
+		}
+		r.out("")
+		r.out("Affected files ...")
+		r.out("")
+		if c.status == "pending" {
+			for _, o := range s.openedIn(c.client, c.number) {
+				rev := o.rev
+				if rev <= 0 {
+					rev = 1
+				}
+				r.out("... %s#%d %s", o.depotFile, rev, o.action)
+			}
+		} else {
+			for _, f := range c.files {
+				r.out("... %s#%d %s", f.depotFile, f.rev, f.action)
+			}
+		}
+		r.out("")
+	}
+}
+
+// p4 filelog [-m max] [-t] file...
+//	Only the moves are reported, not the other integrations.
+func (s *Server) cmdFilelog(r *request) {
+	flags, args := parseFlags(r.args, "m")
+	max, _ := strconv.Atoi(flags["m"])
+	for _, arg := range args {
+		pattern, revSpec, ok := s.depotSyntax(r.client, arg)
+		var files []string
+		if ok {
+			files = s.match(pattern)
+		}
+		if len(files) <= 0 {
+			r.warn("%s - no such file(s).", arg)
+			continue
+		}
+		for _, f := range files {
+			r.out("%s", f)
+			n := 0
+			for rev := s.revision(r.client, f, revSpec); rev > 0 && (max <= 0 || n < max); rev-- {
+				rv := s.files[f][rev-1]
+				c := s.changes[rv.change]
+				date := c.time.Format("2006/01/02")
+				if _, ok := flags["t"]; ok {
+					date = p4Date(c.time)
+				}
+				desc := strings.SplitN(c.description, "\n", 2)[0]
+				if len(desc) > 31 {
+					desc = desc[:31]
+				}
+				r.out("... #%d change %d %s on %s by %s@%s (%s) '%s'", rev, rv.change, rv.action, date, c.user, c.client, rv.fileType, desc)
+				if other := s.revisionOfChange(rv.movedFile, rv.change); other > 0 && rv.action == "move/add" {
+					r.out("... ... moved from %s#%d", rv.movedFile, other-1)
+				} else if other > 0 {
+					r.out("... ... moved into %s#%d", rv.movedFile, other)
+				}
+				n++
+			}
+		}
+	}
+}
+
+// Revision of a file submitted in a changelist, 0 if none
+func (s *Server) revisionOfChange(depotFile string, change int) int {
+	for i, rv := range s.files[depotFile] {
+		if rv.change == change {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Default workspace spec
+func (s *Server) defaultClient(name string, owner string) *perforce.Spec {
+	spec := perforce.NewSpec()
+	spec.Set("Client", name)
+	spec.Set("Update", p4Date(s.now))
+	spec.Set("Access", p4Date(s.now))
+	spec.Set("Owner", owner)
+	spec.Set("Host", "fakehost")
+	spec.SetLines("Description", []string{"Created by " + owner + "."})
+	spec.Set("Root", "/home/"+owner+"/"+name)
+	spec.Set("Options", "noallwrite noclobber nocompress unlocked nomodtime normdir")
+	spec.Set("SubmitOptions", "submitunchanged")
+	spec.Set("LineEnd", "local")
+	spec.SetLines("View", []string{"//depot/... //" + name + "/..."})
+	return spec
+}
+
+// p4 annotate [-a] [-I] [-u] [-db|-dw] [-dl] file[revSpec]
+//	Integrations aren't tracked: -I only reports changelists instead of revisions.
+//	Deleted lines aren't reported by -a.
+func (s *Server) cmdAnnotate(r *request) {
+	mods := ""
+	for _, a := range r.args {
+		if strings.HasPrefix(a, "-d") {
+			mods += a[2:]
+		}
+	}
+	flags, args := parseFlags(r.args, "d")
+	_, changes := flags["I"]
+	for _, arg := range args {
+		depotFile, revSpec, ok := s.depotSyntax(r.client, arg)
+		rev := 0
+		if ok {
+			rev = s.revision(r.client, depotFile, revSpec)
+		}
+		if rev <= 0 || isDeleted(s.files[depotFile][rev-1].action) {
+			r.warn("%s - no such file(s).", arg)
+			continue
+		}
+		revs := s.files[depotFile]
+		r.out("%s#%d - %s change %d (%s)", depotFile, rev, revs[rev-1].action, revs[rev-1].change, revs[rev-1].fileType)
+		if strings.HasPrefix(revs[rev-1].fileType, "binary") {
+			continue
+		}
+
+		// Revision adding each line, following the lines from revision to revision
+		var lines []string
+		var origins []int
+		for n := 1; n <= rev; n++ {
+			next := splitLines(string(revs[n-1].content), mods)
+			nextOrigins := make([]int, len(next))
+			for j, i := range matchLines(lines, next) {
+				if i >= 0 {
+					nextOrigins[j] = origins[i]
+				} else {
+					nextOrigins[j] = n
+				}
+			}
+			lines, origins = next, nextOrigins
+		}
+
+		upper := rev
+		if changes {
+			upper = revs[rev-1].change
+		}
+		for j, line := range splitLines(string(revs[rev-1].content), "") {
+			lower := origins[j]
+			c := s.changes[revs[lower-1].change]
+			if changes {
+				lower = c.number
+			}
+			if _, all := flags["a"]; all {
+				fmt.Fprintf(&r.stdout, "%d-%d: ", lower, upper)
+			} else {
+				fmt.Fprintf(&r.stdout, "%d: ", lower)
+			}
+			if _, user := flags["u"]; user {
+				fmt.Fprintf(&r.stdout, "%s %s ", c.user, c.time.Format("2006/01/02"))
+			}
+			r.stdout.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				r.stdout.WriteString("\n")
+			}
+		}
+	}
+}
+
+// p4 client [-o|-i|-d] [-f] [name]
+//	p4 client -s -S stream
+func (s *Server) cmdClient(r *request) {
+	flags, args := parseFlags(r.args, "S")
+	name := r.client
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	switch {
+	case hasFlag(flags, "s"):
+		spec, ok := s.clients[name]
+		if !ok {
+			r.fail("Client '%s' unknown - use 'client' command to create it.", name)
+			return
+		}
+		stream, ok := s.specs["stream"][flags["S"]]
+		if !ok {
+			r.fail("Stream '%s' doesn't exist.", flags["S"])
+			return
+		}
+		if len(s.opened[name]) > 0 {
+			r.fail("Client '%s' has files opened; they must be reverted or submitted before switching streams.", name)
+			return
+		}
+		view, err := streamView(stream, name)
+		if err != nil {
+			r.fail("%v", err)
+			return
+		}
+		spec.Set("Stream", stream.Get("Stream"))
+		spec.SetLines("View", view)
+		r.out("Client %s switched.", name)
+
+	case hasFlag(flags, "i"):
+		spec, ok := s.readSpec(r)
+		if !ok {
+			return
+		}
+		name = spec.Get("Client")
+		if _, err := perforce.ParseViewMap(spec.GetLines("View")); err != nil {
+			r.fail("Error in client specification.\n%v", err)
+			return
+		}
+		if old, ok := s.clients[name]; ok && old.String() == spec.String() {
+			r.out("Client %s not changed.", name)
+			return
+		}
+		s.clients[name] = spec
+		r.out("Client %s saved.", name)
+
+	case hasFlag(flags, "d"):
+		if _, ok := s.clients[name]; !ok {
+			r.fail("Client '%s' doesn't exist.", name)
+			return
+		}
+		if len(s.opened[name]) > 0 && !hasFlag(flags, "f") {
+			r.fail("Client '%s' has files opened. To delete the client, revert any opened files and delete any pending changes first.", name)
+			return
+		}
+		delete(s.clients, name)
+		delete(s.opened, name)
+		r.out("Client %s deleted.", name)
+
+	default:
+		spec, ok := s.clients[name]
+		if !ok {
+			spec = s.defaultClient(name, r.user)
+		}
+		r.stdout.WriteString(spec.String())
+	}
+}
+
+// p4 change [-o|-i|-d] [-f] [changelist]
+func (s *Server) cmdChange(r *request) {
+	flags, args := parseFlags(r.args, "")
+	cl := 0
+	if len(args) > 0 {
+		cl, _ = strconv.Atoi(args[0])
+	}
+
+	switch {
+	case hasFlag(flags, "i"):
+		spec, ok := s.readSpec(r)
+		if !ok {
+			return
+		}
+		s.changeIn(r, spec, hasFlag(flags, "f"))
+
+	case hasFlag(flags, "d"):
+		c, ok := s.changes[cl]
+		if !ok {
+			r.fail("Change %d unknown.", cl)
+			return
+		}
+		if c.status == "submitted" && !hasFlag(flags, "f") {
+			r.fail("Change %d is already committed.", cl)
+			return
+		}
+		if n := len(s.openedIn(c.client, cl)); n > 0 {
+			r.fail("Change %d has %d open file(s) associated with it and can't be deleted.", cl, n)
+			return
+		}
+		delete(s.changes, cl)
+		r.out("Change %d deleted.", cl)
+
+	default:
+		s.changeOut(r, cl)
+	}
+}
+
+// Change spec
+func (s *Server) changeOut(r *request, cl int) {
+	spec := perforce.NewSpec()
+	var files []*openedFile
+	if cl <= 0 {
+		if _, ok := s.clients[r.client]; !ok {
+			r.fail("Client '%s' unknown - use 'client' command to create it.", r.client)
+			return
+		}
+		spec.Set("Change", "new")
+		spec.Set("Client", r.client)
+		spec.Set("User", r.user)
+		spec.Set("Status", "new")
+		spec.SetLines("Description", []string{"<enter description here>"})
+		files = s.openedIn(r.client, 0)
+	} else {
+		c, ok := s.changes[cl]
+		if !ok {
+			r.fail("Change %d unknown.", cl)
+			return
+		}
+		spec.Set("Change", strconv.Itoa(cl))
+		spec.Set("Date", p4Date(c.time))
+		spec.Set("Client", c.client)
+		spec.Set("User", c.user)
+		spec.Set("Status", c.status)
+		spec.Set("Type", c.changeType)
+		spec.SetLines("Description", strings.Split(c.description, "\n"))
+		if c.status == "pending" {
+			files = s.openedIn(c.client, cl)
+		}
+		if len(c.jobs) > 0 {
+			var lines []string
+			for _, job := range sortedKeys(c.jobs) {
+				lines = append(lines, job+"\t# "+s.specs["job"][job].Get("Status"))
+			}
+			spec.SetLines("Jobs", lines)
+		}
+	}
+	if len(files) > 0 {
+		var lines []string
+		for _, o := range files {
+			lines = append(lines, o.depotFile+"\t# "+o.action)
+		}
+		spec.SetLines("Files", lines)
+	}
+	r.stdout.WriteString(spec.String())
+}
+
+// Create or update a changelist from a spec
+func (s *Server) changeIn(r *request, spec *perforce.Spec, force bool) {
+	description := strings.TrimSpace(spec.Get("Description"))
+	if len(description) <= 0 || description == "<enter description here>" {
+		r.fail("Error in change specification.\nChange description missing.  You must enter one.")
+		return
+	}
+	client := spec.Get("Client")
+	if len(client) <= 0 {
+		client = r.client
+	}
+
+	var c *change
+	created := false
+	if id := spec.Get("Change"); id == "new" {
+		if _, ok := s.clients[client]; !ok {
+			r.fail("Client '%s' unknown - use 'client' command to create it.", client)
+			return
+		}
+		c = s.newChange(r.user, client, description)
+		created = true
+	} else {
+		cl, _ := strconv.Atoi(id)
+		var ok bool
+		if c, ok = s.changes[cl]; !ok {
+			r.fail("Change %s unknown.", id)
+			return
+		}
+		if c.status == "submitted" && !force {
+			r.fail("Change %d has been submitted and can only be updated with -f.", cl)
+			return
+		}
+		c.description = description
+	}
+	if t := spec.Get("Type"); t == "public" || t == "restricted" {
+		c.changeType = t
+	}
+
+	// Jobs listed are fixed by the changelist
+	if c.status == "pending" {
+		jobs := make(map[string]string)
+		for _, line := range spec.GetLines("Jobs") {
+			job := strings.TrimSpace(strings.SplitN(line, "#", 2)[0])
+			if len(job) <= 0 {
+				continue
+			}
+			if _, ok := s.specs["job"][job]; !ok {
+				r.fail("Job '%s' doesn't exist.", job)
+				return
+			}
+			jobs[job] = c.jobs[job]
+		}
+		c.jobs = jobs
+	}
+
+	// Move files listed from the default changelist, and files not listed back to it
+	n := 0
+	if c.status == "pending" {
+		listed := make(map[string]bool)
+		for _, line := range spec.GetLines("Files") {
+			f := strings.TrimSpace(strings.SplitN(line, "#", 2)[0])
+			if len(f) > 0 {
+				listed[f] = true
+			}
+		}
+		for f, o := range s.opened[client] {
+			switch {
+			case listed[f] && (o.change == 0 || o.change == c.number):
+				o.change = c.number
+				n++
+			case !listed[f] && o.change == c.number:
+				o.change = 0
+			}
+		}
+	}
+
+	switch {
+	case !created:
+		r.out("Change %d updated.", c.number)
+	case n > 0:
+		r.out("Change %d created with %d open file(s).", c.number, n)
+	default:
+		r.out("Change %d created.", c.number)
+	}
+}
+
+// Other specs: label, branch, stream, job, user, group, depot
+//	p4 <type> [-o|-i|-d] [-f] [name]
+func (s *Server) cmdSpec(r *request) {
+	flags, args := parseFlags(r.args, "")
+	key := specKeys[r.cmd]
+	title := strings.ToUpper(r.cmd[:1]) + r.cmd[1:]
+	name := ""
+	if len(args) > 0 {
+		name = args[0]
+	} else if r.cmd == "user" {
+		name = r.user
+	}
+	if s.specs[r.cmd] == nil {
+		s.specs[r.cmd] = make(map[string]*perforce.Spec)
+	}
+	specs := s.specs[r.cmd]
+
+	switch {
+	case hasFlag(flags, "i"):
+		spec, ok := s.readSpec(r)
+		if !ok {
+			return
+		}
+		name = spec.Get(key)
+		if len(name) <= 0 {
+			r.fail("Error in %s specification.\nMissing required field '%s'.", r.cmd, key)
+			return
+		}
+		if r.cmd == "job" {
+			if name == "new" {
+				name = fmt.Sprintf("job%06d", s.nextJob)
+				s.nextJob++
+				spec.Set(key, name)
+			}
+			if status := spec.Get("Status"); status != "open" && status != "suspended" && status != "closed" {
+				r.fail("Error in job specification.\nValue for field 'Status' must be one of open/suspended/closed.")
+				return
+			}
+			spec.Set("Date", p4Date(s.now))
+		}
+		if old, ok := specs[name]; ok && old.String() == spec.String() {
+			r.out("%s %s not changed.", title, name)
+			return
+		}
+		specs[name] = spec
+		r.out("%s %s saved.", title, name)
+
+	case hasFlag(flags, "d"):
+		if _, ok := specs[name]; !ok {
+			r.fail("%s '%s' doesn't exist.", title, name)
+			return
+		}
+		delete(specs, name)
+		if r.cmd == "label" {
+			delete(s.labels, name)
+		}
+		r.out("%s %s deleted.", title, name)
+
+	default:
+		spec, ok := specs[name]
+		if !ok {
+			spec = perforce.NewSpec()
+			if len(name) <= 0 {
+				name = "new"
+			}
+			spec.Set(key, name)
+			if r.cmd == "job" {
+				spec.Set("Status", "open")
+				spec.Set("User", r.user)
+				spec.Set("Date", p4Date(s.now))
+			} else if r.cmd != "user" && r.cmd != "group" {
+				spec.Set("Owner", r.user)
+			}
+			spec.SetLines("Description", []string{"Created by " + r.user + "."})
+			if r.cmd == "label" {
+				spec.Set("Options", "unlocked noautoreload")
+				spec.SetLines("View", []string{"//depot/..."})
+			}
+			if r.cmd == "branch" {
+				spec.Set("Options", "unlocked")
+			}
+			if r.cmd == "stream" {
+				spec.Set("Name", name[strings.LastIndex(name, "/")+1:])
+				spec.Set("Parent", "none")
+				spec.Set("Type", "mainline")
+				spec.Set("Options", "allsubmit unlocked toparent fromparent mergedown")
+				spec.SetLines("Paths", []string{"share ..."})
+			}
+		}
+		r.stdout.WriteString(spec.String())
+	}
+}
+
+// p4 labels [-U] [-u owner] [-e|-E name] [-m max] [path]
+//	p4 branches [-u owner] [-e|-E name] [-m max]
+func (s *Server) cmdSpecs(r *request) {
+	flags, args := parseFlags(r.args, "ueEm")
+	max, _ := strconv.Atoi(flags["m"])
+	specType := map[string]string{"labels": "label", "branches": "branch"}[r.cmd]
+
+	var names []string
+	for name := range s.specs[specType] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	count := 0
+	for _, name := range names {
+		spec := s.specs[specType][name]
+		if owner, ok := flags["u"]; ok && spec.Get("Owner") != owner {
+			continue
+		}
+		if pattern, ok := flags["e"]; ok && !wildcardRegexp(pattern).MatchString(name) {
+			continue
+		}
+		if pattern, ok := flags["E"]; ok && !wildcardRegexp(strings.ToLower(pattern)).MatchString(strings.ToLower(name)) {
+			continue
+		}
+		if len(args) > 0 && specType == "label" {
+			depotFile, _, ok := s.depotSyntax(r.client, args[0])
+			re := wildcardRegexp(depotFile)
+			found := false
+			for f := range s.labels[name] {
+				found = found || (ok && re.MatchString(f))
+			}
+			if !found {
+				continue
+			}
+		}
+		if max > 0 && count >= max {
+			break
+		}
+		count++
+		update := strconv.FormatInt(s.now.Unix(), 10)
+		if r.ztag {
+			r.tag(specType, name, "Update", update, "Access", update, "Owner", spec.Get("Owner"),
+				"Options", spec.Get("Options"), "Description", spec.Get("Description"))
+			continue
+		}
+		r.out("%s %s %s '%s'", specKeys[specType], name, s.now.Format("2006/01/02"), spec.Get("Description"))
+	}
+}
+
+// p4 tag [-n] [-d] -l label file...
+//	p4 labelsync [-n] [-a|-d] -l label [file...]
+func (s *Server) cmdTag(r *request) {
+	flags, args := parseFlags(r.args, "l")
+	label := flags["l"]
+	preview, remove := hasFlag(flags, "n"), hasFlag(flags, "d")
+	if _, ok := s.specs["label"][label]; !ok {
+		r.fail("Label '%s' unknown - use 'label' command to create it.", label)
+		return
+	}
+	if r.cmd == "tag" && len(args) <= 0 {
+		r.fail("Usage: tag [-d -g -n -U] -l label file[revRange] ...")
+		return
+	}
+
+	// Files and revisions given, the revisions synced in the workspace by default
+	files := make(map[string]int)
+	if len(args) <= 0 {
+		args = []string{"//" + r.client + "/...#have"}
+	}
+	for _, arg := range args {
+		pattern, revSpec, ok := s.depotSyntax(r.client, arg)
+		found := false
+		if ok {
+			for _, f := range s.match(pattern) {
+				if rev := s.revision(r.client, f, revSpec); rev > 0 {
+					files[f] = rev
+					found = true
+				}
+			}
+		}
+		if !found {
+			r.warn("%s - no such file(s).", arg)
+		}
+	}
+
+	tagged := s.labels[label]
+	if tagged == nil {
+		tagged = make(map[string]int)
+	}
+	changed := make(map[string]int)
+	actions := make(map[string]string)
+	for f, rev := range files {
+		old, exists := tagged[f]
+		switch {
+		case remove && exists:
+			actions[f] = "deleted"
+		case !remove && !exists:
+			actions[f] = "added"
+		case !remove && old != rev:
+			actions[f] = "updated"
+		default:
+			continue
+		}
+		changed[f] = rev
+	}
+	if r.cmd == "labelsync" && !remove && !hasFlag(flags, "a") {
+		for f, rev := range tagged {
+			if _, ok := files[f]; !ok {
+				actions[f], changed[f] = "deleted", rev
+			}
+		}
+	}
+
+	var names []string
+	for f := range changed {
+		names = append(names, f)
+	}
+	sort.Strings(names)
+	for _, f := range names {
+		r.out("%s#%d - %s", f, changed[f], actions[f])
+		if preview {
+			continue
+		}
+		if actions[f] == "deleted" {
+			delete(tagged, f)
+		} else {
+			tagged[f] = changed[f]
+		}
+	}
+	if len(names) <= 0 && len(files) > 0 {
+		r.warn("%s - label in sync.", args[0])
+	}
+	if !preview {
+		s.labels[label] = tagged
+	}
+}
+
+// p4 jobspec -o
+func (s *Server) cmdJobspec(r *request) {
+	r.out("# A Perforce Job Specification.")
+	r.out("")
+	r.out("Fields:")
+	r.out("\t101 Job word 32 required")
+	r.out("\t102 Status select 10 required")
+	r.out("\t103 User word 32 required")
+	r.out("\t104 Date date 20 always")
+	r.out("\t105 Description text 0 required")
+	r.out("")
+	r.out("Values:")
+	r.out("\tStatus open/suspended/closed")
+	r.out("")
+	r.out("Presets:")
+	r.out("\tStatus open")
+	r.out("\tUser $user")
+	r.out("\tDate $now")
+	r.out("\tDescription $blank")
+}
+
+// p4 jobs [-l] [-e query] [-m max] [path]
+//	Queries: field=value terms, all of them must match.
+func (s *Server) cmdJobs(r *request) {
+	flags, args := parseFlags(r.args, "em")
+	max, _ := strconv.Atoi(flags["m"])
+
+	// Jobs fixed by changes including files of the path
+	var fixed map[string]bool
+	if len(args) > 0 {
+		fixed = make(map[string]bool)
+		depotFile, _, ok := s.depotSyntax(r.client, args[0])
+		re := wildcardRegexp(depotFile)
+		for _, c := range s.changes {
+			for _, f := range c.files {
+				if ok && re.MatchString(f.depotFile) {
+					for job := range c.jobs {
+						fixed[job] = true
+					}
+				}
+			}
+		}
+	}
+
+	var names []string
+	for name := range s.specs["job"] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	count := 0
+	for _, name := range names {
+		spec := s.specs["job"][name]
+		if (fixed != nil && !fixed[name]) || !matchFilter(spec, flags["e"]) {
+			continue
+		}
+		if max > 0 && count >= max {
+			break
+		}
+		count++
+		if r.ztag {
+			var fields []string
+			for _, f := range spec.Fields() {
+				fields = append(fields, f, spec.Get(f))
+			}
+			r.tag(fields...)
+			continue
+		}
+		r.out("%s on %s by %s *%s* '%s'", name, strings.Fields(spec.Get("Date"))[0], spec.Get("User"),
+			spec.Get("Status"), spec.Get("Description"))
+	}
+}
+
+// p4 fix [-d] [-s status] -c changelist job...
+func (s *Server) cmdFix(r *request) {
+	flags, args := parseFlags(r.args, "cs")
+	cl, _ := strconv.Atoi(flags["c"])
+	c, ok := s.changes[cl]
+	if !ok {
+		r.fail("Change %s unknown.", flags["c"])
+		return
+	}
+	for _, job := range args {
+		if _, ok := s.specs["job"][job]; !ok {
+			r.fail("Job '%s' doesn't exist.", job)
+			continue
+		}
+		if hasFlag(flags, "d") {
+			if _, ok := c.jobs[job]; !ok {
+				r.fail("Fix %s by change %d doesn't exist.", job, cl)
+				continue
+			}
+			delete(c.jobs, job)
+			r.out("Deleted fix %s by change %d.", job, cl)
+			continue
+		}
+		if c.jobs == nil {
+			c.jobs = make(map[string]string)
+		}
+		c.jobs[job] = flags["s"]
+		if c.status == "submitted" {
+			s.setJobStatus(job, flags["s"])
+		}
+		r.out("%s fixed by change %d.", job, cl)
+	}
+}
+
+// Status of a job fixed by a submitted change
+func (s *Server) setJobStatus(job string, status string) {
+	if len(status) <= 0 {
+		status = "closed"
+	}
+	if spec, ok := s.specs["job"][job]; ok {
+		spec.Set("Status", status)
+	}
+}
+
+// p4 streams [-U] [-F filter] [-m max] [path...]
+//	Filters: field=value terms, all of them must match.
+func (s *Server) cmdStreams(r *request) {
+	flags, args := parseFlags(r.args, "Fm")
+	max, _ := strconv.Atoi(flags["m"])
+
+	var names []string
+	for name := range s.specs["stream"] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	count := 0
+	for _, name := range names {
+		spec := s.specs["stream"][name]
+		if len(args) > 0 {
+			matched := false
+			for _, a := range args {
+				matched = matched || wildcardRegexp(a).MatchString(name)
+			}
+			if !matched {
+				continue
+			}
+		}
+		if !matchFilter(spec, flags["F"]) {
+			continue
+		}
+		if max > 0 && count >= max {
+			break
+		}
+		count++
+		update := strconv.FormatInt(s.now.Unix(), 10)
+		if r.ztag {
+			r.tag("Stream", name, "Update", update, "Access", update, "Owner", spec.Get("Owner"),
+				"Name", spec.Get("Name"), "Parent", spec.Get("Parent"), "Type", spec.Get("Type"),
+				"desc", spec.Get("Description"), "Options", spec.Get("Options"))
+			continue
+		}
+		r.out("Stream %s %s %s '%s'", name, spec.Get("Type"), spec.Get("Parent"), spec.Get("Name"))
+	}
+}
+
+// Whether a spec matches a filter of field=value terms (wildcard * allowed)
+func matchFilter(spec *perforce.Spec, filter string) bool {
+	for _, term := range strings.Fields(strings.Trim(filter, "()")) {
+		term = strings.Trim(term, "()")
+		i := strings.Index(term, "=")
+		if i <= 0 {
+			continue
+		}
+		if !wildcardRegexp(term[i+1:]).MatchString(spec.Get(term[:i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// View of a workspace switched to a stream. The paths of the parents aren't inherited.
+func streamView(stream *perforce.Spec, client string) (view []string, err error) {
+	root := stream.Get("Stream")
+	for _, line := range stream.GetLines("Paths") {
+		words := quotedFields(line)
+		if len(words) < 2 {
+			return nil, fmt.Errorf("Error in stream specification.\nInvalid path: %s", line)
+		}
+		clientPath := quote("//" + client + "/" + words[1])
+		switch words[0] {
+		case "share", "isolate":
+			view = append(view, quote(root+"/"+words[1])+" "+clientPath)
+		case "import", "import+":
+			depotPath := root + "/" + words[1]
+			if len(words) > 2 {
+				depotPath = words[2]
+			}
+			view = append(view, quote(depotPath)+" "+clientPath)
+		case "exclude":
+			view = append(view, quote("-"+root+"/"+words[1])+" "+clientPath)
+		}
+	}
+	return view, nil
+}
+
+// Fields of a spec line, double-quoted fields may contain spaces
+func quotedFields(line string) (fields []string) {
+	quoted := false
+	for _, f := range strings.FieldsFunc(line, func(c rune) bool {
+		if c == '"' {
+			quoted = !quoted
+		}
+		return !quoted && (c == ' ' || c == '\t')
+	}) {
+		fields = append(fields, strings.Trim(f, `"`))
+	}
+	return fields
+}
+
+func quote(path string) string {
+	if strings.ContainsAny(path, " \t") {
+		return `"` + path + `"`
+	}
+	return path
+}
+
+// p4 reopen [-c changelist] [-t filetype] file...
+func (s *Server) cmdReopen(r *request) {
+	flags, args := parseFlags(r.args, "ct")
+	target := -1
+	if c, ok := flags["c"]; ok {
+		if c == "default" {
+			target = 0
+		} else {
+			cl, _ := strconv.Atoi(c)
+			if ch, ok := s.changes[cl]; !ok || ch.status != "pending" || ch.client != r.client {
+				r.fail("Change %s unknown.", c)
+				return
+			}
+			target = cl
+		}
+	}
+	for _, arg := range args {
+		files := s.matchOpened(r.client, arg)
+		if len(files) <= 0 {
+			r.warn("%s - file(s) not opened on this client.", arg)
+			continue
+		}
+		for _, o := range files {
+			msg := ""
+			if target >= 0 {
+				o.change = target
+				if target == 0 {
+					msg += "; default change"
+				} else {
+					msg += fmt.Sprintf("; change %d", target)
+				}
+			}
+			if t, ok := flags["t"]; ok {
+				o.fileType = t
+				msg += "; type " + t
+			}
+			rev := "none"
+			if o.rev > 0 {
+				rev = strconv.Itoa(o.rev)
+			}
+			r.out("%s#%s - reopened%s", o.depotFile, rev, msg)
+		}
+	}
+}
+
+// p4 submit [-r] [-s] [-f option] [--parallel=...] -c changelist | -d description | -e changelist
+//	Shelving isn't implemented: -e fails. -s and --parallel are accepted.
+func (s *Server) cmdSubmit(r *request) {
+	flags, _ := parseFlags(r.args, "cdef")
+	unchanged := flags["f"]
+	switch unchanged {
+	case "", "submitunchanged", "revertunchanged", "leaveunchanged":
+	default:
+		r.fail("Invalid option '-f %s'.", unchanged)
+		return
+	}
+
+	var c *change
+	if id, ok := flags["e"]; ok {
+		r.fail("Change %s - no shelved files in changelist to submit.", id)
+		return
+	}
+	if id, ok := flags["c"]; ok {
+		cl, _ := strconv.Atoi(id)
+		if c, ok = s.changes[cl]; !ok || c.status != "pending" {
+			r.fail("Change %s unknown.", id)
+			return
+		}
+		if len(s.openedIn(c.client, cl)) <= 0 {
+			r.out("Submitting change %d.", cl)
+			r.fail("No files to submit.")
+			return
+		}
+	} else {
+		if len(s.openedIn(r.client, 0)) <= 0 {
+			r.fail("No files to submit from the default changelist.")
+			return
+		}
+		description := strings.TrimSpace(flags["d"])
+		if len(description) <= 0 {
+			r.fail("Change description missing.  You must enter one.")
+			return
+		}
+		c = s.newChange(r.user, r.client, description)
+		for _, o := range s.openedIn(r.client, 0) {
+			o.change = c.number
+		}
+	}
+
+	files := s.openedIn(c.client, c.number)
+	r.out("Submitting change %d.", c.number)
+
+	for _, o := range files {
+		if locks := s.lockedBy(o.depotFile, c.client); len(locks) > 0 {
+			o := s.opened[locks[0]][o.depotFile]
+			r.fail("%s - already locked by %s@%s", o.depotFile, o.user, locks[0])
+			r.fail("File(s) couldn't be locked.")
+			r.fail("Submit aborted -- fix problems then use 'p4 submit -c %d'.", c.number)
+			return
+		}
+	}
+
+	// Get the content of the files from the workspace
+	contents := make(map[string][]byte)
+	for _, o := range files {
+		if isDeleted(o.action) {
+			continue
+		}
+		local, ok := s.localPath(c.client, o.depotFile)
+		if !ok {
+			r.fail("%s - file(s) not in client view.", o.depotFile)
+			r.fail("Submit aborted -- fix problems then use 'p4 submit -c %d'.", c.number)
+			return
+		}
+		content, err := os.ReadFile(local)
+		if err != nil {
+			r.fail("open for read: %s: %v", local, err)
+			r.fail("Submit aborted -- fix problems then use 'p4 submit -c %d'.", c.number)
+			return
+		}
+		contents[o.depotFile] = content
+	}
+
+	// Unchanged files: reverted or left opened in the default changelist
+	if unchanged == "revertunchanged" || unchanged == "leaveunchanged" {
+		var changed []*openedFile
+		for _, o := range files {
+			if o.action != "edit" || !bytes.Equal(contents[o.depotFile], s.head(o.depotFile).content) {
+				changed = append(changed, o)
+				continue
+			}
+			if unchanged == "revertunchanged" {
+				delete(s.opened[c.client], o.depotFile)
+				r.out("%s#%d - was edit, reverted", o.depotFile, o.rev)
+			} else {
+				o.change = 0
+			}
+		}
+		if files = changed; len(files) <= 0 {
+			r.fail("No files to submit.")
+			return
+		}
+	}
+	r.out("Locking %d files ...", len(files))
+
+	// Renumber the changelist if changes were created after it
+	number := c.number
+	if number != s.nextChange-1 {
+		delete(s.changes, c.number)
+		c.number = s.nextChange
+		s.nextChange++
+		s.changes[c.number] = c
+	}
+	c.status = "submitted"
+	c.time = s.tick()
+
+	for _, o := range files {
+		s.files[o.depotFile] = append(s.files[o.depotFile], &revision{
+			change:    c.number,
+			action:    o.action,
+			fileType:  o.fileType,
+			content:   contents[o.depotFile],
+			movedFile: o.movedFile,
+		})
+		rev := len(s.files[o.depotFile])
+		c.files = append(c.files, fileRev{depotFile: o.depotFile, rev: rev, action: o.action})
+		delete(s.opened[c.client], o.depotFile)
+		r.out("%s %s#%d", o.action, o.depotFile, rev)
+		if hasFlag(flags, "r") && !isDeleted(o.action) {
+			s.opened[c.client][o.depotFile] = &openedFile{depotFile: o.depotFile, rev: rev, action: "edit", fileType: o.fileType, user: o.user}
+		}
+	}
+
+	for _, job := range sortedKeys(c.jobs) {
+		s.setJobStatus(job, c.jobs[job])
+		r.out("%s fixed by change %d.", job, c.number)
+	}
+
+	if number != c.number {
+		r.out("Change %d renamed change %d and submitted.", number, c.number)
+	} else {
+		r.out("Change %d submitted.", c.number)
+	}
+}
+
+// p4 diff [-d<flags>] [-f] file...
+func (s *Server) cmdDiff(r *request) {
+	flags, args := parseFlags(r.args, "d")
+	if len(args) <= 0 {
+		args = []string{"//" + r.client + "/..."}
+	}
+	mods := flags["d"]
+	for _, arg := range args {
+		var files []*openedFile
+		if hasFlag(flags, "f") {
+			depotFile, _, ok := s.depotSyntax(r.client, arg)
+			if ok {
+				for _, f := range s.match(depotFile) {
+					files = append(files, &openedFile{depotFile: f, rev: len(s.files[f]), action: "edit"})
+				}
+			}
+		} else {
+			files = s.matchOpened(r.client, arg)
+		}
+		if len(files) <= 0 {
+			r.warn("%s - file(s) not opened on this client.", arg)
+			continue
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].depotFile < files[j].depotFile })
+		for _, o := range files {
+			local, _ := s.localPath(r.client, o.depotFile)
+			var base []byte
+			if o.rev > 0 {
+				base = s.files[o.depotFile][o.rev-1].content
+			}
+			content, err := os.ReadFile(local)
+			if err != nil {
+				r.warn("%s - file(s) not in client view.", local)
+				continue
+			}
+			r.out("==== %s#%d - %s ====", o.depotFile, o.rev, local)
+			sum := diffSummary(string(base), string(content), mods)
+			if strings.Contains(mods, "s") {
+				r.out("add %d chunks %d lines", sum.addChunks, sum.addLines)
+				r.out("deleted %d chunks %d lines", sum.delChunks, sum.delLines)
+				r.out("changed %d chunks %d / %d lines", sum.chgChunks, sum.chgOldLines, sum.chgNewLines)
+			}
+		}
+	}
+}
+
+// p4 reconcile [-c changelist] [-e -a -d] [-n] [-m] [-I] [-f] [file...]
+// p4 status [-c changelist] [-e -a -d] [-m] [-I] [-f] [file...]
+//	-m is accepted: the content of the files is always compared.
+//	The P4IGNORE file is .p4ignore at the workspace root: one pattern per line
+//	matching a file or directory name or a path relative to the root.
+func (s *Server) cmdReconcile(r *request) {
+	flags, args := parseFlags(r.args, "c")
+	v, err := s.viewMap(r.client)
+	if err != nil {
+		r.fail("%v", err)
+		return
+	}
+	change := 0
+	if id, ok := flags["c"]; ok {
+		change, _ = strconv.Atoi(id)
+		if c, ok := s.changes[change]; !ok || c.status != "pending" {
+			r.fail("Change %s unknown.", id)
+			return
+		}
+	}
+	preview := r.cmd == "status" || hasFlag(flags, "n")
+	edits, adds, deletes := hasFlag(flags, "e"), hasFlag(flags, "a"), hasFlag(flags, "d")
+	if !edits && !adds && !deletes {
+		edits, adds, deletes = true, true, true
+	}
+	var ignore []string
+	if !hasFlag(flags, "I") {
+		ignore = ignorePatterns(v.Root)
+	}
+
+	// Workspace files: depot file -> local path
+	local := make(map[string]string)
+	filepath.WalkDir(v.Root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == v.Root {
+			return nil
+		}
+		if rel, _ := filepath.Rel(v.Root, path); isIgnored(ignore, filepath.ToSlash(rel)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if depotFile, ok := v.LocalToDepot(path); ok && !d.IsDir() {
+			local[depotFile] = path
+		}
+		return nil
+	})
+
+	for _, arg := range args {
+		pattern, _, ok := s.depotSyntax(r.client, arg)
+		if !ok {
+			r.warn("%s - file(s) not in client view.", arg)
+			continue
+		}
+		re := wildcardRegexp(pattern)
+		actions := make(map[string]string) // depot file -> action
+		var added, deleted []string
+		for _, f := range sortedKeys(local) {
+			if !re.MatchString(f) || s.opened[r.client][f] != nil {
+				continue
+			}
+			head := s.head(f)
+			if head == nil || isDeleted(head.action) {
+				if !adds {
+					continue
+				}
+				if strings.ContainsAny(filepath.Base(local[f]), "@#%*") && !hasFlag(flags, "f") {
+					r.warn("%s - can't add filenames with wildcards [@#%%*] in them. Use -f option to force add.", local[f])
+					continue
+				}
+				actions[f] = "add"
+				added = append(added, f)
+				continue
+			}
+			if content, err := os.ReadFile(local[f]); edits && err == nil && !bytes.Equal(content, head.content) {
+				actions[f] = "edit"
+			}
+		}
+		if deletes {
+			for _, f := range s.match(pattern) {
+				head := s.head(f)
+				if _, mapped := v.DepotToLocal(f); !mapped || isDeleted(head.action) || s.opened[r.client][f] != nil {
+					continue
+				}
+				if _, exists := local[f]; !exists {
+					actions[f] = "delete"
+					deleted = append(deleted, f)
+				}
+			}
+		}
+
+		// Moves: a deleted file added elsewhere with the same content
+		moved := make(map[string]string)
+		for _, d := range deleted {
+			for _, a := range added {
+				content, _ := os.ReadFile(local[a])
+				if len(moved[a]) <= 0 && bytes.Equal(content, s.head(d).content) {
+					moved[a], moved[d] = d, a
+					actions[a], actions[d] = "move/add", "move/delete"
+					break
+				}
+			}
+		}
+
+		if len(actions) <= 0 {
+			r.warn("%s - no file(s) to reconcile.", arg)
+			continue
+		}
+		for _, f := range sortedKeys(actions) {
+			o := &openedFile{depotFile: f, action: actions[f], fileType: "text", change: change, user: r.user, movedFile: moved[f]}
+			if head := s.head(f); head != nil && !isDeleted(head.action) {
+				o.rev, o.fileType = len(s.files[f]), head.fileType
+			}
+			path, ok := local[f]
+			if !ok {
+				path, _ = v.DepotToLocal(f)
+			}
+			if !preview {
+				if s.opened[r.client] == nil {
+					s.opened[r.client] = make(map[string]*openedFile)
+				}
+				s.opened[r.client][f] = o
+			}
+			if r.ztag {
+				cl := "default"
+				if change > 0 {
+					cl = strconv.Itoa(change)
+				}
+				fields := []string{"depotFile", f, "clientFile", path, "workRev", strconv.Itoa(o.rev), "action", o.action, "change", cl, "type", o.fileType}
+				if len(o.movedFile) > 0 {
+					fields = append(fields, "movedFile", o.movedFile)
+				}
+				r.tag(fields...)
+				continue
+			}
+			rev := "none"
+			if o.rev > 0 {
+				rev = strconv.Itoa(o.rev)
+			}
+			if preview {
+				r.out("%s#%s - reconcile to %s", f, rev, o.action)
+			} else {
+				r.out("%s#%s - opened for %s", f, rev, o.action)
+			}
+		}
+	}
+}
+
+// p4 edit [-c changelist] [-n] [-t filetype] file...
+func (s *Server) cmdEdit(r *request) {
+	flags, args := parseFlags(r.args, "ct")
+	change := 0
+	if id, ok := flags["c"]; ok {
+		change, _ = strconv.Atoi(id)
+	}
+	for _, arg := range args {
+		pattern, _, ok := s.depotSyntax(r.client, arg)
+		var files []string
+		if ok {
+			for _, f := range s.match(pattern) {
+				if _, mapped := s.localPath(r.client, f); mapped && !isDeleted(s.head(f).action) {
+					files = append(files, f)
+				}
+			}
+		}
+		if len(files) <= 0 {
+			r.warn("%s - file(s) not on client.", arg)
+			continue
+		}
+		for _, f := range files {
+			if o := s.opened[r.client][f]; o != nil {
+				r.out("%s#%d - currently opened for %s", f, o.rev, o.action)
+				continue
+			}
+			if hasFlag(flags, "n") {
+				r.out("%s#%d - opened for edit", f, len(s.files[f]))
+				continue
+			}
+			if err := s.open(r.client, "edit", f, change); err != nil {
+				r.fail("%v", err)
+				return
+			}
+			o := s.opened[r.client][f]
+			o.user = r.user
+			if t, ok := flags["t"]; ok {
+				o.fileType = t
+			}
+			r.out("%s#%d - opened for edit", f, o.rev)
+		}
+	}
+}
+
+// p4 move [-c changelist] [-f] [-k] [-n] [-t filetype] from to
+//	The wildcards of the source and the target must match.
+func (s *Server) cmdMove(r *request) {
+	flags, args := parseFlags(r.args, "ct")
+	if len(args) != 2 {
+		r.fail("Usage: move [-c changelist# -f -k -n -t filetype] from to")
+		return
+	}
+	from, _, okFrom := s.depotSyntax(r.client, args[0])
+	to, _, okTo := s.depotSyntax(r.client, args[1])
+	if !okFrom || !okTo {
+		r.fail("%s - file(s) not in client view.", args[0])
+		return
+	}
+	change := -1 // unchanged
+	if id, ok := flags["c"]; ok {
+		change, _ = strconv.Atoi(id)
+		if c, ok := s.changes[change]; !ok || c.status != "pending" {
+			r.fail("Change %s unknown.", id)
+			return
+		}
+	}
+
+	// Source files opened for edit or add, and their target
+	re := wildcardRegexp(from)
+	targets := make(map[string]string)
+	for _, o := range s.matchOpened(r.client, args[0]) {
+		if o.action != "edit" && o.action != "add" && o.action != "move/add" {
+			continue
+		}
+		m := re.FindStringSubmatch(o.depotFile)
+		if m == nil {
+			continue
+		}
+		targets[o.depotFile] = replaceWildcards(to, m[1:])
+	}
+	if len(targets) <= 0 {
+		r.fail("%s - file(s) not opened for edit.", args[0])
+		return
+	}
+	for _, f := range sortedKeys(targets) {
+		target := targets[f]
+		if head := s.head(target); head != nil && !isDeleted(head.action) && !hasFlag(flags, "f") {
+			r.fail("%s - can't move to an existing file", target)
+			continue
+		}
+		if s.opened[r.client][target] != nil {
+			r.fail("%s - can't move to a file opened for %s", target, s.opened[r.client][target].action)
+			continue
+		}
+		o := s.opened[r.client][f]
+		rev := "none"
+		if o.rev > 0 {
+			rev = strconv.Itoa(o.rev)
+		}
+		r.out("%s#%s - moved from %s#%s", target, rev, f, rev)
+		if hasFlag(flags, "n") {
+			continue
+		}
+
+		if !hasFlag(flags, "k") {
+			src, _ := s.localPath(r.client, f)
+			dst, ok := s.localPath(r.client, target)
+			if ok {
+				if err := os.MkdirAll(filepath.Dir(dst), 0755); err == nil {
+					os.Rename(src, dst)
+				}
+			}
+		}
+		if change >= 0 {
+			o.change = change
+		}
+		if t, ok := flags["t"]; ok {
+			o.fileType = t
+		}
+		delete(s.opened[r.client], f)
+		source := f
+		if o.action == "move/add" { // moved again: the source is the original one
+			source = o.movedFile
+			if d := s.opened[r.client][source]; d != nil {
+				d.movedFile = target
+			}
+		}
+		if o.action == "add" {
+			s.opened[r.client][target] = &openedFile{depotFile: target, action: "add", fileType: o.fileType, change: o.change, user: r.user}
+			continue
+		}
+		s.opened[r.client][target] = &openedFile{depotFile: target, action: "move/add", fileType: o.fileType, change: o.change, user: r.user, movedFile: source}
+		if source == f {
+			s.opened[r.client][f] = &openedFile{depotFile: f, rev: o.rev, action: "move/delete", fileType: o.fileType, change: o.change, user: r.user, movedFile: target}
+		}
+	}
+}
+
+// p4 revert [-c changelist] [-k] file...
+//	The workspace files are restored to the revision opened (left as is with -k),
+//	the ones of the adds are left. Both sides of a move are reverted.
+func (s *Server) cmdRevert(r *request) {
+	flags, args := parseFlags(r.args, "c")
+	for _, arg := range args {
+		var files []*openedFile
+		for _, o := range s.matchOpened(r.client, arg) {
+			if id, ok := flags["c"]; !ok || id == strconv.Itoa(o.change) || (id == "default" && o.change == 0) {
+				files = append(files, o)
+			}
+		}
+		if len(files) <= 0 {
+			r.warn("%s - file(s) not opened on this client.", arg)
+			continue
+		}
+		for _, o := range files {
+			if o.action == "move/add" || o.action == "move/delete" {
+				if other := s.opened[r.client][o.movedFile]; other != nil {
+					files = append(files, other)
+				}
+			}
+		}
+		for _, o := range files {
+			if s.opened[r.client][o.depotFile] != o {
+				continue // reverted with the other side of a move
+			}
+			delete(s.opened[r.client], o.depotFile)
+			local, mapped := s.localPath(r.client, o.depotFile)
+			switch {
+			case o.action == "add":
+				r.out("%s#none - was add, abandoned", o.depotFile)
+				continue
+			case o.action == "move/add" && !hasFlag(flags, "k") && mapped:
+				os.Remove(local)
+			case o.rev > 0 && !hasFlag(flags, "k") && mapped:
+				writeFile(local, s.files[o.depotFile][o.rev-1].content)
+			}
+			rev := "none"
+			if o.rev > 0 {
+				rev = strconv.Itoa(o.rev)
+			}
+			r.out("%s#%s - was %s, reverted", o.depotFile, rev, o.action)
+		}
+	}
+}
+
+// Replace the wildcards of a pattern by values, in order
+func replaceWildcards(pattern string, values []string) string {
+	var sb strings.Builder
+	n := 0
+	for i := 0; i < len(pattern); {
+		switch {
+		case strings.HasPrefix(pattern[i:], "...") || pattern[i] == '*':
+			if n < len(values) {
+				sb.WriteString(values[n])
+			}
+			n++
+			if pattern[i] == '*' {
+				i++
+			} else {
+				i += 3
+			}
+		default:
+			sb.WriteByte(pattern[i])
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// p4 lock [-c changelist] [file...]
+// p4 unlock [-c changelist | -x] [-f] [file...]
+//	-x unlocks the files locked in any workspace, like -f.
+func (s *Server) cmdLock(r *request) {
+	flags, args := parseFlags(r.args, "c")
+	change := 0
+	if id, ok := flags["c"]; ok {
+		change, _ = strconv.Atoi(id)
+	}
+	lock := r.cmd == "lock"
+	anyClient := !lock && (hasFlag(flags, "f") || hasFlag(flags, "x"))
+
+	var files []*openedFile
+	clients := []string{r.client}
+	if anyClient {
+		clients = s.openedClients()
+	}
+	for _, client := range clients {
+		if len(args) <= 0 {
+			files = append(files, s.openedIn(client, change)...)
+		}
+		for _, arg := range args {
+			for _, o := range s.matchOpened(client, arg) {
+				if _, ok := flags["c"]; !ok || o.change == change {
+					files = append(files, o)
+				}
+			}
+		}
+	}
+	if len(files) <= 0 {
+		r.fail("%s - file(s) not opened on this client.", strings.Join(args, " "))
+		return
+	}
+
+	for _, o := range files {
+		switch {
+		case lock && o.locked:
+			r.out("%s - already locked", o.depotFile)
+		case lock:
+			if locks := s.lockedBy(o.depotFile, r.client); len(locks) > 0 {
+				r.warn("%s - already locked by %s@%s", o.depotFile, s.opened[locks[0]][o.depotFile].user, locks[0])
+				continue
+			}
+			o.locked = true
+			r.out("%s - locking", o.depotFile)
+		case o.locked:
+			o.locked = false
+			r.out("%s - unlocking", o.depotFile)
+		case !anyClient && len(args) > 0:
+			r.warn("%s - file(s) not locked.", o.depotFile)
+		}
+	}
+}
+
+// p4 opened [-a] [-c changelist] [-u user] [-C client] [-m max] [file...]
+func (s *Server) cmdOpened(r *request) {
+	flags, args := parseFlags(r.args, "cuCm")
+	max, _ := strconv.Atoi(flags["m"])
+
+	clients := []string{r.client}
+	if client, ok := flags["C"]; ok {
+		clients = []string{client}
+	} else if hasFlag(flags, "a") {
+		clients = s.openedClients()
+	}
+
+	n := 0
+	for _, client := range clients {
+		var files []*openedFile
+		if len(args) <= 0 {
+			for _, o := range s.opened[client] {
+				files = append(files, o)
+			}
+			sort.Slice(files, func(i, j int) bool { return files[i].depotFile < files[j].depotFile })
+		}
+		for _, arg := range args {
+			files = append(files, s.matchOpened(client, arg)...)
+		}
+		v, _ := s.viewMap(client)
+		for _, o := range files {
+			if id, ok := flags["c"]; ok && id != strconv.Itoa(o.change) && !(id == "default" && o.change == 0) {
+				continue
+			}
+			if user, ok := flags["u"]; ok && user != o.user {
+				continue
+			}
+			if max > 0 && n >= max {
+				return
+			}
+			n++
+			cl, change := "default", "default change"
+			if o.change > 0 {
+				cl, change = strconv.Itoa(o.change), fmt.Sprintf("change %d", o.change)
+			}
+			rev := "none"
+			if o.rev > 0 {
+				rev = strconv.Itoa(o.rev)
+			}
+			if !r.ztag {
+				locked := ""
+				if o.locked {
+					locked = " *locked*"
+				}
+				r.out("%s#%s - %s %s (%s) by %s@%s%s", o.depotFile, rev, o.action, change, o.fileType, o.user, client, locked)
+				continue
+			}
+			clientFile := ""
+			if v != nil {
+				clientFile, _ = v.DepotToClient(o.depotFile)
+			}
+			fields := []string{"depotFile", o.depotFile, "clientFile", clientFile, "rev", rev, "haveRev", rev,
+				"action", o.action, "change", cl, "type", o.fileType, "user", o.user, "client", client}
+			if len(o.movedFile) > 0 {
+				fields = append(fields, "movedFile", o.movedFile)
+			}
+			if o.locked && client == r.client {
+				fields = append(fields, "ourLock", "")
+			} else if o.locked {
+				fields = append(fields, "otherLock", "")
+			}
+			r.tag(fields...)
+		}
+	}
+	if n <= 0 {
+		r.warn("%s - file(s) not opened on this client.", strings.Join(args, " "))
+	}
+}
+
+// p4 -ztag fstat file...
+//	The have revision is the head revision if the workspace file exists.
+func (s *Server) cmdFstat(r *request) {
+	_, args := parseFlags(r.args, "")
+	for _, arg := range args {
+		pattern, revSpec, ok := s.depotSyntax(r.client, arg)
+		var files []string
+		if ok {
+			files = s.match(pattern)
+			for f := range s.opened[r.client] {
+				if _, exists := s.files[f]; !exists && wildcardRegexp(pattern).MatchString(f) {
+					files = append(files, f) // opened for add
+				}
+			}
+			sort.Strings(files)
+		}
+		if len(files) <= 0 {
+			r.warn("%s - no such file(s).", arg)
+			continue
+		}
+		for _, f := range files {
+			fields := []string{"depotFile", f}
+			local, mapped := s.localPath(r.client, f)
+			if mapped {
+				fields = append(fields, "clientFile", local)
+			}
+			if rev := s.revision(r.client, f, revSpec); rev > 0 {
+				rv := s.files[f][rev-1]
+				fields = append(fields, "headAction", rv.action, "headType", rv.fileType,
+					"headTime", strconv.FormatInt(s.changes[rv.change].time.Unix(), 10),
+					"headRev", strconv.Itoa(rev), "headChange", strconv.Itoa(rv.change))
+				if _, err := os.Stat(local); mapped && err == nil && !isDeleted(rv.action) {
+					fields = append(fields, "haveRev", strconv.Itoa(len(s.files[f])))
+				}
+			}
+			if o := s.opened[r.client][f]; o != nil {
+				cl := "default"
+				if o.change > 0 {
+					cl = strconv.Itoa(o.change)
+				}
+				fields = append(fields, "action", o.action, "actionOwner", o.user, "change", cl, "type", o.fileType)
+				if o.locked {
+					fields = append(fields, "ourLock", "")
+				}
+			}
+			var others, locks []string
+			for _, c := range s.openedClients() {
+				if o := s.opened[c][f]; o != nil && c != r.client {
+					others = append(others, o.user+"@"+c, o.action, strconv.Itoa(o.change))
+					if o.locked {
+						locks = append(locks, o.user+"@"+c)
+					}
+				}
+			}
+			for i := 0; i < len(others)/3; i++ {
+				n := strconv.Itoa(i)
+				fields = append(fields, "otherOpen"+n, others[3*i], "otherAction"+n, others[3*i+1], "otherChange"+n, others[3*i+2])
+			}
+			if len(others) > 0 {
+				fields = append(fields, "otherOpen", strconv.Itoa(len(others)/3))
+			}
+			for i, l := range locks {
+				fields = append(fields, "otherLock"+strconv.Itoa(i), l)
+			}
+			if len(locks) > 0 {
+				fields = append(fields, "otherLock", "")
+			}
+			r.tag(fields...)
+		}
+	}
+}
+
+// Patterns of the .p4ignore file at the root of a workspace
+func ignorePatterns(root string) (patterns []string) {
+	content, err := os.ReadFile(filepath.Join(root, ".p4ignore"))
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) > 0 && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, strings.Trim(line, "/"))
+		}
+	}
+	return patterns
+}
+
+// Whether a path relative to the workspace root matches one of the ignore patterns
+func isIgnored(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, filepath.Base(rel)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(p, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFlag(flags map[string]string, name string) bool {
+	_, ok := flags[name]
+	return ok
+}
+
+// Read and parse a spec from stdin
+func (s *Server) readSpec(r *request) (spec *perforce.Spec, ok bool) {
+	if r.stdin == nil {
+		r.fail("Error in %s specification - no input.", r.cmd)
+		return nil, false
+	}
+	in, err := io.ReadAll(r.stdin)
+	if err != nil {
+		r.fail("%v", err)
+		return nil, false
+	}
+	spec, err = perforce.ParseSpec(string(in))
+	if err != nil {
+		r.fail("Error in %s specification.\n%v", r.cmd, err)
+		return nil, false
+	}
+	return spec, true
+}
@@ -0,0 +1,125 @@
+package perforcetest
+
+// Line diff summary as reported by p4 diff -ds, line matching for p4 annotate
+
+import (
+	"strings"
+)
+
+type summary struct {
+	addChunks   int
+	addLines    int
+	delChunks   int
+	delLines    int
+	chgChunks   int
+	chgOldLines int
+	chgNewLines int
+}
+
+// Diff two texts line by line.
+//	mods are the p4 diff -d modifiers: l ignore line endings, b ignore changes in
+//	whitespace, w ignore all whitespace.
+func diffSummary(old string, new string, mods string) (sum summary) {
+	a, b := splitLines(old, mods), splitLines(new, mods)
+	lcs := lcsTable(a, b)
+
+	// Walk the edit script: a chunk is a run of deleted and/or added lines
+	del, add := 0, 0
+	flush := func() {
+		switch {
+		case del > 0 && add > 0:
+			sum.chgChunks++
+			sum.chgOldLines += del
+			sum.chgNewLines += add
+		case del > 0:
+			sum.delChunks++
+			sum.delLines += del
+		case add > 0:
+			sum.addChunks++
+			sum.addLines += add
+		}
+		del, add = 0, 0
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			i++
+			j++
+		case j >= len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			del++
+			i++
+		default:
+			add++
+			j++
+		}
+	}
+	flush()
+
+	return sum
+}
+
+// Longest common subsequence: lcs[i][j] is the length of the one of a[i:] and b[j:]
+func lcsTable(a []string, b []string) (lcs [][]int) {
+	lcs = make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	return lcs
+}
+
+// Line of a matching each line of b, -1 for the added lines
+func matchLines(a []string, b []string) (match []int) {
+	lcs := lcsTable(a, b)
+	match = make([]int, len(b))
+	i, j := 0, 0
+	for j < len(b) {
+		switch {
+		case i < len(a) && a[i] == b[j]:
+			match[j] = i
+			i++
+			j++
+		case i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			match[j] = -1
+			j++
+		}
+	}
+	return match
+}
+
+func splitLines(text string, mods string) (lines []string) {
+	if len(text) <= 0 {
+		return nil
+	}
+	lines = strings.SplitAfter(text, "\n")
+	if len(lines[len(lines)-1]) <= 0 {
+		lines = lines[:len(lines)-1]
+	}
+	for i, l := range lines {
+		if strings.Contains(mods, "l") {
+			l = strings.TrimRight(l, "\r\n")
+		}
+		switch {
+		case strings.Contains(mods, "w"):
+			l = strings.Join(strings.Fields(l), "")
+		case strings.Contains(mods, "b"):
+			l = strings.Join(strings.Fields(l), " ")
+		}
+		lines[i] = l
+	}
+	return lines
+}
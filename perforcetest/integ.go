@@ -0,0 +1,206 @@
+package perforcetest
+
+// Integrations: p4 copy/merge of streams, p4 istat and p4 interchanges.
+//
+// Integration records aren't kept: a file needs integrating when its source head
+// revision is more recent (later changelist) than its target one and the contents
+// differ. Once the target is submitted with the content of the source, the file
+// is integrated.
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+
+	perforce "github.com/fabdem/go-perforce"
+)
+
+// Integration of a file: source and target depot files (escaped)
+type integ struct {
+	from string
+	to   string
+}
+
+// Files to integrate from a source to a target, sorted by source.
+//	target maps a source file to its target, false if it isn't mapped.
+func (s *Server) pendingIntegs(sources []string, target func(string) (string, bool)) (integs []integ) {
+	for _, from := range sources {
+		to, ok := target(from)
+		if !ok {
+			continue
+		}
+		src, dst := s.head(from), s.head(to)
+		if src == nil || isDeleted(src.action) {
+			continue
+		}
+		if dst != nil && (dst.change >= src.change || bytes.Equal(dst.content, src.content)) {
+			continue
+		}
+		integs = append(integs, integ{from: from, to: to})
+	}
+	sort.Slice(integs, func(i, j int) bool { return integs[i].from < integs[j].from })
+	return integs
+}
+
+// Files to integrate between a stream and its parent, false if the stream or its parent doesn't exist.
+//	toParent: from the stream to its parent (copy), from the parent to the stream otherwise (merge)
+func (s *Server) streamIntegs(name string, toParent bool) (integs []integ, ok bool) {
+	stream, ok := s.specs["stream"][name]
+	if !ok {
+		return nil, false
+	}
+	parent := stream.Get("Parent")
+	if _, ok := s.specs["stream"][parent]; !ok {
+		return nil, false
+	}
+	from, to := name, parent
+	if !toParent {
+		from, to = parent, name
+	}
+	return s.pendingIntegs(s.match(from+"/..."), func(f string) (string, bool) {
+		return to + strings.TrimPrefix(f, from), true
+	}), true
+}
+
+// p4 copy [-n] [-c changelist] -S stream
+// p4 merge [-n] [-c changelist] -S stream
+//	copy integrates the stream into its parent, merge the parent into the stream.
+//	The targets are opened for integrate (branch if new) in the workspace with the
+//	content of their source: there is nothing to resolve.
+func (s *Server) cmdStreamInteg(r *request) {
+	flags, _ := parseFlags(r.args, "cS")
+	name := flags["S"]
+	integs, ok := s.streamIntegs(name, r.cmd == "copy")
+	if !ok {
+		r.fail("Stream '%s' or its parent doesn't exist.", name)
+		return
+	}
+	change := 0
+	if id, ok := flags["c"]; ok {
+		change, _ = strconv.Atoi(id)
+		if c, ok := s.changes[change]; !ok || c.status != "pending" {
+			r.fail("Change %s unknown.", id)
+			return
+		}
+	}
+	if len(integs) <= 0 {
+		r.warn("All revision(s) already integrated.")
+		return
+	}
+
+	for _, i := range integs {
+		local, mapped := s.localPath(r.client, i.to)
+		if !mapped {
+			r.fail("%s - file(s) not in client view.", i.to)
+			continue
+		}
+		if o := s.opened[r.client][i.to]; o != nil {
+			r.fail("%s - can't %s (already opened for %s)", i.to, r.cmd, o.action)
+			continue
+		}
+		src := s.head(i.from)
+		rev, action, how := "none", "branch", "branch/sync"
+		if dst := s.head(i.to); dst != nil && !isDeleted(dst.action) {
+			rev, action, how = strconv.Itoa(len(s.files[i.to])), "integrate", "sync/integrate"
+		}
+		r.out("%s#%s - %s from %s#%d", i.to, rev, how, i.from, len(s.files[i.from]))
+		if hasFlag(flags, "n") {
+			continue
+		}
+		if err := writeFile(local, src.content); err != nil {
+			r.fail("%s - %v", i.to, err)
+			continue
+		}
+		if s.opened[r.client] == nil {
+			s.opened[r.client] = make(map[string]*openedFile)
+		}
+		o := &openedFile{depotFile: i.to, action: action, fileType: src.fileType, change: change, user: r.user}
+		if action == "integrate" {
+			o.rev = len(s.files[i.to])
+		}
+		s.opened[r.client][i.to] = o
+	}
+}
+
+// p4 -ztag istat stream
+func (s *Server) cmdIstat(r *request) {
+	_, args := parseFlags(r.args, "")
+	if len(args) <= 0 {
+		r.fail("Usage: istat [ -a -c -r -s ] stream")
+		return
+	}
+	toParent, ok := s.streamIntegs(args[0], true)
+	if !ok {
+		r.fail("Stream '%s' or its parent doesn't exist.", args[0])
+		return
+	}
+	fromParent, _ := s.streamIntegs(args[0], false)
+	stream := s.specs["stream"][args[0]]
+	r.tag("stream", args[0], "parent", stream.Get("Parent"), "type", stream.Get("Type"),
+		"integToParent", strconv.FormatBool(len(toParent) > 0), "integToParentHow", "copy",
+		"integFromParent", strconv.FormatBool(len(fromParent) > 0), "integFromParentHow", "merge")
+}
+
+// p4 -ztag interchanges -l [-r] -b branch [file...]
+//	Changes of the source revisions more recent than the head of the target.
+func (s *Server) cmdInterchanges(r *request) {
+	flags, args := parseFlags(r.args, "b")
+	spec, ok := s.specs["branch"][flags["b"]]
+	if !ok {
+		r.fail("No such branch '%s'.", flags["b"])
+		return
+	}
+	v, err := perforce.ParseViewMap(spec.GetLines("View"))
+	if err != nil {
+		r.fail("Error in branch specification.\n%v", err)
+		return
+	}
+	target := v.DepotToClient
+	if hasFlag(flags, "r") {
+		target = v.ClientToDepot
+	}
+	var sources []string
+	for f := range s.files {
+		sources = append(sources, f)
+	}
+	integs := s.pendingIntegs(sources, func(f string) (string, bool) {
+		to, ok := target(f)
+		if !ok || len(args) <= 0 {
+			return to, ok
+		}
+		for _, a := range args {
+			if wildcardRegexp(a).MatchString(to) {
+				return to, true
+			}
+		}
+		return to, false
+	})
+
+	changes := make(map[int]bool)
+	for _, i := range integs {
+		after := 0
+		if dst := s.head(i.to); dst != nil {
+			after = dst.change
+		}
+		for _, rv := range s.files[i.from] {
+			if rv.change > after {
+				changes[rv.change] = true
+			}
+		}
+	}
+	if len(changes) <= 0 {
+		r.fail("All revision(s) already integrated.")
+		return
+	}
+	var numbers []int
+	for cl := range changes {
+		numbers = append(numbers, cl)
+	}
+	sort.Ints(numbers)
+	for _, cl := range numbers {
+		c := s.changes[cl]
+		r.tag("change", strconv.Itoa(cl), "time", strconv.FormatInt(c.time.Unix(), 10), "user", c.user,
+			"client", c.client, "status", c.status, "changeType", c.changeType, "desc", c.description)
+	}
+}
@@ -0,0 +1,764 @@
+// Package perforcetest provides an in-memory fake Perforce server for hermetic tests.
+//
+// The fake implements perforce.Runner: it interprets the p4 command lines built by
+// the perforce package and answers like the p4 command line client would, including
+// error paths such as "no such file(s)." or "No files to submit.".
+//
+// It holds depot files with their revisions, workspaces (clients), changelists and
+// opened files. Workspace files are real files under the workspace root.
+// The seeding functions take file names as is (i.e. //depot/icon@2x.png); they're
+// stored and reported escaped (//depot/icon%402x.png) like a real server does.
+//
+//	srv := perforcetest.NewServer()
+//	srv.AddClient("my_ws", root, "//depot/... //my_ws/...")
+//	srv.AddFile("//depot/a.txt", "text", "line 1\n")
+//	srv.Open("my_ws", "edit", "//depot/a.txt", 0)
+//	p4 := srv.Perforce("a_user", "my_ws")
+package perforcetest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	perforce "github.com/fabdem/go-perforce"
+)
+
+// Server - fake Perforce server
+type Server struct {
+	mu         sync.Mutex
+	now        time.Time
+	nextChange int
+	nextJob    int
+	files      map[string][]*revision               // depot file -> revisions, index 0 is #1
+	changes    map[int]*change                      // changelists
+	clients    map[string]*perforce.Spec            // workspaces
+	specs      map[string]map[string]*perforce.Spec // other specs: type -> name -> spec
+	labels     map[string]map[string]int            // label -> depot file -> revision tagged
+	opened     map[string]map[string]*openedFile    // client -> depot file -> opened file
+	failures   map[string][]failure                 // command -> failures to return
+	commands   [][]string                           // command lines received
+}
+
+type revision struct {
+	change    int
+	action    string
+	fileType  string
+	content   []byte
+	movedFile string // other side of a move/add or move/delete
+}
+
+type change struct {
+	number      int
+	user        string
+	client      string
+	status      string // pending or submitted
+	changeType  string // public or restricted
+	description string
+	time        time.Time
+	files       []fileRev         // submitted files
+	jobs        map[string]string // jobs fixed -> status set on submit, "" for closed
+}
+
+type fileRev struct {
+	depotFile string
+	rev       int
+	action    string
+}
+
+type openedFile struct {
+	depotFile string
+	rev       int // revision opened (have revision), 0 for an add
+	action    string
+	fileType  string
+	change    int // 0 for default changelist
+	user      string
+	movedFile string // other side of a move/add or move/delete
+	locked    bool
+}
+
+type failure struct {
+	output   string
+	exitCode int
+}
+
+// Key field of each spec type
+var specKeys = map[string]string{
+	"label":  "Label",
+	"branch": "Branch",
+	"stream": "Stream",
+	"job":    "Job",
+	"user":   "User",
+	"group":  "Group",
+	"depot":  "Depot",
+}
+
+// NewServer()
+//	Create an empty server.
+func NewServer() *Server {
+	return &Server{
+		now:        time.Date(2020, 9, 20, 21, 2, 41, 0, time.FixedZone("PDT", -7*3600)),
+		nextChange: 1,
+		nextJob:    1,
+		files:      make(map[string][]*revision),
+		changes:    make(map[int]*change),
+		clients:    make(map[string]*perforce.Spec),
+		specs:      make(map[string]map[string]*perforce.Spec),
+		labels:     make(map[string]map[string]int),
+		opened:     make(map[string]map[string]*openedFile),
+		failures:   make(map[string][]failure),
+	}
+}
+
+// Perforce()
+//	Create a perforce instance talking to this server.
+func (s *Server) Perforce(user string, workspace string) *perforce.Perforce {
+	return perforce.NewWithRunner(user, workspace, s)
+}
+
+// AddClient()
+//	Create a workspace.
+//	In:
+//		- workspace name
+//		- root, local directory where the workspace files are
+//		- view lines i.e. "//depot/main/... //my_ws/..."
+func (s *Server) AddClient(name string, root string, view ...string) (err error) {
+	if _, err = perforce.ParseViewMap(view); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	spec := s.defaultClient(name, "admin")
+	spec.Set("Root", root)
+	spec.SetLines("View", view)
+	s.clients[name] = spec
+	return nil
+}
+
+// AddFile()
+//	Submit a new revision of a file (add, or edit if it exists) in its own changelist.
+//	An empty filetype keeps the current one, or text for a new file.
+//	Returns the changelist number.
+func (s *Server) AddFile(depotFile string, fileType string, content string) (changelist int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	depotFile = perforce.EscapePath(depotFile)
+	action := "add"
+	if revs := s.files[depotFile]; len(revs) > 0 {
+		if !isDeleted(revs[len(revs)-1].action) {
+			action = "edit"
+		}
+		if len(fileType) <= 0 {
+			fileType = revs[len(revs)-1].fileType
+		}
+	}
+	if len(fileType) <= 0 {
+		fileType = "text"
+	}
+	return s.submitRevision(depotFile, &revision{action: action, fileType: fileType, content: []byte(content)})
+}
+
+// DeleteFile()
+//	Submit a deleted revision of a file in its own changelist.
+//	Returns the changelist number.
+func (s *Server) DeleteFile(depotFile string) (changelist int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	depotFile = perforce.EscapePath(depotFile)
+	fileType := "text"
+	if revs := s.files[depotFile]; len(revs) > 0 {
+		fileType = revs[len(revs)-1].fileType
+	}
+	return s.submitRevision(depotFile, &revision{action: "delete", fileType: fileType})
+}
+
+func (s *Server) submitRevision(depotFile string, r *revision) (changelist int) {
+	c := s.newChange("admin", "admin_ws", r.action+" "+depotFile)
+	c.status = "submitted"
+	r.change = c.number
+	s.files[depotFile] = append(s.files[depotFile], r)
+	c.files = append(c.files, fileRev{depotFile: depotFile, rev: len(s.files[depotFile]), action: r.action})
+	return c.number
+}
+
+// CreateChange()
+//	Create a pending changelist.
+//	Returns the changelist number.
+func (s *Server) CreateChange(user string, client string, description string) (changelist int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.newChange(user, client, description).number
+}
+
+// Open()
+//	Open a file in a workspace: action is add, edit or delete.
+//	Changelist 0 is the default changelist.
+//	The head revision of a file opened for edit is written in the workspace
+//	if the workspace file doesn't exist yet (as if it was synced).
+func (s *Server) Open(client string, action string, depotFile string, changelist int) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.open(client, action, perforce.EscapePath(depotFile), changelist)
+}
+
+// Open a file (escaped) in a workspace
+func (s *Server) open(client string, action string, depotFile string, changelist int) (err error) {
+	if _, ok := s.clients[client]; !ok {
+		return fmt.Errorf("Client '%s' unknown", client)
+	}
+	if changelist > 0 {
+		if c, ok := s.changes[changelist]; !ok || c.status != "pending" {
+			return fmt.Errorf("Change %d unknown", changelist)
+		}
+	}
+
+	o := &openedFile{depotFile: depotFile, action: action, change: changelist, user: "admin", fileType: "text"}
+	head := s.head(depotFile)
+	switch action {
+	case "add":
+		if head != nil && !isDeleted(head.action) {
+			return fmt.Errorf("%s - can't add existing file", depotFile)
+		}
+	case "edit", "delete":
+		if head == nil || isDeleted(head.action) {
+			return fmt.Errorf("%s - no such file(s)", depotFile)
+		}
+		o.rev = len(s.files[depotFile])
+		o.fileType = head.fileType
+		if action == "edit" {
+			if local, ok := s.localPath(client, depotFile); ok {
+				if _, err := os.Stat(local); os.IsNotExist(err) {
+					if err = writeFile(local, head.content); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("Invalid action: %s", action)
+	}
+	if isExclusive(o.fileType) {
+		for other, files := range s.opened {
+			if _, ok := files[depotFile]; ok && other != client {
+				return fmt.Errorf("%s - can't %s exclusive file already opened", depotFile, action)
+			}
+		}
+	}
+
+	if s.opened[client] == nil {
+		s.opened[client] = make(map[string]*openedFile)
+	}
+	s.opened[client][depotFile] = o
+	return nil
+}
+
+// Sync()
+//	Write the head revision of all the files mapped in a workspace under its root.
+func (s *Server) Sync(client string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for depotFile := range s.files {
+		head := s.head(depotFile)
+		if head == nil || isDeleted(head.action) {
+			continue
+		}
+		if local, ok := s.localPath(client, depotFile); ok {
+			if err = writeFile(local, head.content); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FileContent()
+//	Returns the content of a revision of a file, 0 for head revision.
+func (s *Server) FileContent(depotFile string, rev int) (content string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revs := s.files[perforce.EscapePath(depotFile)]
+	if rev <= 0 {
+		rev = len(revs)
+	}
+	if rev <= 0 || rev > len(revs) {
+		return "", false
+	}
+	return string(revs[rev-1].content), true
+}
+
+// Fail()
+//	Make the next call of a command (i.e. "submit") fail with the output and exit code given.
+//	Calls to Fail() for the same command are queued.
+func (s *Server) Fail(command string, output string, exitCode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[command] = append(s.failures[command], failure{output: output, exitCode: exitCode})
+}
+
+// Commands()
+//	Returns the command lines received so far.
+func (s *Server) Commands() (commands [][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.commands {
+		commands = append(commands, append([]string{}, c...))
+	}
+	return commands
+}
+
+// ---------------------------------------
+// Command line processing
+
+// A command being processed
+type request struct {
+	user     string
+	client   string
+	ztag     bool
+	cmd      string
+	args     []string
+	stdin    io.Reader
+	stdout   bytes.Buffer
+	stderr   bytes.Buffer
+	exitCode int
+}
+
+// Output to stdout
+func (r *request) out(format string, a ...interface{}) {
+	fmt.Fprintf(&r.stdout, format+"\n", a...)
+}
+
+// Warning to stderr, exit code unchanged
+func (r *request) warn(format string, a ...interface{}) {
+	fmt.Fprintf(&r.stderr, format+"\n", a...)
+}
+
+// Error to stderr, exit code 1
+func (r *request) fail(format string, a ...interface{}) {
+	r.warn(format, a...)
+	r.exitCode = 1
+}
+
+// Tagged output record
+func (r *request) tag(fields ...string) {
+	for i := 0; i+1 < len(fields); i += 2 {
+		r.out("... %s %s", fields[i], fields[i+1])
+	}
+	r.out("")
+}
+
+// Run()
+//	Run a p4 command line - implements perforce.Runner.
+func (s *Server) Run(args []string, stdin io.Reader) (stdout []byte, stderr []byte, exitCode int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.commands = append(s.commands, append([]string{}, args...))
+
+	r := &request{stdin: stdin}
+	argFile := ""
+	batchSize := 128 // p4 default
+
+	// Global options
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		opt := args[0]
+		args = args[1:]
+		value := ""
+		switch opt[:2] {
+		case "-u", "-c", "-p", "-P", "-H", "-C", "-d", "-L", "-r", "-v", "-Q", "-z", "-x", "-b":
+			if opt == "-ztag" {
+				r.ztag = true
+				continue
+			}
+			value = strings.TrimSpace(opt[2:])
+			if len(value) <= 0 && len(args) > 0 {
+				value, args = args[0], args[1:]
+			}
+		}
+		switch opt[:2] {
+		case "-u":
+			r.user = value
+		case "-c":
+			r.client = value
+		case "-z":
+			r.ztag = value == "tag"
+		case "-x":
+			argFile = value
+		case "-b":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				batchSize = n
+			}
+		}
+	}
+	if len(args) <= 0 {
+		return nil, []byte("Usage: p4 [options] command [arg ...]\n"), 1, nil
+	}
+	r.cmd, r.args = args[0], args[1:]
+
+	// Arguments read from a file or stdin
+	var fileArgs []string
+	if len(argFile) > 0 {
+		var in io.Reader
+		if argFile == "-" {
+			in = r.stdin
+			r.stdin = nil
+		} else {
+			f, err := os.Open(argFile)
+			if err != nil {
+				return nil, []byte(fmt.Sprintf("Can't open argument file '%s'.\n", argFile)), 1, nil
+			}
+			defer f.Close()
+			in = f
+		}
+		if in != nil {
+			scanner := bufio.NewScanner(in)
+			for scanner.Scan() {
+				if line := strings.TrimRight(scanner.Text(), "\r"); len(line) > 0 {
+					fileArgs = append(fileArgs, line)
+				}
+			}
+		}
+	}
+	if len(r.user) <= 0 {
+		r.user = "admin"
+	}
+
+	// Injected failures
+	if f := s.failures[r.cmd]; len(f) > 0 {
+		s.failures[r.cmd] = f[1:]
+		return nil, []byte(f[0].output), f[0].exitCode, nil
+	}
+
+	handler, ok := commands[r.cmd]
+	if !ok {
+		r.fail("Unknown command.  Try 'p4 help' for info.")
+	} else if len(argFile) <= 0 {
+		handler(s, r)
+	} else {
+		// Like p4, the command runs once per batch of -b arguments of the file
+		cmdArgs := r.args
+		for start := 0; start == 0 || start < len(fileArgs); start += batchSize {
+			end := start + batchSize
+			if end > len(fileArgs) {
+				end = len(fileArgs)
+			}
+			r.args = append(append([]string{}, cmdArgs...), fileArgs[start:end]...)
+			handler(s, r)
+		}
+	}
+
+	return r.stdout.Bytes(), r.stderr.Bytes(), r.exitCode, nil
+}
+
+// Parse command flags.
+//	valued: flags taking a value, i.e. "cdt" for -c 12, -d"desc", -t type
+//	Flags without value can be grouped (-kq). A value may be in the same
+//	argument (-c12, "-m 1") or the next one (-c 12).
+//	Returns flags and the remaining arguments.
+func parseFlags(args []string, valued string) (flags map[string]string, rest []string) {
+	flags = make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if !strings.HasPrefix(a, "-") || len(a) < 2 || strings.HasPrefix(a, "//") {
+			return flags, args[i:]
+		}
+		if strings.HasPrefix(a, "--") { // long option i.e. --parallel=threads=4
+			name, value := a[2:], ""
+			if j := strings.Index(name, "="); j >= 0 {
+				name, value = name[:j], name[j+1:]
+			}
+			flags[name] = value
+			continue
+		}
+		name := a[1:2]
+		if strings.Contains(valued, name) {
+			value := strings.TrimSpace(a[2:])
+			if len(a) == 2 && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			flags[name] = value
+			continue
+		}
+		for _, c := range a[1:] {
+			flags[string(c)] = ""
+		}
+	}
+	return flags, nil
+}
+
+// ---------------------------------------
+// Server data helpers
+
+func (s *Server) tick() time.Time {
+	s.now = s.now.Add(time.Second)
+	return s.now
+}
+
+func (s *Server) newChange(user string, client string, description string) *change {
+	c := &change{
+		number:      s.nextChange,
+		user:        user,
+		client:      client,
+		status:      "pending",
+		changeType:  "public",
+		description: description,
+		time:        s.tick(),
+	}
+	s.nextChange++
+	s.changes[c.number] = c
+	return c
+}
+
+// Whether a filetype has the exclusive open modifier, i.e. binary+l
+func isExclusive(fileType string) bool {
+	i := strings.Index(fileType, "+")
+	return i >= 0 && strings.Contains(fileType[i+1:], "l")
+}
+
+// Workspaces with opened files, sorted
+func (s *Server) openedClients() (clients []string) {
+	for c := range s.opened {
+		clients = append(clients, c)
+	}
+	sort.Strings(clients)
+	return clients
+}
+
+// Workspaces (sorted) holding a lock on a file, but client
+func (s *Server) lockedBy(depotFile string, client string) (clients []string) {
+	for c, files := range s.opened {
+		if o, ok := files[depotFile]; ok && o.locked && c != client {
+			clients = append(clients, c)
+		}
+	}
+	sort.Strings(clients)
+	return clients
+}
+
+// Whether a revision or an opened file removes the file
+func isDeleted(action string) bool {
+	return action == "delete" || action == "move/delete"
+}
+
+// Head revision of a file, nil if it doesn't exist
+func (s *Server) head(depotFile string) *revision {
+	revs := s.files[depotFile]
+	if len(revs) <= 0 {
+		return nil
+	}
+	return revs[len(revs)-1]
+}
+
+// View of a workspace
+func (s *Server) viewMap(client string) (v *perforce.ViewMap, err error) {
+	spec, ok := s.clients[client]
+	if !ok {
+		return nil, fmt.Errorf("Client '%s' unknown - use 'client' command to create it.", client)
+	}
+	v, err = perforce.ParseViewMap(spec.GetLines("View"))
+	if err != nil {
+		return nil, err
+	}
+	v.Client = client
+	v.Root = spec.Get("Root")
+	return v, nil
+}
+
+// Local path of a depot file in a workspace
+func (s *Server) localPath(client string, depotFile string) (local string, ok bool) {
+	v, err := s.viewMap(client)
+	if err != nil {
+		return "", false
+	}
+	return v.DepotToLocal(depotFile)
+}
+
+// Convert a file argument in depot syntax. Client and local syntax are translated
+// through the workspace view. The revision specifier (#rev, @change) is returned apart.
+func (s *Server) depotSyntax(client string, arg string) (depotFile string, revSpec string, ok bool) {
+	if i := strings.IndexAny(arg, "#@"); i >= 0 {
+		arg, revSpec = arg[:i], arg[i:]
+	}
+	if strings.HasPrefix(arg, "//") {
+		if !strings.HasPrefix(arg, "//"+client+"/") || len(client) <= 0 {
+			return arg, revSpec, true
+		}
+		if v, err := s.viewMap(client); err == nil {
+			depotFile, ok = v.ClientToDepot(arg)
+			return depotFile, revSpec, ok
+		}
+		return arg, revSpec, true
+	}
+	v, err := s.viewMap(client)
+	if err != nil {
+		return "", revSpec, false
+	}
+	arg = perforce.UnescapePath(arg) // local file name
+	if abs, err := filepath.Abs(arg); err == nil {
+		arg = abs
+	}
+	depotFile, ok = v.LocalToDepot(arg)
+	return depotFile, revSpec, ok
+}
+
+// Revision number of a file for a revision specifier: #n, #head, #have, #none, @change, @label, @date
+// 0 if the file has no such revision
+func (s *Server) revision(client string, depotFile string, revSpec string) int {
+	revs := s.files[depotFile]
+	switch {
+	case len(revSpec) <= 0 || revSpec == "#head":
+		return len(revs)
+	case revSpec == "#none":
+		return 0
+	case revSpec == "#have":
+		if o, ok := s.opened[client][depotFile]; ok {
+			return o.rev
+		}
+		return len(revs)
+	case strings.HasPrefix(revSpec, "#"):
+		rev, err := strconv.Atoi(revSpec[1:])
+		if err != nil || rev > len(revs) {
+			return 0
+		}
+		return rev
+	case strings.HasPrefix(revSpec, "@"):
+		if files, ok := s.labels[revSpec[1:]]; ok {
+			return files[depotFile]
+		}
+		cl, err := strconv.Atoi(revSpec[1:])
+		if err != nil {
+			return s.revisionAtDate(revs, revSpec[1:])
+		}
+		rev := 0
+		for i, r := range revs {
+			if r.change <= cl {
+				rev = i + 1
+			}
+		}
+		return rev
+	}
+	return 0
+}
+
+// Last revision submitted at a date (yyyy/mm/dd[:hh:mm:ss] server local time), 0 if none
+func (s *Server) revisionAtDate(revs []*revision, date string) int {
+	var at time.Time
+	var err error
+	if at, err = time.ParseInLocation("2006/01/02:15:04:05", date, s.now.Location()); err != nil {
+		if at, err = time.ParseInLocation("2006/01/02", date, s.now.Location()); err != nil {
+			return 0
+		}
+	}
+	rev := 0
+	for i, r := range revs {
+		if c, ok := s.changes[r.change]; ok && !c.time.After(at) {
+			rev = i + 1
+		}
+	}
+	return rev
+}
+
+// Depot files matching a pattern (wildcards ... and *), sorted
+func (s *Server) match(pattern string) (files []string) {
+	if !strings.ContainsAny(pattern, "*") && !strings.Contains(pattern, "...") {
+		if _, ok := s.files[pattern]; ok {
+			return []string{pattern}
+		}
+		return nil
+	}
+	re := wildcardRegexp(pattern)
+	for f := range s.files {
+		if re.MatchString(f) {
+			files = append(files, f)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Regex matching a Perforce pattern, with a group for each wildcard
+func wildcardRegexp(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); {
+		switch {
+		case strings.HasPrefix(pattern[i:], "..."):
+			sb.WriteString("(.*)")
+			i += 3
+		case pattern[i] == '*':
+			sb.WriteString("([^/]*)")
+			i++
+		default:
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			i++
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
+
+// Opened files of a workspace matching a file argument, sorted
+func (s *Server) matchOpened(client string, arg string) (files []*openedFile) {
+	depotFile, _, ok := s.depotSyntax(client, arg)
+	if !ok {
+		return nil
+	}
+	re := wildcardRegexp(depotFile)
+	for f, o := range s.opened[client] {
+		if re.MatchString(f) {
+			files = append(files, o)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].depotFile < files[j].depotFile })
+	return files
+}
+
+// Opened files of a workspace in a changelist, sorted
+func (s *Server) openedIn(client string, changelist int) (files []*openedFile) {
+	for _, o := range s.opened[client] {
+		if o.change == changelist {
+			files = append(files, o)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].depotFile < files[j].depotFile })
+	return files
+}
+
+func writeFile(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// Keys of a map, sorted
+func sortedKeys(m map[string]string) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Perforce date format
+func p4Date(t time.Time) string {
+	return t.Format("2006/01/02 15:04:05")
+}
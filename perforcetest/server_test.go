@@ -0,0 +1,115 @@
+package perforcetest_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/fabdem/go-perforce/perforcetest"
+)
+
+// Run a command line, returns the output (stdout then stderr) and the exit code
+func run(t *testing.T, srv *perforcetest.Server, stdin string, args ...string) (out string, exitCode int) {
+	var in io.Reader
+	if len(stdin) > 0 {
+		in = strings.NewReader(stdin)
+	}
+	stdout, stderr, exitCode, err := srv.Run(args, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(stdout) + string(stderr), exitCode
+}
+
+func TestSeeding(t *testing.T) {
+	srv := perforcetest.NewServer()
+	root := t.TempDir()
+	if err := srv.AddClient("ws", root, "//depot/... //ws/..."); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.AddClient("bad", root, "depot/..."); err == nil {
+		t.Errorf("invalid view: no error")
+	}
+	c1 := srv.AddFile("//depot/icon@2x.png", "binary", "1")
+	c2 := srv.AddFile("//depot/icon@2x.png", "binary", "2")
+	if c2 != c1+1 {
+		t.Errorf("changelists %d %d", c1, c2)
+	}
+	if content, ok := srv.FileContent("//depot/icon@2x.png", 1); !ok || content != "1" {
+		t.Errorf("#1: %q %t", content, ok)
+	}
+	if content, ok := srv.FileContent("//depot/icon@2x.png", 0); !ok || content != "2" {
+		t.Errorf("head: %q %t", content, ok)
+	}
+
+	// Names are reported escaped
+	out, code := run(t, srv, "", "-u", "bob", "files", "//depot/...")
+	if want := "//depot/icon%402x.png#2 - edit change " + strconv.Itoa(c2) + " (binary)\n"; code != 0 || out != want {
+		t.Errorf("%d %q, want %q", code, out, want)
+	}
+
+	if err := srv.Sync("ws"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(root, "icon@2x.png")); err != nil || string(b) != "2" {
+		t.Errorf("synced: %q %v", b, err)
+	}
+	srv.DeleteFile("//depot/icon@2x.png")
+	if err := srv.Open("ws", "edit", "//depot/icon@2x.png", 0); err == nil {
+		t.Errorf("edit of a deleted file: no error")
+	}
+	if err := srv.Open("other", "add", "//depot/x.txt", 0); err == nil {
+		t.Errorf("unknown client: no error")
+	}
+	if err := srv.Open("ws", "add", "//depot/x.txt", 99); err == nil {
+		t.Errorf("unknown changelist: no error")
+	}
+}
+
+// Failures are queued per command and used once
+func TestFail(t *testing.T) {
+	srv := perforcetest.NewServer()
+	srv.Fail("info", "Connect to server failed; check $P4PORT.\n", 1)
+	srv.Fail("info", "Perforce password (P4PASSWD) invalid or unset.\n", 2)
+
+	if out, code := run(t, srv, "", "-ztag", "info"); code != 1 || !strings.HasPrefix(out, "Connect to server failed") {
+		t.Errorf("1st: %d %q", code, out)
+	}
+	if out, code := run(t, srv, "", "depots"); code != 1 || !strings.Contains(out, "Unknown command") {
+		t.Errorf("unknown command: %d %q", code, out)
+	}
+	if out, code := run(t, srv, "", "info"); code != 2 || !strings.Contains(out, "P4PASSWD") {
+		t.Errorf("2nd: %d %q", code, out)
+	}
+	if out, code := run(t, srv, "", "info"); code != 0 || !strings.Contains(out, "Server version") {
+		t.Errorf("after the failures: %d %q", code, out)
+	}
+}
+
+// Command lines are recorded as received, the arguments of -x - are read from stdin
+func TestCommands(t *testing.T) {
+	srv := perforcetest.NewServer()
+	srv.AddClient("ws", t.TempDir(), "//depot/... //ws/...")
+	srv.AddFile("//depot/a.txt", "text", "a\n")
+	srv.AddFile("//depot/b.txt", "text", "b\n")
+
+	out, code := run(t, srv, "//depot/a.txt\n//depot/b.txt\n", "-u", "bob", "-c", "ws", "-ztag", "-x", "-", "where")
+	if code != 0 || strings.Count(out, "... depotFile ") != 2 {
+		t.Errorf("%d %q", code, out)
+	}
+	if _, code = run(t, srv, ""); code != 1 {
+		t.Errorf("no command: %d", code)
+	}
+
+	commands := srv.Commands()
+	if len(commands) != 2 || strings.Join(commands[0], " ") != "-u bob -c ws -ztag -x - where" || len(commands[1]) != 0 {
+		t.Errorf("%q", commands)
+	}
+	commands[0][0] = "changed"
+	if srv.Commands()[0][0] != "-u" {
+		t.Errorf("commands not copied")
+	}
+}
@@ -0,0 +1,139 @@
+package perforce
+
+// Reconcile - open the files modified in a workspace without being checked out.
+//
+//	files, err := p4.Status(perforce.ReconcileOptions{})	// what would be opened
+//	files, err = p4.Reconcile(perforce.ReconcileOptions{Changelist: 1234})
+//
+// The files matching the P4IGNORE files are skipped unless NoIgnore is set.
+// Without file arguments the whole workspace is reconciled.
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ReconcileOptions - p4 reconcile and p4 status options.
+// None of Edits, Adds and Deletes set: all of them are detected.
+type ReconcileOptions struct {
+	Edits          bool // modified files (-e)
+	Adds           bool // files not in the depot (-a)
+	Deletes        bool // files deleted from the workspace (-d)
+	Preview        bool // report the actions without opening the files (-n) - Status() always previews
+	ModTime        bool // files which modification time changed are checked for changes (-m)
+	NoIgnore       bool // don't skip the files matching the P4IGNORE files (-I)
+	AllowWildcards bool // add files which names contain wildcards (-f)
+	Changelist     int  // changelist the files are opened in (-c), 0 for the default changelist
+}
+
+// File opened (or to be opened) by p4 reconcile
+type T_ReconcileFile struct {
+	DepotFile  string
+	ClientFile string // local path
+	Rev        int    // revision in the workspace, 0 for an add
+	Action     string // add, edit, delete, move/add or move/delete
+	FileType   string
+	Change     int    // 0 for the default changelist
+	MovedFile  string // other side of a move: source of a move/add, target of a move/delete
+}
+
+// Nothing to reconcile
+var nothingToReconcilePattern = regexp.MustCompile(`no file\(s\) to reconcile|file\(s\) up-to-date`)
+
+// Reconcile()
+//	Open for add, edit, delete or move the workspace files modified outside of
+//	Perforce: p4 reconcile [-c changelist] [-e -a -d] [-n] [-m] [-I] [-f] [file...]
+//	Server 2012.1 or later (see Supports()).
+// 	Input:
+//		- options
+//		- optional workspace files (depot, client or local syntax), the whole workspace if none
+//  Return:
+//		- files opened (to be opened with Preview) - none if the workspace is up-to-date
+//		- err code, nil if okay
+func (p *Perforce) Reconcile(opts ReconcileOptions, files ...FileSpec) (res []T_ReconcileFile, err error) {
+	p.logThis(fmt.Sprintf("Reconcile(%+v, %v)", opts, files))
+
+	return p.reconcile("Reconcile()", "reconcile", opts, files)
+}
+
+// Status()
+//	Files of the workspace modified outside of Perforce, i.e. which Reconcile()
+//	would open: p4 status [-c changelist] [-e -a -d] [-m] [-I] [-f] [file...]
+//	Nothing is opened. Server 2012.1 or later (see Supports()).
+func (p *Perforce) Status(opts ReconcileOptions, files ...FileSpec) (res []T_ReconcileFile, err error) {
+	p.logThis(fmt.Sprintf("Status(%+v, %v)", opts, files))
+
+	opts.Preview = false // p4 status never opens the files, no -n
+	return p.reconcile("Status()", "status", opts, files)
+}
+
+func (p *Perforce) reconcile(caller string, cmd string, opts ReconcileOptions, files []FileSpec) (res []T_ReconcileFile, err error) {
+	if err = p.requireFeature(caller, FeatureReconcile); err != nil {
+		return res, err
+	}
+
+	args := []string{"-ztag", cmd}
+	if opts.Changelist > 0 {
+		args = append(args, "-c", strconv.Itoa(opts.Changelist))
+	}
+	for _, o := range []struct {
+		set  bool
+		flag string
+	}{
+		{opts.Edits, "-e"}, {opts.Adds, "-a"}, {opts.Deletes, "-d"}, {opts.Preview, "-n"},
+		{opts.ModTime, "-m"}, {opts.NoIgnore, "-I"}, {opts.AllowWildcards, "-f"},
+	} {
+		if o.set {
+			args = append(args, o.flag)
+		}
+	}
+
+	var fileArgs []string
+	for _, f := range files {
+		arg, err := p.fileSpecArg(f)
+		if err != nil {
+			return res, err
+		}
+		fileArgs = append(fileArgs, arg)
+	}
+	if len(fileArgs) <= 0 {
+		if len(p.workspace) <= 0 {
+			return res, fmt.Errorf("%s - No workspace and no file specified", caller)
+		}
+		fileArgs = []string{"//" + p.workspace + "/..."}
+	}
+
+	out, err := p.execP4Files(args, fileArgs)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	records, messages := parseZtag(out)
+	if err != nil && !allBenign(messages, nothingToReconcilePattern) {
+		return res, p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	for _, r := range records {
+		if len(r["depotFile"]) <= 0 || len(r["action"]) <= 0 {
+			continue
+		}
+		f := T_ReconcileFile{
+			DepotFile:  UnescapePath(r["depotFile"]),
+			ClientFile: r["clientFile"],
+			Action:     r["action"],
+			FileType:   r["type"],
+		}
+		if len(r["movedFile"]) > 0 {
+			f.MovedFile = UnescapePath(r["movedFile"])
+		}
+		f.Rev, _ = strconv.Atoi(r["workRev"])
+		if f.Action == "add" || f.Action == "move/add" {
+			f.Rev = 0
+		}
+		f.Change, _ = strconv.Atoi(strings.TrimSpace(r["change"])) // "default" -> 0
+		res = append(res, f)
+	}
+
+	return res, nil
+}
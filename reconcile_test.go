@@ -0,0 +1,100 @@
+package perforce_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	perforce "github.com/fabdem/go-perforce"
+	"github.com/fabdem/go-perforce/perforcetest"
+)
+
+// Workspace ws modified outside of Perforce: a.txt edited, lib/c.txt moved to
+// moved.txt, new.txt and a file with a wildcard added, tmp/ ignored.
+func newReconcileServer(t *testing.T) (srv *perforcetest.Server, p *perforce.Perforce, root string) {
+	srv, p = newChangeServer(t)
+	srv.AddFile("//depot/lib/c.txt", "text", "c\n")
+	if err := srv.Sync("ws"); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := p.GetWorkspaceProperties("ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root = ws.Root
+	for name, content := range map[string]string{"a.txt": "a\nb\n", "moved.txt": "c\n", "new.txt": "new\n", "v@2.txt": "v\n",
+		"tmp/t.txt": "tmp\n", ".p4ignore": "tmp/\n.p4ignore\n"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755)
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Remove(filepath.Join(root, "lib", "c.txt")); err != nil {
+		t.Fatal(err)
+	}
+	return srv, p, root
+}
+
+func TestReconcilePreview(t *testing.T) {
+	srv, p, root := newReconcileServer(t)
+
+	res, err := p.Reconcile(perforce.ReconcileOptions{Preview: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []perforce.T_ReconcileFile{
+		{DepotFile: "//depot/a.txt", ClientFile: filepath.Join(root, "a.txt"), Rev: 1, Action: "edit", FileType: "text"},
+		{DepotFile: "//depot/lib/c.txt", ClientFile: filepath.Join(root, "lib", "c.txt"), Rev: 1, Action: "move/delete", FileType: "text", MovedFile: "//depot/moved.txt"},
+		{DepotFile: "//depot/moved.txt", ClientFile: filepath.Join(root, "moved.txt"), Action: "move/add", FileType: "text", MovedFile: "//depot/lib/c.txt"},
+		{DepotFile: "//depot/new.txt", ClientFile: filepath.Join(root, "new.txt"), Action: "add", FileType: "text"},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("%+v", res)
+	}
+	if cmd := lastCommand(srv); cmd != "reconcile -n //ws/..." {
+		t.Errorf("%s", cmd)
+	}
+
+	// Status is a preview too, without -n: nothing was opened
+	if res, err = p.Status(perforce.ReconcileOptions{Preview: true}); err != nil || !reflect.DeepEqual(res, want) {
+		t.Errorf("status: %+v %v", res, err)
+	}
+	if cmd := lastCommand(srv); cmd != "status //ws/..." {
+		t.Errorf("%s", cmd)
+	}
+
+	// Adds only, of the files with wildcards and the ignored ones
+	if res, err = p.Status(perforce.ReconcileOptions{Adds: true, AllowWildcards: true, NoIgnore: true}); err != nil || len(res) != 5 {
+		t.Errorf("-a -f -I: %+v %v", res, err)
+	}
+	if res, err = p.Status(perforce.ReconcileOptions{Deletes: true}, perforce.NewFileSpec(filepath.Join(root, "lib", "c.txt"), perforce.RevSpec{})); err != nil ||
+		len(res) != 1 || res[0].Action != "delete" || res[0].DepotFile != "//depot/lib/c.txt" {
+		t.Errorf("-d: %+v %v", res, err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	srv, p, _ := newReconcileServer(t)
+	cl := srv.CreateChange("bob", "ws", "reconcile")
+
+	res, err := p.Reconcile(perforce.ReconcileOptions{Edits: true, Changelist: cl})
+	if err != nil || len(res) != 1 || res[0].DepotFile != "//depot/a.txt" || res[0].Action != "edit" || res[0].Change != cl {
+		t.Fatalf("%+v %v", res, err)
+	}
+	if cmd := lastCommand(srv); cmd != "reconcile -c "+strconv.Itoa(cl)+" -e //ws/..." {
+		t.Errorf("%s", cmd)
+	}
+	if c, err := p.GetCLContent(cl); err != nil || !reflect.DeepEqual(c.List, map[string]perforce.T_CLFileProperties{"//depot/a.txt": {Rev: 1, Action: "edit"}}) {
+		t.Errorf("opened: %+v %v", c.List, err)
+	}
+
+	// Up-to-date: nothing and no error
+	if res, err = p.Reconcile(perforce.ReconcileOptions{Edits: true}); err != nil || len(res) != 0 {
+		t.Errorf("up-to-date: %+v %v", res, err)
+	}
+	if _, err = p.Reconcile(perforce.ReconcileOptions{Changelist: 999}); err == nil {
+		t.Errorf("unknown changelist: no error")
+	}
+}
@@ -0,0 +1,202 @@
+package perforce
+
+// Redaction of secrets and sensitive data in traces and error messages.
+//
+// Traces (logThis(), slog logger, hooks) and errors embed p4 command lines and
+// output. Before they leave the package the following is masked:
+//	- passwords and tickets: -P option, P4PASSWD=, Password: field of user specs,
+//	  tickets (any 32 hex digits - file digests are masked too),
+//	- the data matching the patterns of the policy,
+//	- optionally changelist descriptions and file contents.
+//
+//	p4 = p4.WithRedactPolicy(perforce.RedactPolicy{
+//		Patterns:     []*regexp.Regexp{regexp.MustCompile(`token=(\S+)`)},
+//		Descriptions: true,
+//	})
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const redactMask = "********"
+
+// RedactPolicy - what is masked in traces and error messages.
+// The zero value masks passwords and tickets only.
+type RedactPolicy struct {
+	Disabled     bool             // no redaction at all, passwords and tickets included
+	Patterns     []*regexp.Regexp // data to mask: the submatches if the pattern has groups, else the whole match
+	Descriptions bool             // mask changelist descriptions
+	FileContents bool             // mask file contents (p4 print, diff and annotate output)
+}
+
+// Passwords and tickets - the submatches are masked
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?:^|[\s\[])-P\s*([^\s\]]+)`),
+	regexp.MustCompile(`P4PASSWD=(\S+)`),
+	regexp.MustCompile(`(?m)^Password:[ \t]+(\S+)`),
+	regexp.MustCompile(`\b([0-9A-F]{32})\b`),
+}
+
+// Changelist descriptions in forms, describe and tagged output
+var descriptionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?m)^Description:[ \t]*\n((?:\t[^\n]*(?:\n|$))+)`),
+	regexp.MustCompile(`(?m)^Change \d+ by \S+ on [^\n]*\n\n((?:\t[^\n]*(?:\n|$))+)`),
+	regexp.MustCompile(`(?m)^\.\.\. desc ([^\n]*)`),
+}
+
+// Diff output lines
+var diffContentPattern = regexp.MustCompile(`(?m)^[<>] ([^\n]*)`)
+
+// Annotated lines (p4 annotate -u)
+var annotateContentPattern = regexp.MustCompile(`(?m)^\d+(?:-\d+)?: \S+ \d{4}/\d\d/\d\d ([^\n]*)`)
+
+// Header of a file in p4 print output
+var printHeaderPattern = regexp.MustCompile(`^//[^\n]*#\d+ - \S+ change \d+ \([^)]*\)$`)
+
+// SetRedactPolicy()
+//	Set what is masked in traces and error messages.
+//	Not safe if the instance is shared between goroutines - see WithRedactPolicy()
+func (p *Perforce) SetRedactPolicy(policy RedactPolicy) {
+	p.redactPolicy = policy
+}
+
+// GetRedactPolicy()
+func (p *Perforce) GetRedactPolicy() (policy RedactPolicy) {
+	return p.redactPolicy
+}
+
+// WithRedactPolicy()
+//	Returns a copy of the instance using another redaction policy.
+func (p *Perforce) WithRedactPolicy(policy RedactPolicy) *Perforce {
+	c := *p
+	c.redactPolicy = policy
+	return &c
+}
+
+// Redact()
+//	Returns text with the sensitive data masked according to the policy of the instance.
+func (p *Perforce) Redact(text string) string {
+	return p.redactPolicy.redact(text)
+}
+
+// Text with the sensitive data masked according to the policy
+func (policy RedactPolicy) redact(text string) string {
+	if policy.Disabled {
+		return text
+	}
+
+	if policy.FileContents {
+		text = maskPrintContent(text)
+		text = maskSubmatches(diffContentPattern, text)
+		text = maskSubmatches(annotateContentPattern, text)
+	}
+	if policy.Descriptions {
+		for _, re := range descriptionPatterns {
+			text = maskSubmatches(re, text)
+		}
+	}
+	for _, re := range secretPatterns {
+		text = maskSubmatches(re, text)
+	}
+	for _, re := range policy.Patterns {
+		text = maskSubmatches(re, text)
+	}
+	return text
+}
+
+// Mask the submatches of re in text, or the whole matches if re has no group
+func maskSubmatches(re *regexp.Regexp, text string) string {
+	matches := re.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) <= 0 {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		groups := m[2:]
+		if len(groups) <= 0 {
+			groups = m[:2]
+		}
+		for i := 0; i+1 < len(groups); i += 2 {
+			start, end := groups[i], groups[i+1]
+			if start < last || end <= start { // group not matched or nested
+				continue
+			}
+			// Multi-line values keep their layout: each line is masked
+			b.WriteString(text[last:start])
+			for j, line := range strings.Split(text[start:end], "\n") {
+				if j > 0 {
+					b.WriteString("\n")
+				}
+				if trimmed := strings.TrimLeft(line, "\t"); len(trimmed) > 0 {
+					b.WriteString(line[:len(line)-len(trimmed)] + redactMask)
+				}
+			}
+			last = end
+		}
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// Mask the content following each file header of p4 print output
+func maskPrintContent(text string) string {
+	lines := strings.Split(text, "\n")
+	inContent := false
+	for i, line := range lines {
+		switch {
+		case printHeaderPattern.MatchString(strings.TrimRight(line, "\r")):
+			inContent = true
+		case inContent && len(line) > 0:
+			lines[i] = redactMask
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Redacted copy of a command line
+func (p *Perforce) redactArgs(args []string) []string {
+	return p.redactPolicy.redactArgs(args)
+}
+
+func (policy RedactPolicy) redactArgs(args []string) []string {
+	if policy.Disabled {
+		return args
+	}
+
+	res := make([]string, len(args))
+	isCommand := false // past the global options
+	for i, a := range args {
+		switch {
+		case i > 0 && args[i-1] == "-P" && !isCommand:
+			res[i] = redactMask
+		case i > 0 && args[i-1] == "-d" && isCommand && policy.Descriptions:
+			res[i] = redactMask
+		case strings.HasPrefix(a, "-d ") && isCommand && policy.Descriptions:
+			res[i] = "-d " + redactMask // description in the same argument
+		default:
+			res[i] = policy.redact(a)
+		}
+		if !isCommand && !strings.HasPrefix(a, "-") && (i <= 0 || !globalOptionsWithValue[args[i-1]]) {
+			isCommand = true
+		}
+	}
+	return res
+}
+
+// Description as it can be traced
+func (p *Perforce) redactDescription(description string) string {
+	if p.redactPolicy.Descriptions && !p.redactPolicy.Disabled {
+		return redactMask
+	}
+	return description
+}
+
+// Error with the sensitive data masked
+func (p *Perforce) errorf(format string, a ...interface{}) error {
+	return errors.New(p.Redact(fmt.Sprintf(format, a...)))
+}
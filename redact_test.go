@@ -0,0 +1,80 @@
+package perforce_test
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	perforce "github.com/fabdem/go-perforce"
+	"github.com/fabdem/go-perforce/perforcetest"
+)
+
+func TestRedact(t *testing.T) {
+	token := regexp.MustCompile(`token=(\S+)`)
+	tests := []struct {
+		name   string
+		policy perforce.RedactPolicy
+		text   string
+		want   string
+	}{
+		{"password option", perforce.RedactPolicy{}, "[-P pass1234 -u bob login]", "[-P ******** -u bob login]"},
+		{"password option attached", perforce.RedactPolicy{}, "p4 -Ppass1234 info", "p4 -P******** info"},
+		{"P4PASSWD", perforce.RedactPolicy{}, "P4PASSWD=pass1234 p4 info", "P4PASSWD=******** p4 info"},
+		{"user spec", perforce.RedactPolicy{}, "User:\tbob\n\nPassword: pass1234\n", "User:\tbob\n\nPassword: ********\n"},
+		{"ticket", perforce.RedactPolicy{}, "ticket 0123456789ABCDEF0123456789ABCDEF expires", "ticket ******** expires"},
+		{"pattern with a group", perforce.RedactPolicy{Patterns: []*regexp.Regexp{token}}, "url?token=abc123 done", "url?token=******** done"},
+		{"pattern without group", perforce.RedactPolicy{Patterns: []*regexp.Regexp{regexp.MustCompile(`acme-\d+`)}}, "see acme-42.", "see ********."},
+		{"descriptions kept", perforce.RedactPolicy{}, "... desc secret plan\n", "... desc secret plan\n"},
+		{"change form", perforce.RedactPolicy{Descriptions: true},
+			"Change:\tnew\n\nDescription:\n\tsecret\n\tplan\n\nFiles:\n\t//depot/a.txt\t# edit\n",
+			"Change:\tnew\n\nDescription:\n\t********\n\t********\n\nFiles:\n\t//depot/a.txt\t# edit\n"},
+		{"describe", perforce.RedactPolicy{Descriptions: true},
+			"Change 3 by bob@ws on 2024/01/02 10:00:00\n\n\tsecret plan\n\nAffected files ...\n",
+			"Change 3 by bob@ws on 2024/01/02 10:00:00\n\n\t********\n\nAffected files ...\n"},
+		{"tagged", perforce.RedactPolicy{Descriptions: true}, "... change 3\n... desc secret plan\n", "... change 3\n... desc ********\n"},
+		{"print", perforce.RedactPolicy{FileContents: true},
+			"//depot/a.txt#2 - edit change 3 (text)\nline 1\n\nline 3\n",
+			"//depot/a.txt#2 - edit change 3 (text)\n********\n\n********\n"},
+		{"diff", perforce.RedactPolicy{FileContents: true}, "1c1\n< old\n---\n> new\n", "1c1\n< ********\n---\n> ********\n"},
+		{"annotate", perforce.RedactPolicy{FileContents: true}, "1: bob 2024/01/02 line 1\n", "1: bob 2024/01/02 ********\n"},
+		{"disabled", perforce.RedactPolicy{Disabled: true, Descriptions: true}, "-P pass1234 ... desc plan", "-P pass1234 ... desc plan"},
+	}
+	p := perforce.NewWithRunner("bob", "ws", nil)
+	for _, tt := range tests {
+		if got := p.WithRedactPolicy(tt.policy).Redact(tt.text); got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Errors, traces and hooks are redacted
+func TestRedactedOutputs(t *testing.T) {
+	srv := perforcetest.NewServer()
+	srv.AddClient("ws", t.TempDir(), "//depot/... //ws/...")
+	srv.AddFile("//depot/a.txt", "text", "a\n")
+
+	var logs bytes.Buffer
+	var args []string
+	p := srv.Perforce("bob", "ws").
+		WithRedactPolicy(perforce.RedactPolicy{Descriptions: true, Patterns: []*regexp.Regexp{regexp.MustCompile(`token=(\S+)`)}}).
+		WithHooks(perforce.Hooks{AfterCommand: func(e *perforce.CommandEvent) { args = e.Args }})
+	p.SetDebug(true, &logs)
+
+	srv.Fail("files", "Ticket 0123456789ABCDEF0123456789ABCDEF expired, token=abc123.\n", 1)
+	_, err := p.GetHeadRev("//depot/a.txt")
+	if err == nil || strings.Contains(err.Error(), "0123456789ABCDEF") || strings.Contains(err.Error(), "abc123") || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("%v", err)
+	}
+
+	srv.Fail("submit", "Submit failed.\n", 1)
+	if _, err = p.Submit(perforce.SubmitOptions{Description: "secret plan"}); err == nil {
+		t.Errorf("no error")
+	}
+	if strings.Join(args, " ") != "-u bob -c ws submit -d ********" {
+		t.Errorf("hook args %q", args)
+	}
+	if strings.Contains(logs.String(), "secret") || strings.Contains(logs.String(), "abc123") {
+		t.Errorf("%s", logs.String())
+	}
+}
@@ -0,0 +1,154 @@
+package perforce
+
+// Retry of the p4 commands failing with a transient error.
+//
+// Connection refused, connection reset, database locked... are retried with an
+// exponential backoff. Only the commands reading data (files, describe, print,
+// client -o...) are retried; commands modifying data such as submit are retried
+// only if listed in RetryPolicy.AlsoRetry since a failure may hide a success.
+//
+//	p4 = p4.WithRetryPolicy(perforce.DefaultRetryPolicy())
+
+import (
+	"math"
+	"math/rand"
+	"regexp"
+	"time"
+)
+
+// RetryPolicy - how p4 commands failing with a transient error are retried.
+// The zero value disables the retries.
+type RetryPolicy struct {
+	MaxAttempts  int                              // total number of attempts, <= 1 for no retry
+	InitialDelay time.Duration                    // delay before the first retry, 0 for 500ms
+	MaxDelay     time.Duration                    // max delay between 2 attempts, 0 for 30s
+	Multiplier   float64                          // delay growth between 2 retries, < 1 for 2
+	Jitter       float64                          // random variation of the delays, i.e. 0.2 for +/-20%
+	Retryable    func(out []byte, err error) bool // classification of the errors, nil for IsTransientError()
+	AlsoRetry    []string                         // commands retried although not read only, i.e. "submit"
+}
+
+// DefaultRetryPolicy()
+//	Returns a policy with 4 attempts, delays from 500ms to 30s and a 20% jitter.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:  4,
+		InitialDelay: 500 * time.Millisecond,
+		MaxDelay:     30 * time.Second,
+		Multiplier:   2,
+		Jitter:       0.2,
+	}
+}
+
+// Commands only reading data
+var readOnlyCommands = map[string]bool{
+	"info": true, "where": true, "print": true, "files": true, "fstat": true,
+	"describe": true, "filelog": true, "changes": true, "changelists": true,
+	"opened": true, "diff": true, "diff2": true, "dirs": true, "have": true,
+	"annotate": true, "sizes": true, "users": true, "clients": true, "workspaces": true,
+	"labels": true, "branches": true, "streams": true, "jobs": true, "fixes": true,
+	"interchanges": true, "istat": true, "depots": true, "groups": true, "status": true,
+	"cstat": true, "grep": true,
+}
+
+// Spec commands - read only with -o
+var specCommands = map[string]bool{
+	"client": true, "workspace": true, "change": true, "changelist": true,
+	"label": true, "branch": true, "stream": true, "job": true, "jobspec": true,
+	"user": true, "group": true, "depot": true,
+}
+
+// Transient errors
+var transientErrorPattern = regexp.MustCompile(`(?i)connect to server failed|connection refused|connection reset|` +
+	`tcp (?:connect|receive|send) failed|broken pipe|i/o timeout|database (?:is )?locked|` +
+	`lock wait timeout|deadlock|resource temporarily unavailable|server is (?:shutting down|too busy)|` +
+	`too many connections`)
+
+// IsTransientError()
+//	Default classification of the errors: true if the output or error of a failed
+//	p4 command report a transient condition (connection refused or reset, database locked...).
+func IsTransientError(out []byte, err error) bool {
+	if err == nil {
+		return false
+	}
+	return transientErrorPattern.Match(out) || transientErrorPattern.MatchString(err.Error())
+}
+
+// SetRetryPolicy()
+//	Set how commands failing with a transient error are retried.
+//	Not safe if the instance is shared between goroutines - see WithRetryPolicy()
+func (p *Perforce) SetRetryPolicy(policy RetryPolicy) {
+	p.retryPolicy = policy
+}
+
+// GetRetryPolicy()
+func (p *Perforce) GetRetryPolicy() (policy RetryPolicy) {
+	return p.retryPolicy
+}
+
+// WithRetryPolicy()
+//	Returns a copy of the instance using another retry policy.
+func (p *Perforce) WithRetryPolicy(policy RetryPolicy) *Perforce {
+	c := *p
+	c.retryPolicy = policy
+	return &c
+}
+
+// Whether a command line can be retried
+func (r RetryPolicy) retries(args []string) bool {
+	if r.MaxAttempts <= 1 {
+		return false
+	}
+	i := commandIndex(args)
+	if i >= len(args) {
+		return false
+	}
+	cmd := args[i]
+	for _, c := range r.AlsoRetry {
+		if c == cmd {
+			return true
+		}
+	}
+	if readOnlyCommands[cmd] {
+		return true
+	}
+	if specCommands[cmd] {
+		for _, a := range args[i+1:] {
+			if a == "-o" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Whether a failure is transient
+func (r RetryPolicy) retryable(out []byte, err error) bool {
+	if r.Retryable != nil {
+		return r.Retryable(out, err)
+	}
+	return IsTransientError(out, err)
+}
+
+// Delay before a retry: exponential backoff with jitter
+func (r RetryPolicy) delay(attempt int) time.Duration {
+	initial, max, mult := r.InitialDelay, r.MaxDelay, r.Multiplier
+	if initial <= 0 {
+		initial = 500 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 30 * time.Second
+	}
+	if mult < 1 {
+		mult = 2
+	}
+
+	d := float64(initial) * math.Pow(mult, float64(attempt-1))
+	if d > float64(max) {
+		d = float64(max)
+	}
+	if r.Jitter > 0 {
+		d *= 1 - r.Jitter + 2*r.Jitter*rand.Float64()
+	}
+	return time.Duration(d)
+}
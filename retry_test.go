@@ -0,0 +1,146 @@
+package perforce_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	perforce "github.com/fabdem/go-perforce"
+	"github.com/fabdem/go-perforce/perforcetest"
+)
+
+const connectFailed = "Perforce client error:\n\tConnect to server failed; check $P4PORT.\n\tTCP connect to perforce:1666 failed.\n"
+
+func newRetryServer(t *testing.T) (srv *perforcetest.Server, p *perforce.Perforce) {
+	srv = perforcetest.NewServer()
+	srv.AddClient("ws", t.TempDir(), "//depot/... //ws/...")
+	srv.AddFile("//depot/a.txt", "text", "a\n")
+	srv.AddFile("//depot/a.txt", "text", "b\n")
+	return srv, srv.Perforce("bob", "ws")
+}
+
+// The server fails twice then succeeds: retried after 20ms then 40ms
+func TestRetry(t *testing.T) {
+	srv, p := newRetryServer(t)
+	p = p.WithRetryPolicy(perforce.RetryPolicy{MaxAttempts: 3, InitialDelay: 20 * time.Millisecond, Multiplier: 2})
+	srv.Fail("files", connectFailed, 1)
+	srv.Fail("files", connectFailed, 1)
+
+	start := time.Now()
+	rev, err := p.GetHeadRev("//depot/a.txt")
+	if err != nil || rev != 2 {
+		t.Fatalf("%d %v", rev, err)
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("no backoff: %v", elapsed)
+	}
+	if files := commandsOf(srv, "files"); len(files) != 3 || files[2] != "-u bob -c ws files -e //depot/a.txt" {
+		t.Errorf("%q", files)
+	}
+
+	// Attempts exhausted: the last error is returned
+	for i := 0; i < 3; i++ {
+		srv.Fail("files", connectFailed, 1)
+	}
+	if _, err = p.GetHeadRev("//depot/a.txt"); err == nil || !strings.Contains(err.Error(), "Connect to server failed") {
+		t.Errorf("%v", err)
+	}
+	if files := commandsOf(srv, "files"); len(files) != 6 {
+		t.Errorf("%d attempts", len(files)-3)
+	}
+}
+
+// Delays are capped by MaxDelay
+func TestRetryMaxDelay(t *testing.T) {
+	srv, p := newRetryServer(t)
+	p = p.WithRetryPolicy(perforce.RetryPolicy{MaxAttempts: 3, InitialDelay: 10 * time.Millisecond, MaxDelay: 10 * time.Millisecond, Multiplier: 100})
+	srv.Fail("files", connectFailed, 1)
+	srv.Fail("files", connectFailed, 1)
+
+	start := time.Now()
+	if _, err := p.GetHeadRev("//depot/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Errorf("%v", elapsed)
+	}
+}
+
+// Not retried: non transient errors, no policy, write commands
+func TestNoRetry(t *testing.T) {
+	srv, p := newRetryServer(t)
+	policy := perforce.RetryPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond}
+	q := p.WithRetryPolicy(policy)
+
+	srv.Fail("files", "Perforce password (P4PASSWD) invalid or unset.\n", 1)
+	if _, err := q.GetHeadRev("//depot/a.txt"); err == nil {
+		t.Errorf("no error")
+	}
+	srv.Fail("files", connectFailed, 1)
+	if _, err := p.GetHeadRev("//depot/a.txt"); err == nil {
+		t.Errorf("no policy: no error")
+	}
+	if files := commandsOf(srv, "files"); len(files) != 2 {
+		t.Errorf("%d attempts", len(files))
+	}
+
+	// Submit may have succeeded
+	cl := srv.CreateChange("bob", "ws", "retry")
+	srv.Open("ws", "edit", "//depot/a.txt", cl)
+	srv.Fail("submit", connectFailed, 1)
+	if _, err := q.Submit(perforce.SubmitOptions{Changelist: cl}); err == nil {
+		t.Errorf("submit: no error")
+	}
+	if submit := commandsOf(srv, "submit"); len(submit) != 1 {
+		t.Errorf("submit: %q", submit)
+	}
+
+	// Spec forms: read with -o is retried, not the others
+	srv.Fail("change", connectFailed, 1)
+	if _, err := q.GetCLSpecProperties(cl); err != nil {
+		t.Errorf("change -o: %v", err)
+	}
+	srv.Fail("change", connectFailed, 1)
+	if err := q.DeleteCL(cl); err == nil {
+		t.Errorf("change -d: no error")
+	}
+	if change := commandsOf(srv, "change"); len(change) != 3 {
+		t.Errorf("change: %q", change)
+	}
+
+	// Unless listed
+	policy.AlsoRetry = []string{"submit"}
+	srv.Fail("submit", connectFailed, 1)
+	res, err := p.WithRetryPolicy(policy).Submit(perforce.SubmitOptions{Changelist: cl})
+	if err != nil || res.Change != cl {
+		t.Errorf("%+v %v", res, err)
+	}
+	if submit := commandsOf(srv, "submit"); len(submit) != 3 {
+		t.Errorf("submit: %q", submit)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	srv, p := newRetryServer(t)
+	p = p.WithRetryPolicy(perforce.RetryPolicy{
+		MaxAttempts:  2,
+		InitialDelay: time.Millisecond,
+		Retryable:    func(out []byte, err error) bool { return strings.Contains(string(out), "try again") },
+	})
+	srv.Fail("files", "Server busy, try again.\n", 1)
+	if rev, err := p.GetHeadRev("//depot/a.txt"); err != nil || rev != 2 {
+		t.Errorf("%d %v", rev, err)
+	}
+	srv.Fail("files", connectFailed, 1)
+	if _, err := p.GetHeadRev("//depot/a.txt"); err == nil {
+		t.Errorf("no error")
+	}
+
+	if !perforce.IsTransientError([]byte("Database is locked.\n"), errTest) || perforce.IsTransientError([]byte(connectFailed), nil) ||
+		perforce.IsTransientError([]byte("no such file(s).\n"), errTest) {
+		t.Errorf("IsTransientError()")
+	}
+}
+
+var errTest = errors.New("exit status 1")
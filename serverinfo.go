@@ -0,0 +1,289 @@
+package perforce
+
+// Server information and capabilities from p4 info.
+//
+//	info, err := p4.GetServerInfo()
+//	if info.Version.AtLeast("2019.1") && !info.IsReplica() { ... }
+//	if ok, _ := p4.Supports(perforce.FeatureParallelSync); ok { ... }
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerInfo - p4 info
+type ServerInfo struct {
+	UserName        string
+	ClientName      string
+	ClientRoot      string
+	ClientHost      string
+	ClientAddress   string
+	ServerAddress   string
+	ServerRoot      string
+	ServerID        string
+	ServerDate      string         // i.e. 2020/09/20 21:02:41 -0700 PDT
+	ServerTime      time.Time      // ServerDate
+	Location        *time.Location // server timezone
+	TZOffset        int            // offset of ServerDate in seconds east of UTC
+	ServerUptime    string
+	ServerVersion   string // i.e. P4D/LINUX26X86_64/2020.1/1234567 (2020/06/01)
+	Version         ServerVersion
+	CaseHandling    string // sensitive, insensitive or hybrid
+	CaseInsensitive bool
+	Unicode         bool   // server in unicode mode
+	Services        string // standard, commit-server, edge-server, replica, forwarding-replica...
+	License         string
+	Tagged          bool              // p4 info returned tagged output
+	Raw             map[string]string // all the fields returned (tagged names)
+}
+
+// ServerVersion - parts of the server version
+type ServerVersion struct {
+	Product  string // P4D
+	Platform string // LINUX26X86_64
+	Release  string // 2020.1
+	Change   int    // 1234567
+	Date     string // 2020/06/01
+}
+
+// Feature - server capability, see Supports()
+type Feature string
+
+const (
+	FeatureStreams        Feature = "streams"         // stream depots
+	FeatureReconcile      Feature = "reconcile"       // p4 reconcile and p4 status
+	FeatureParallelSync   Feature = "parallel-sync"   // p4 sync --parallel
+	FeatureParallelSubmit Feature = "parallel-submit" // p4 submit --parallel
+	FeatureGraphDepots    Feature = "graph-depots"    // git repos in graph depots
+	FeatureShelvedStreams Feature = "shelved-streams" // shelving of stream specs (p4 shelve -As)
+)
+
+// Min server release of the features
+var featureReleases = map[Feature]string{
+	FeatureStreams:        "2011.1",
+	FeatureReconcile:      "2012.1",
+	FeatureParallelSync:   "2014.1",
+	FeatureParallelSubmit: "2015.1",
+	FeatureGraphDepots:    "2017.1",
+	FeatureShelvedStreams: "2020.2",
+}
+
+// Field names of the untagged output of p4 info
+var infoFieldNames = map[string]string{
+	"User name":         "userName",
+	"Client name":       "clientName",
+	"Client host":       "clientHost",
+	"Client root":       "clientRoot",
+	"Client address":    "clientAddress",
+	"Current directory": "clientCwd",
+	"Peer address":      "peerAddress",
+	"Server address":    "serverAddress",
+	"Server root":       "serverRoot",
+	"Server date":       "serverDate",
+	"Server uptime":     "serverUptime",
+	"Server version":    "serverVersion",
+	"Server license":    "serverLicense",
+	"Server services":   "serverServices",
+	"ServerID":          "ServerID",
+	"Case Handling":     "caseHandling",
+	"Unicode":           "unicode",
+}
+
+// GetServerInfo()
+//	Run p4 info and return its fields. The server data (timezone, capabilities...)
+//	used by the other functions is refreshed.
+//	The user and workspace fields are the ones of the instance: the data kept for
+//	the derived instances doesn't include them.
+func (p *Perforce) GetServerInfo() (info ServerInfo, err error) {
+	p.logThis("GetServerInfo()")
+
+	cache := p.serverData()
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	info, err = p.p4InfoFields()
+	if err != nil {
+		return info, err
+	}
+	cache.info = info.shared()
+	return info, nil
+}
+
+// Server info cached - p4 info is run the first time only.
+// The user and workspace fields aren't set (see shared()).
+func (p *Perforce) serverInfo() (info ServerInfo, err error) {
+	cache := p.serverData()
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.info != nil {
+		return *cache.info, nil
+	}
+	info, err = p.p4InfoFields()
+	if err != nil {
+		return info, err
+	}
+	cache.info = info.shared()
+	return *cache.info, nil
+}
+
+// Copy of the info shared by an instance and its derived instances: without the
+// fields depending on the user and the workspace (see WithUser(), WithWorkspace())
+func (s ServerInfo) shared() *ServerInfo {
+	s.UserName, s.ClientName, s.ClientRoot, s.ClientHost = "", "", "", ""
+	raw := make(map[string]string, len(s.Raw))
+	for k, v := range s.Raw {
+		if k == "userName" || (strings.HasPrefix(k, "client") && k != "clientAddress") {
+			continue
+		}
+		raw[k] = v
+	}
+	s.Raw = raw
+	return &s
+}
+
+// Supports()
+//	Whether the server supports a feature, based on its version.
+func (p *Perforce) Supports(feature Feature) (ok bool, err error) {
+	info, err := p.serverInfo()
+	if err != nil {
+		return false, err
+	}
+	return info.Supports(feature), nil
+}
+
+// Error if the server doesn't support a feature used by a function
+func (p *Perforce) requireFeature(caller string, feature Feature) error {
+	info, err := p.serverInfo()
+	if err != nil {
+		return err
+	}
+	if !info.Supports(feature) {
+		return fmt.Errorf("%s - Feature %s not supported by the server: release %s, %s or later needed",
+			caller, feature, info.Version.Release, featureReleases[feature])
+	}
+	return nil
+}
+
+// Run and parse p4 info: tagged output or untagged for old servers
+func (p *Perforce) p4InfoFields() (info ServerInfo, err error) {
+	out, err := p.execP4(nil, "-ztag", "info")
+	if err != nil {
+		return info, p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	records, _ := parseZtag(out)
+	if len(records) > 0 {
+		info.Raw = records[0]
+		info.Tagged = true
+	} else {
+		info.Raw = make(map[string]string)
+		for _, line := range strings.Split(string(out), "\n") {
+			i := strings.Index(line, ": ")
+			if i <= 0 {
+				continue
+			}
+			key := line[:i]
+			if name, ok := infoFieldNames[key]; ok {
+				key = name
+			}
+			info.Raw[key] = strings.TrimSpace(line[i+2:])
+		}
+	}
+	if len(info.Raw["serverDate"]) <= 0 {
+		return info, p.errorf("Error parsing - no server date received from p4: %s", out)
+	}
+
+	info.UserName = info.Raw["userName"]
+	info.ClientName = info.Raw["clientName"]
+	info.ClientRoot = info.Raw["clientRoot"]
+	info.ClientHost = info.Raw["clientHost"]
+	info.ClientAddress = info.Raw["clientAddress"]
+	info.ServerAddress = info.Raw["serverAddress"]
+	info.ServerRoot = info.Raw["serverRoot"]
+	info.ServerID = info.Raw["ServerID"]
+	info.ServerDate = info.Raw["serverDate"]
+	info.ServerUptime = info.Raw["serverUptime"]
+	info.ServerVersion = info.Raw["serverVersion"]
+	info.CaseHandling = info.Raw["caseHandling"]
+	info.CaseInsensitive = info.CaseHandling == "insensitive"
+	info.Unicode = info.Raw["unicode"] == "enabled"
+	info.Services = info.Raw["serverServices"]
+	if len(info.Services) <= 0 {
+		info.Services = "standard"
+	}
+	info.License = info.Raw["serverLicense"]
+
+	if info.Location, err = parseServerDateLocation(info.ServerDate); err != nil {
+		return info, err
+	}
+	fields := strings.Fields(info.ServerDate)
+	if t, err := time.Parse("2006/01/02 15:04:05 -0700", strings.Join(fields[:3], " ")); err == nil {
+		info.ServerTime = t.In(info.Location)
+		_, info.TZOffset = t.Zone()
+	}
+
+	info.Version, err = ParseServerVersion(info.ServerVersion)
+	if err != nil {
+		p.logThis(fmt.Sprintf("	Warning - %v", err))
+	}
+	return info, nil
+}
+
+var serverVersionPattern = regexp.MustCompile(`^([^/]+)/([^/]+)/([0-9]+\.[0-9]+)[^/]*/([0-9]+)(?: \(([0-9/]+)\))?`)
+
+// ParseServerVersion()
+//	Parse a server version: P4D/LINUX26X86_64/2020.1/1234567 (2020/06/01)
+func ParseServerVersion(version string) (v ServerVersion, err error) {
+	m := serverVersionPattern.FindStringSubmatch(strings.TrimSpace(version))
+	if m == nil {
+		return v, fmt.Errorf("Error parsing server version: %q", version)
+	}
+	v.Product, v.Platform, v.Release, v.Date = m[1], m[2], m[3], m[5]
+	v.Change, _ = strconv.Atoi(m[4])
+	return v, nil
+}
+
+// AtLeast()
+//	Whether the release is the one given or a later one: AtLeast("2019.1")
+func (v ServerVersion) AtLeast(release string) bool {
+	year, minor := splitRelease(v.Release)
+	ryear, rminor := splitRelease(release)
+	return year > ryear || (year == ryear && minor >= rminor)
+}
+
+func splitRelease(release string) (year int, minor int) {
+	parts := strings.SplitN(release, ".", 2)
+	year, _ = strconv.Atoi(parts[0])
+	if len(parts) > 1 {
+		minor, _ = strconv.Atoi(parts[1])
+	}
+	return year, minor
+}
+
+// Supports()
+//	Whether the server supports a feature, based on its version.
+func (s ServerInfo) Supports(feature Feature) bool {
+	release, ok := featureReleases[feature]
+	return ok && s.Version.AtLeast(release)
+}
+
+// IsEdge()
+func (s ServerInfo) IsEdge() bool {
+	return strings.Contains(s.Services, "edge")
+}
+
+// IsReplica()
+//	Read-only replica, forwarding replica or build server.
+func (s ServerInfo) IsReplica() bool {
+	return strings.Contains(s.Services, "replica") || s.Services == "build-server"
+}
+
+// IsCommit()
+//	Commit server of a distributed installation.
+func (s ServerInfo) IsCommit() bool {
+	return s.Services == "commit-server"
+}
@@ -0,0 +1,345 @@
+package perforce
+
+// Generic Perforce form (spec) parser and writer.
+//
+// Works for any form produced by a "p4 <type> -o" command: change, client,
+// label, branch, stream, job, user, group...
+//
+// A form is made of fields separated by blank lines and comment lines (#):
+//
+//	# A Perforce Change Specification.
+//	#  Change:      The change number. 'new' on a new changelist.
+//
+//	Change:	new
+//
+//	Description:
+//		<enter description here>
+//
+//	Files:
+//		//depot/a/file.txt	# edit
+//
+// Fields order, comments and blank lines are preserved. Fields that haven't been
+// modified are written back byte for byte.
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Spec - parsed form
+type Spec struct {
+	Eol     string // End of line detected in the form ("\n" or "\r\n"), used when writing modified fields
+	entries []specEntry
+}
+
+// specEntry - either a field or raw text (comment, blank line...)
+type specEntry struct {
+	name  string   // Field name, empty for raw text
+	value string   // Value of a single line field
+	lines []string // Values of a multi-line field, without the leading tab
+	multi bool     // Multi-line field
+	raw   string   // Text as received, empty if the field was modified
+}
+
+var specFieldPattern = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9_-]*):(.*)$`)
+
+// ParseSpec()
+//	Parse a form as returned by a p4 <type> -o command.
+//	Returns the spec or an error if the form is malformed.
+func ParseSpec(form string) (s *Spec, err error) {
+	s = &Spec{}
+
+	// Detect what kind of end of line we receive from the perforce server
+	if strings.Count(form, "\r\n") > 0 && strings.Count(form, "\r\n") >= strings.Count(form, "\n")-strings.Count(form, "\r\n") {
+		s.Eol = "\r\n"
+	} else {
+		s.Eol = "\n"
+	}
+
+	var field *specEntry
+	closeField := func() {
+		if field != nil {
+			s.entries = append(s.entries, *field)
+			field = nil
+		}
+	}
+
+	for n := 1; len(form) > 0; n++ {
+		// Split the next line keeping its end of line
+		var line string
+		if i := strings.Index(form, "\n"); i >= 0 {
+			line, form = form[:i+1], form[i+1:]
+		} else {
+			line, form = form, ""
+		}
+		text := strings.TrimRight(line, "\r\n")
+
+		switch {
+		case strings.HasPrefix(text, "\t") || (strings.HasPrefix(text, " ") && len(strings.TrimSpace(text)) > 0):
+			// Continuation of a multi-line field
+			if field == nil {
+				return nil, fmt.Errorf("Error parsing spec - value without field at line %d", n)
+			}
+			field.multi = true
+			field.lines = append(field.lines, strings.TrimPrefix(text, "\t"))
+			field.raw += line
+
+		case len(strings.TrimSpace(text)) == 0 || strings.HasPrefix(text, "#"):
+			// Blank line or comment
+			closeField()
+			s.entries = append(s.entries, specEntry{raw: line})
+
+		default:
+			closeField()
+			matches := specFieldPattern.FindStringSubmatch(text)
+			if matches == nil {
+				return nil, fmt.Errorf("Error parsing spec - unexpected line %d", n)
+			}
+			field = &specEntry{name: matches[1], raw: line}
+			field.value = strings.TrimSpace(matches[2])
+			if len(field.value) <= 0 {
+				field.multi = true
+			}
+		}
+	}
+	closeField()
+
+	// A field with a value on its first line and continuation lines is multi-line
+	for i := range s.entries {
+		e := &s.entries[i]
+		if e.multi && len(e.value) > 0 {
+			e.lines = append([]string{e.value}, e.lines...)
+			e.value = ""
+		}
+	}
+
+	return s, nil
+}
+
+// NewSpec()
+//	Create an empty spec to be filled with Set() and SetLines().
+func NewSpec() (s *Spec) {
+	return &Spec{Eol: "\n"}
+}
+
+// String()
+//	Write the form back. Unmodified fields and comments are written as received.
+func (s *Spec) String() string {
+	var sb strings.Builder
+	for _, e := range s.entries {
+		if len(e.raw) > 0 {
+			sb.WriteString(e.raw)
+			continue
+		}
+		if e.multi {
+			sb.WriteString(e.name + ":" + s.Eol)
+			for _, l := range e.lines {
+				sb.WriteString("\t" + l + s.Eol)
+			}
+		} else {
+			sb.WriteString(e.name + ":\t" + e.value + s.Eol)
+		}
+	}
+	return sb.String()
+}
+
+// Fields()
+//	Returns the field names in the order of the form.
+func (s *Spec) Fields() (names []string) {
+	for _, e := range s.entries {
+		if len(e.name) > 0 {
+			names = append(names, e.name)
+		}
+	}
+	return names
+}
+
+// Has()
+//	Returns true if the field is present.
+func (s *Spec) Has(name string) bool {
+	return s.find(name) >= 0
+}
+
+// Get()
+//	Returns the value of a field or "" if not present.
+//	Lines of a multi-line field are joined with "\n".
+func (s *Spec) Get(name string) (value string) {
+	i := s.find(name)
+	if i < 0 {
+		return ""
+	}
+	if s.entries[i].multi {
+		return strings.Join(s.entries[i].lines, "\n")
+	}
+	return s.entries[i].value
+}
+
+// GetLines()
+//	Returns the lines of a multi-line field (one element for a single line field)
+//	or nil if not present.
+func (s *Spec) GetLines(name string) (lines []string) {
+	i := s.find(name)
+	if i < 0 {
+		return nil
+	}
+	if s.entries[i].multi {
+		return append(lines, s.entries[i].lines...)
+	}
+	return []string{s.entries[i].value}
+}
+
+// Set()
+//	Set a single line field. The field is added at the end of the form if not present.
+//	A value containing "\n" is set as a multi-line field.
+//	The field is left untouched if its value doesn't change.
+func (s *Spec) Set(name string, value string) {
+	if strings.Contains(value, "\n") {
+		s.SetLines(name, strings.Split(strings.ReplaceAll(value, "\r\n", "\n"), "\n"))
+		return
+	}
+	i := s.find(name)
+	if i >= 0 && !s.entries[i].multi && s.entries[i].value == value {
+		return // No change
+	}
+	s.put(i, specEntry{name: name, value: value})
+}
+
+// SetLines()
+//	Set a multi-line field. The field is added at the end of the form if not present.
+//	The field is left untouched if its values don't change.
+func (s *Spec) SetLines(name string, lines []string) {
+	i := s.find(name)
+	if i >= 0 && s.entries[i].multi && equalLines(s.entries[i].lines, lines) {
+		return // No change
+	}
+	s.put(i, specEntry{name: name, lines: append([]string{}, lines...), multi: true})
+}
+
+// Delete()
+//	Remove a field and the blank line following it.
+func (s *Spec) Delete(name string) {
+	i := s.find(name)
+	if i < 0 {
+		return
+	}
+	end := i + 1
+	if end < len(s.entries) && len(s.entries[end].name) == 0 && len(strings.TrimSpace(s.entries[end].raw)) == 0 {
+		end++
+	}
+	s.entries = append(s.entries[:i], s.entries[end:]...)
+}
+
+// Replace or add a field
+func (s *Spec) put(i int, e specEntry) {
+	if i >= 0 {
+		s.entries[i] = e
+		return
+	}
+	// New field: separate it from the previous one with a blank line
+	if n := len(s.entries); n > 0 && (len(s.entries[n-1].name) > 0 || len(strings.TrimSpace(s.entries[n-1].raw)) > 0) {
+		s.entries = append(s.entries, specEntry{raw: s.Eol})
+	}
+	s.entries = append(s.entries, e, specEntry{raw: s.Eol})
+}
+
+// Index of a field, -1 if not found
+func (s *Spec) find(name string) int {
+	for i, e := range s.entries {
+		if e.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func equalLines(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// GetSpec()
+//	Get a form from the server: p4 <specType> -o [name]
+// 	Input:
+//		- spec type: change, client, label, branch, stream, job, user, group...
+//		- name of the spec, optional: if empty the server returns the default one
+//  Return:
+//		- the parsed spec
+//		- err code, nil if okay
+func (p *Perforce) GetSpec(specType string, name string) (s *Spec, err error) {
+	p.logThis(fmt.Sprintf("GetSpec(%s, %s)", specType, name))
+
+	args := []string{specType, "-o"}
+	if len(name) > 0 {
+		args = append(args, name)
+	}
+	out, err := p.execP4(nil, args...)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if err != nil {
+		return nil, p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	return ParseSpec(string(out))
+}
+
+// PutSpec()
+//	Write a form to the server: p4 <specType> -i [flags]
+// 	Input:
+//		- spec type: change, client, label, branch, stream, job, user, group...
+//		- the spec
+//		- optional flags such as -f
+//  Return:
+//		- the server response, i.e. "Client xxx saved."
+//		- err code, nil if okay
+func (p *Perforce) PutSpec(specType string, s *Spec, flags ...string) (response string, err error) {
+	p.logThis(fmt.Sprintf("PutSpec(%s, %v)", specType, flags))
+
+	args := append([]string{specType, "-i"}, flags...)
+	out, err := p.execP4(strings.NewReader(s.String()), args...)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if err != nil {
+		return string(out), p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// splitSpecWords()
+//	Split a line of a spec value in words separated by spaces or tabs.
+//	Words containing spaces are double-quoted, quotes are removed.
+//	i.e. "//depot/a dir/..." //ws/a/...
+func splitSpecWords(line string) (words []string) {
+	var word strings.Builder
+	inWord, quoted := false, false
+	for _, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			inWord = true
+		case (c == ' ' || c == '\t') && !quoted:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
@@ -0,0 +1,126 @@
+package perforce_test
+
+import (
+	"strings"
+	"testing"
+
+	perforce "github.com/fabdem/go-perforce"
+)
+
+// Change form as written by p4 change -o: comments, tabs, continuation lines,
+// an empty line in a description and an empty multi-line field (Jobs)
+const changeForm = `# A Perforce Change Specification.
+#
+#  Change:      The change number. 'new' on a new changelist.
+#  Description: Comments about the changelist.  Required.
+#  Jobs:        What opened jobs are to be closed by this changelist.
+
+Change:	1234
+
+Date:	2021/03/04 10:20:30
+
+Client:	bob_ws
+
+User:	bob
+
+Status:	pending
+
+Description:
+	First line
+	
+	  indented after an empty line	with a tab
+
+Jobs:
+
+Files:
+	//depot/a.txt	# edit
+	//depot/sp ace/b.txt	# add
+`
+
+// Client form with a value on the first line of a multi-line field and no final end of line
+const clientForm = "Client:\tbob_ws\n\nRoot:\t/home/bob/ws\n\nAltRoots: /mnt/ws\n\t/media/ws\n\nView:\n\t//depot/... //bob_ws/...\n\t\"//depot/sp ace/...\" \"//bob_ws/sp ace/...\""
+
+func TestSpecRoundTrip(t *testing.T) {
+	for name, form := range map[string]string{
+		"change LF":   changeForm,
+		"change CRLF": strings.ReplaceAll(changeForm, "\n", "\r\n"),
+		"client LF":   clientForm,
+		"client CRLF": strings.ReplaceAll(clientForm, "\n", "\r\n"),
+		"empty":       "",
+		"comments":    "# only\n#  comments\n\n",
+	} {
+		s, err := perforce.ParseSpec(form)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := s.String(); got != form {
+			t.Errorf("%s: written back\n%q\nwant\n%q", name, got, form)
+		}
+	}
+}
+
+func TestSpecFields(t *testing.T) {
+	s, err := perforce.ParseSpec(strings.ReplaceAll(changeForm, "\n", "\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Eol != "\r\n" {
+		t.Errorf("eol %q", s.Eol)
+	}
+	if want := []string{"Change", "Date", "Client", "User", "Status", "Description", "Jobs", "Files"}; strings.Join(s.Fields(), " ") != strings.Join(want, " ") {
+		t.Errorf("fields %v", s.Fields())
+	}
+	if got := s.Get("Description"); got != "First line\n\n  indented after an empty line\twith a tab" {
+		t.Errorf("description %q", got)
+	}
+	if !s.Has("Jobs") || s.Get("Jobs") != "" || len(s.GetLines("Jobs")) != 0 {
+		t.Errorf("jobs %q %q", s.Get("Jobs"), s.GetLines("Jobs"))
+	}
+	if got := s.GetLines("Files"); len(got) != 2 || got[1] != "//depot/sp ace/b.txt\t# add" {
+		t.Errorf("files %q", got)
+	}
+
+	c, err := perforce.ParseSpec(clientForm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.GetLines("AltRoots"); len(got) != 2 || got[0] != "/mnt/ws" || got[1] != "/media/ws" {
+		t.Errorf("altroots %q", got)
+	}
+}
+
+// Only the modified fields are rewritten, with the end of line of the form
+func TestSpecModified(t *testing.T) {
+	form := strings.ReplaceAll(changeForm, "\n", "\r\n")
+	s, err := perforce.ParseSpec(form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set("Status", "pending") // unchanged
+	s.Set("Description", "New\ndescription")
+	s.SetLines("Jobs", []string{"job000001"})
+	s.Delete("Date")
+	s.Set("Type", "restricted")
+
+	want := strings.NewReplacer(
+		"Date:\t2021/03/04 10:20:30\r\n\r\n", "",
+		"Description:\r\n\tFirst line\r\n\t\r\n\t  indented after an empty line\twith a tab\r\n", "Description:\r\n\tNew\r\n\tdescription\r\n",
+		"Jobs:\r\n", "Jobs:\r\n\tjob000001\r\n",
+	).Replace(form) + "\r\nType:\trestricted\r\n\r\n"
+	if got := s.String(); got != want {
+		t.Errorf("written\n%q\nwant\n%q", got, want)
+	}
+}
+
+// The errors give the line number, not the content of the line which may hold a secret
+func TestParseSpecErrors(t *testing.T) {
+	for form, line := range map[string]string{
+		"\tvalue without field P4PASSWD=secret\n":    "line 1",
+		"Change: new\nnot a field P4PASSWD=secret\n": "line 2",
+	} {
+		_, err := perforce.ParseSpec(form)
+		if err == nil || !strings.Contains(err.Error(), line) || strings.Contains(err.Error(), "secret") {
+			t.Errorf("%q: %v", form, err)
+		}
+	}
+}
@@ -0,0 +1,437 @@
+package perforce
+
+// Streams: list, specs, switch of a workspace and integrations with the parent.
+//
+//	streams, err := p4.GetStreams(perforce.StreamFilter{Paths: []string{"//streams/..."}, Type: "development"})
+//	err = p4.SwitchStream("//streams/dev")
+//	status, err := p4.GetStreamStatus("//streams/dev")
+//	if status.IntegFromParent { files, err := p4.MergeDown("//streams/dev", cl, false) ... }
+//
+// Stream names and the paths of stream specs are in p4 syntax (escaped), like views.
+// Streams need a server 2011.1 or later: the functions return an error on older
+// servers (see Supports()).
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stream path of a stream spec:
+//	share src/...
+//	import lib/... //depot/lib/...@1234
+type T_StreamPath struct {
+	Type      string // share, isolate, import, import+, exclude
+	ViewPath  string // path relative to the stream root, i.e. src/...
+	DepotPath string // import paths only: depot path with optional revision
+}
+
+// Stream specification
+type T_StreamProperties struct {
+	Stream      string    // //streams/main
+	Update      string    // The date this specification was last modified.
+	Time        time.Time // Update in the server timezone. Read-only.
+	Access      string
+	Owner       string
+	Name        string
+	Parent      string   // "none" for a mainline
+	Type        string   // mainline, development, release, virtual or task
+	Description string   // Lines are separated by "\n".
+	Options     []string // allsubmit/ownersubmit, unlocked/locked, toparent/notoparent, fromparent/nofromparent, mergedown/mergeany
+	ParentView  string   // inherit or noinherit - servers 2020.1 and later
+	Paths       []T_StreamPath
+	Remapped    []string // pairs of view paths: "src/... source/..." - not set by GetStreams()
+	Ignored     []string // i.e. ".o" or "/tmp/..." - not set by GetStreams()
+	Eol         string   // Detect what kind of end of line we receive from the server.
+	Form        string   // Form as it was received
+}
+
+// StreamFilter - streams listed by GetStreams(). The criteria are combined (and).
+type StreamFilter struct {
+	Paths    []string // stream names or patterns, i.e. //streams/...
+	Type     string   // mainline, development, release, virtual or task
+	Owner    string
+	Parent   string
+	Filter   string // other p4 streams -F expression, i.e. "Options=locked*"
+	Max      int    // max number of streams, 0 for no limit
+	Unloaded bool   // unloaded task streams (-U)
+}
+
+// Integration status of a stream with its parent
+type T_StreamStatus struct {
+	Stream             string
+	Parent             string
+	Type               string
+	IntegToParent      bool   // changes to copy up to the parent
+	IntegToParentHow   string // copy or merge
+	IntegFromParent    bool   // changes to merge down from the parent
+	IntegFromParentHow string // merge or copy
+}
+
+// File opened by CopyUp() or MergeDown()
+type T_IntegratedFile struct {
+	DepotFile string // target file
+	Rev       int    // target revision before the integration, 0 if none
+	Action    string // integrate, sync/integrate, branch/sync, delete/sync...
+	FromFile  string // source file
+	FromRev   int    // last source revision integrated
+}
+
+// GetStreams()
+//	List the streams: p4 streams [-U] [-F filter] [-m max] [path...]
+//	The paths, remapped and ignored lines of the specs aren't returned, see GetStream().
+//	Long lists of paths are split in batches (see SetBatchSize()).
+func (p *Perforce) GetStreams(filter StreamFilter) (streams []T_StreamProperties, err error) {
+	p.logThis(fmt.Sprintf("GetStreams(%+v)", filter))
+
+	if err = p.requireFeature("GetStreams()", FeatureStreams); err != nil {
+		return streams, err
+	}
+
+	args := []string{"-ztag", "streams"}
+	if filter.Unloaded {
+		args = append(args, "-U")
+	}
+	var criteria []string
+	for _, c := range [][2]string{{"Type", filter.Type}, {"Owner", filter.Owner}, {"Parent", filter.Parent}} {
+		if len(c[1]) > 0 {
+			criteria = append(criteria, c[0]+"="+c[1])
+		}
+	}
+	if len(filter.Filter) > 0 {
+		criteria = append(criteria, "("+filter.Filter+")")
+	}
+	if len(criteria) > 0 {
+		args = append(args, "-F", strings.Join(criteria, " "))
+	}
+	if filter.Max > 0 {
+		args = append(args, "-m", strconv.Itoa(filter.Max))
+	}
+
+	out, err := p.execP4Files(args, filter.Paths)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if err != nil {
+		return streams, p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	records, _ := parseZtag(out)
+	for _, r := range records {
+		if len(r["Stream"]) <= 0 {
+			continue
+		}
+		var s T_StreamProperties
+		s.Stream = r["Stream"]
+		s.Time = p.dateOf(r["Update"])
+		s.Update = r["Update"]
+		if !s.Time.IsZero() {
+			s.Update = s.Time.Format("2006/01/02 15:04:05")
+		}
+		s.Access = r["Access"]
+		if t := p.dateOf(r["Access"]); !t.IsZero() {
+			s.Access = t.Format("2006/01/02 15:04:05")
+		}
+		s.Owner = r["Owner"]
+		s.Name = r["Name"]
+		s.Parent = r["Parent"]
+		s.Type = r["Type"]
+		s.Description = r["desc"]
+		s.Options = strings.Fields(r["Options"])
+		s.ParentView = r["ParentView"]
+		streams = append(streams, s)
+	}
+	if filter.Max > 0 && len(streams) > filter.Max { // max applied to each batch
+		streams = streams[:filter.Max]
+	}
+
+	return streams, nil
+}
+
+// GetStream()
+//	Get a stream spec: p4 stream -o stream
+//	The server returns a default spec if the stream doesn't exist.
+func (p *Perforce) GetStream(stream string) (properties T_StreamProperties, err error) {
+	p.logThis(fmt.Sprintf("GetStream(%s)", stream))
+
+	if len(stream) <= 0 {
+		return properties, fmt.Errorf("GetStream() - No stream specified")
+	}
+	if err = p.requireFeature("GetStream()", FeatureStreams); err != nil {
+		return properties, err
+	}
+
+	spec, err := p.GetSpec("stream", stream)
+	if err != nil {
+		return properties, err
+	}
+	if !spec.Has("Stream") {
+		return properties, p.errorf("Error parsing - not a stream spec received from p4: %s", spec)
+	}
+
+	properties.Eol = spec.Eol
+	properties.Stream = spec.Get("Stream")
+	properties.Update = spec.Get("Update")
+	properties.Time = p.dateOf(properties.Update)
+	properties.Access = spec.Get("Access")
+	properties.Owner = spec.Get("Owner")
+	properties.Name = spec.Get("Name")
+	properties.Parent = spec.Get("Parent")
+	properties.Type = spec.Get("Type")
+	properties.Description = spec.Get("Description")
+	properties.Options = strings.Fields(spec.Get("Options"))
+	properties.ParentView = spec.Get("ParentView")
+	properties.Paths, err = parseStreamPaths(spec.GetLines("Paths"))
+	if err != nil {
+		return properties, err
+	}
+	properties.Remapped = spec.GetLines("Remapped")
+	properties.Ignored = spec.GetLines("Ignored")
+
+	properties.Form = spec.String()
+
+	return properties, nil
+}
+
+// PutStream()
+//	Create or update a stream: p4 stream -i
+//	If properties.Form is set (i.e. returned by GetStream()) it's used
+//	as a base and only the modified fields are rewritten.
+//	A new stream without paths shares all its files (share ...).
+//	Returns the server response, i.e. "Stream //streams/dev saved."
+func (p *Perforce) PutStream(properties T_StreamProperties) (response string, err error) {
+	p.logThis(fmt.Sprintf("PutStream(%s)", properties.Stream))
+
+	if len(properties.Stream) <= 0 {
+		return response, fmt.Errorf("PutStream() - No stream specified")
+	}
+	if err = p.requireFeature("PutStream()", FeatureStreams); err != nil {
+		return response, err
+	}
+
+	spec := NewSpec()
+	if len(properties.Form) > 0 {
+		spec, err = ParseSpec(properties.Form)
+		if err != nil {
+			return response, err
+		}
+	}
+	if len(properties.Eol) > 0 {
+		spec.Eol = properties.Eol
+	}
+
+	spec.Set("Stream", properties.Stream)
+	for _, f := range [][2]string{{"Owner", properties.Owner}, {"Name", properties.Name},
+		{"Parent", properties.Parent}, {"Type", properties.Type}, {"ParentView", properties.ParentView}} {
+		if len(f[1]) > 0 {
+			spec.Set(f[0], f[1])
+		}
+	}
+	if len(properties.Options) > 0 {
+		spec.Set("Options", strings.Join(properties.Options, " "))
+	}
+	descr := strings.TrimRight(strings.ReplaceAll(properties.Description, "\r\n", "\n"), "\n")
+	spec.SetLines("Description", strings.Split(descr, "\n"))
+
+	paths := properties.Paths
+	if len(paths) <= 0 && !spec.Has("Paths") {
+		paths = []T_StreamPath{{Type: "share", ViewPath: "..."}}
+	}
+	if len(paths) > 0 {
+		lines, err := formatStreamPaths(paths)
+		if err != nil {
+			return response, err
+		}
+		spec.SetLines("Paths", lines)
+	}
+	for _, f := range []struct {
+		name  string
+		lines []string
+	}{{"Remapped", properties.Remapped}, {"Ignored", properties.Ignored}} {
+		if len(f.lines) > 0 {
+			spec.SetLines(f.name, f.lines)
+		} else {
+			spec.Delete(f.name)
+		}
+	}
+
+	return p.PutSpec("stream", spec)
+}
+
+// SwitchStream()
+//	Switch the current workspace to a stream: p4 client -s -S stream
+//	The workspace view is generated from the stream; files aren't synced.
+//	p4 refuses the switch if the workspace has opened files.
+func (p *Perforce) SwitchStream(stream string) (err error) {
+	p.logThis(fmt.Sprintf("SwitchStream(%s)", stream))
+
+	if len(stream) <= 0 {
+		return fmt.Errorf("SwitchStream() - No stream specified")
+	}
+	if err = p.requireFeature("SwitchStream()", FeatureStreams); err != nil {
+		return err
+	}
+
+	out, err := p.execP4(nil, "client", "-s", "-S", stream)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if err != nil {
+		return p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+	if !strings.Contains(string(out), "switched") {
+		return p.errorf("Error unexpected response. Received %s", out)
+	}
+
+	return nil
+}
+
+// GetStreamStatus()
+//	Whether a stream needs integrations with its parent: p4 istat stream
+func (p *Perforce) GetStreamStatus(stream string) (status T_StreamStatus, err error) {
+	p.logThis(fmt.Sprintf("GetStreamStatus(%s)", stream))
+
+	if len(stream) <= 0 {
+		return status, fmt.Errorf("GetStreamStatus() - No stream specified")
+	}
+	if err = p.requireFeature("GetStreamStatus()", FeatureStreams); err != nil {
+		return status, err
+	}
+
+	out, err := p.execP4(nil, "-ztag", "istat", stream)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if err != nil {
+		return status, p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	records, _ := parseZtag(out)
+	if len(records) <= 0 || len(records[0]["stream"]) <= 0 {
+		return status, p.errorf("Error parsing - no stream status received from p4: %s", out)
+	}
+	r := records[0]
+	status.Stream = r["stream"]
+	status.Parent = r["parent"]
+	status.Type = r["type"]
+	status.IntegToParent = r["integToParent"] == "true"
+	status.IntegToParentHow = r["integToParentHow"]
+	status.IntegFromParent = r["integFromParent"] == "true"
+	status.IntegFromParentHow = r["integFromParentHow"]
+
+	return status, nil
+}
+
+// CopyUp()
+//	Open for integration in a changelist the changes of a stream to copy up
+//	to its parent: p4 copy [-n] [-c changelist] -S stream
+//	The current workspace must be switched to the parent (see SwitchStream()).
+// 	Input:
+//		- stream to copy from
+//		- changelist, 0 for the default changelist
+//		- preview: list the files without opening them (-n)
+//  Return:
+//		- the files opened, none if there is nothing to copy
+//		- err code, nil if okay
+func (p *Perforce) CopyUp(stream string, changelist int, preview bool) (files []T_IntegratedFile, err error) {
+	p.logThis(fmt.Sprintf("CopyUp(%s, %d, %t)", stream, changelist, preview))
+	return p.streamInteg("copy", stream, changelist, preview)
+}
+
+// MergeDown()
+//	Open for integration in a changelist the changes of the parent of a stream
+//	to merge down into the stream: p4 merge [-n] [-c changelist] -S stream
+//	The current workspace must be switched to the stream (see SwitchStream()).
+//	The files opened must be resolved before submitting.
+// 	Input:
+//		- stream to merge into
+//		- changelist, 0 for the default changelist
+//		- preview: list the files without opening them (-n)
+//  Return:
+//		- the files opened, none if there is nothing to merge
+//		- err code, nil if okay
+func (p *Perforce) MergeDown(stream string, changelist int, preview bool) (files []T_IntegratedFile, err error) {
+	p.logThis(fmt.Sprintf("MergeDown(%s, %d, %t)", stream, changelist, preview))
+	return p.streamInteg("merge", stream, changelist, preview)
+}
+
+// Integrated files:
+//	//streams/main/a.txt#2 - sync/integrate from //streams/dev/a.txt#3
+//	//streams/dev/b.txt#1 - integrate from //streams/main/b.txt#2,#3
+var integratedFilePattern = regexp.MustCompile(`(?m)^(//[^#\r\n]*)#([0-9]+|none) - ([a-z/]+) from (//[^#\r\n]*)#(?:[0-9]+,#?)?([0-9]+)\r?$`)
+
+// Nothing to integrate
+var nothingToIntegPattern = regexp.MustCompile(`(?m)already integrated|no such file\(s\)|No file\(s\) to (?:copy|merge)`)
+
+func (p *Perforce) streamInteg(cmd string, stream string, changelist int, preview bool) (files []T_IntegratedFile, err error) {
+	if len(stream) <= 0 {
+		return files, fmt.Errorf("%s - No stream specified", cmd)
+	}
+	if err = p.requireFeature(cmd, FeatureStreams); err != nil {
+		return files, err
+	}
+
+	args := []string{cmd}
+	if preview {
+		args = append(args, "-n")
+	}
+	if changelist > 0 {
+		args = append(args, "-c", strconv.Itoa(changelist))
+	}
+	args = append(args, "-S", stream)
+
+	out, err := p.execP4(nil, args...)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if err != nil && !allBenign(otherLines(out, integratedFilePattern), nothingToIntegPattern) {
+		return files, p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	for _, m := range integratedFilePattern.FindAllSubmatch(out, -1) {
+		var f T_IntegratedFile
+		f.DepotFile = UnescapePath(string(m[1]))
+		f.Rev, _ = strconv.Atoi(string(m[2])) // 0 for #none
+		f.Action = string(m[3])
+		f.FromFile = UnescapePath(string(m[4]))
+		f.FromRev, _ = strconv.Atoi(string(m[5]))
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+// Paths of a stream spec
+func parseStreamPaths(lines []string) (paths []T_StreamPath, err error) {
+	for _, line := range lines {
+		words := splitSpecWords(line)
+		if len(words) <= 0 {
+			continue
+		}
+		if len(words) < 2 || len(words) > 3 {
+			return paths, fmt.Errorf("Error parsing stream path: %q", line)
+		}
+		path := T_StreamPath{Type: words[0], ViewPath: words[1]}
+		if len(words) > 2 {
+			path.DepotPath = words[2]
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func formatStreamPaths(paths []T_StreamPath) (lines []string, err error) {
+	for _, path := range paths {
+		if len(path.Type) <= 0 || len(path.ViewPath) <= 0 {
+			return lines, fmt.Errorf("Invalid stream path: %+v", path)
+		}
+		line := path.Type + " " + quoteSpecWord(path.ViewPath)
+		if len(path.DepotPath) > 0 {
+			line += " " + quoteSpecWord(path.DepotPath)
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
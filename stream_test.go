@@ -0,0 +1,183 @@
+package perforce_test
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	perforce "github.com/fabdem/go-perforce"
+	"github.com/fabdem/go-perforce/perforcetest"
+)
+
+// Server with the streams //streams/main and //streams/dev, m.txt more recent in dev
+func newStreamServer(t *testing.T) (srv *perforcetest.Server, p *perforce.Perforce) {
+	srv = perforcetest.NewServer()
+	if err := srv.AddClient("ws", t.TempDir(), "//streams/main/... //ws/..."); err != nil {
+		t.Fatal(err)
+	}
+	srv.AddFile("//streams/main/m.txt", "text", "m\n")
+	srv.AddFile("//streams/dev/m.txt", "text", "m\ndev\n")
+	p = srv.Perforce("bob", "ws")
+	if _, err := p.PutStream(perforce.T_StreamProperties{Stream: "//streams/main", Type: "mainline", Name: "main", Owner: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.PutStream(perforce.T_StreamProperties{Stream: "//streams/dev", Type: "development", Parent: "//streams/main",
+		Name: "dev", Owner: "alice", Description: "Development\nof 2.0", Options: []string{"allsubmit", "unlocked", "toparent", "fromparent", "mergedown"},
+		Paths: []perforce.T_StreamPath{{Type: "share", ViewPath: "..."}, {Type: "import", ViewPath: "lib/...", DepotPath: "//depot/lib/...@12"},
+			{Type: "exclude", ViewPath: "tmp dir/..."}}}); err != nil {
+		t.Fatal(err)
+	}
+	return srv, p
+}
+
+// Last command line received by the server for a p4 command, without the global options
+func lastCommandOf(srv *perforcetest.Server, cmd string) string {
+	commands := srv.Commands()
+	for i := len(commands) - 1; i >= 0; i-- {
+		c := commands[i]
+		for len(c) > 0 && strings.HasPrefix(c[0], "-") {
+			if c[0] == "-u" || c[0] == "-c" || c[0] == "-x" {
+				c = c[1:]
+			}
+			c = c[1:]
+		}
+		if len(c) > 0 && c[0] == cmd {
+			return strings.Join(c, " ")
+		}
+	}
+	return ""
+}
+
+func TestStreamSpecs(t *testing.T) {
+	srv, p := newStreamServer(t)
+
+	s, err := p.GetStream("//streams/dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []perforce.T_StreamPath{{Type: "share", ViewPath: "..."}, {Type: "import", ViewPath: "lib/...", DepotPath: "//depot/lib/...@12"},
+		{Type: "exclude", ViewPath: "tmp dir/..."}}
+	if s.Stream != "//streams/dev" || s.Parent != "//streams/main" || s.Type != "development" || s.Owner != "alice" ||
+		s.Description != "Development\nof 2.0" || len(s.Options) != 5 || !reflect.DeepEqual(s.Paths, paths) {
+		t.Errorf("%+v", s)
+	}
+	if !strings.Contains(s.Form, `exclude "tmp dir/..."`) {
+		t.Errorf("form %s", s.Form)
+	}
+
+	// Update from the form received: the fields not set are kept
+	s.Owner = "bob"
+	s.Paths = nil
+	s.Ignored = []string{".o"}
+	if _, err = p.PutStream(s); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = p.GetStream("//streams/dev"); err != nil || s.Owner != "bob" || !reflect.DeepEqual(s.Paths, paths) ||
+		!reflect.DeepEqual(s.Ignored, []string{".o"}) {
+		t.Errorf("%+v %v", s, err)
+	}
+	if _, err = p.PutStream(perforce.T_StreamProperties{Stream: "//streams/bad", Type: "development", Paths: []perforce.T_StreamPath{{Type: "share"}}}); err == nil {
+		t.Errorf("path without view path: no error")
+	}
+
+	// Listed with their dates in the server timezone
+	streams, err := p.GetStreams(perforce.StreamFilter{Paths: []string{"//streams/..."}, Type: "development", Owner: "bob"})
+	if err != nil || len(streams) != 1 || streams[0].Stream != "//streams/dev" || streams[0].Parent != "//streams/main" ||
+		streams[0].Description != "Development\nof 2.0" || streams[0].Paths != nil {
+		t.Fatalf("%+v %v", streams, err)
+	}
+	if cmd := lastCommandOf(srv, "streams"); cmd != "streams -F Type=development Owner=bob //streams/..." {
+		t.Errorf("%s", cmd)
+	}
+	if d := streams[0]; d.Time.IsZero() || d.Update != d.Time.Format("2006/01/02 15:04:05") || !strings.HasPrefix(d.Update, "2020/09/20 21:") ||
+		d.Access != d.Update {
+		t.Errorf("update %q %v access %q", d.Update, d.Time, d.Access)
+	}
+	if streams, err = p.GetStreams(perforce.StreamFilter{Filter: "Options=*unlocked*"}); err != nil || len(streams) != 1 {
+		t.Errorf("filter: %+v %v", streams, err)
+	}
+	if streams, err = p.GetStreams(perforce.StreamFilter{Max: 1}); err != nil || len(streams) != 1 {
+		t.Errorf("max: %+v %v", streams, err)
+	}
+
+	// Max of all the batches
+	p.SetBatchSize(1)
+	n := len(srv.Commands())
+	if streams, err = p.GetStreams(perforce.StreamFilter{Paths: []string{"//streams/main", "//streams/dev"}, Max: 1}); err != nil ||
+		len(streams) != 1 || streams[0].Stream != "//streams/main" {
+		t.Errorf("max of batches: %+v %v", streams, err)
+	}
+	if batches := len(srv.Commands()) - n; batches != 2 {
+		t.Errorf("%d batches", batches)
+	}
+}
+
+func TestSwitchStream(t *testing.T) {
+	srv, p := newStreamServer(t)
+
+	if err := p.SwitchStream("//streams/dev"); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := lastCommand(srv); cmd != "client -s -S //streams/dev" {
+		t.Errorf("%s", cmd)
+	}
+	ws, err := p.GetWorkspaceProperties("ws")
+	if err != nil || ws.Stream != "//streams/dev" {
+		t.Fatalf("%+v %v", ws, err)
+	}
+	if _, mapped := ws.ViewMap.DepotToClient("//streams/dev/m.txt"); !mapped {
+		t.Errorf("view %v", ws.View)
+	}
+	if _, mapped := ws.ViewMap.DepotToClient("//streams/main/m.txt"); mapped {
+		t.Errorf("view of the parent kept: %v", ws.View)
+	}
+
+	if err = p.SwitchStream("//streams/none"); err == nil {
+		t.Errorf("unknown stream: no error")
+	}
+	srv.Open("ws", "edit", "//streams/dev/m.txt", 0)
+	if err = p.SwitchStream("//streams/main"); err == nil {
+		t.Errorf("opened files: no error")
+	}
+}
+
+func TestCopyUpMergeDown(t *testing.T) {
+	srv, p := newStreamServer(t)
+
+	status, err := p.GetStreamStatus("//streams/dev")
+	want := perforce.T_StreamStatus{Stream: "//streams/dev", Parent: "//streams/main", Type: "development",
+		IntegToParent: true, IntegToParentHow: "copy", IntegFromParent: false, IntegFromParentHow: "merge"}
+	if err != nil || status != want {
+		t.Errorf("%+v %v", status, err)
+	}
+
+	// Nothing to merge down
+	files, err := p.MergeDown("//streams/dev", 0, false)
+	if err != nil || len(files) != 0 {
+		t.Errorf("merge down: %+v %v", files, err)
+	}
+
+	// Copy up from the parent workspace: preview then opened
+	cl := srv.CreateChange("bob", "ws", "copy up")
+	copied := []perforce.T_IntegratedFile{{DepotFile: "//streams/main/m.txt", Rev: 1, Action: "sync/integrate", FromFile: "//streams/dev/m.txt", FromRev: 1}}
+	if files, err = p.CopyUp("//streams/dev", cl, true); err != nil || !reflect.DeepEqual(files, copied) {
+		t.Errorf("preview: %+v %v", files, err)
+	}
+	if c, err := p.GetCLContent(cl); err != nil || len(c.List) != 0 {
+		t.Errorf("opened by the preview: %+v %v", c.List, err)
+	}
+	if files, err = p.CopyUp("//streams/dev", cl, false); err != nil || !reflect.DeepEqual(files, copied) {
+		t.Errorf("copy up: %+v %v", files, err)
+	}
+	if cmd := lastCommandOf(srv, "copy"); cmd != "copy -c "+strconv.Itoa(cl)+" -S //streams/dev" {
+		t.Errorf("%s", cmd)
+	}
+	if c, err := p.GetCLContent(cl); err != nil || !reflect.DeepEqual(c.List, map[string]perforce.T_CLFileProperties{"//streams/main/m.txt": {Rev: 1, Action: "integrate"}}) {
+		t.Errorf("opened: %+v %v", c.List, err)
+	}
+
+	if _, err = p.CopyUp("//streams/none", 0, false); err == nil {
+		t.Errorf("unknown stream: no error")
+	}
+}
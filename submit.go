@@ -0,0 +1,141 @@
+package perforce
+
+// Submit with options.
+//
+//	res, err := p4.Submit(perforce.SubmitOptions{
+//		Changelist: 1234,
+//		Unchanged:  perforce.RevertUnchanged,
+//		Parallel:   "threads=4",
+//	})
+//	fmt.Println(res.Change, len(res.Files))
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// What to do with the files opened but not modified (p4 submit -f)
+const (
+	SubmitUnchanged = "submitunchanged"
+	RevertUnchanged = "revertunchanged"
+	LeaveUnchanged  = "leaveunchanged"
+)
+
+// SubmitOptions - p4 submit options
+type SubmitOptions struct {
+	Description string // submit the default changelist with this description (-d)
+	Changelist  int    // pending changelist to submit (-c), 0 for the default changelist
+	Shelved     bool   // submit the files shelved in Changelist (-e) - not with Reopen, Unchanged and IncludeJobs
+	Reopen      bool   // reopen the files submitted in the default changelist (-r)
+	Unchanged   string // SubmitUnchanged, RevertUnchanged or LeaveUnchanged (-f), the workspace SubmitOptions if empty
+	Parallel    string // parallel transfer of the files (--parallel), i.e. "threads=4,batch=8", none if empty - server 2015.1 or later
+	IncludeJobs bool   // the status of the fixed jobs is set from the Jobs field of the changelist (-s) - default changelist only
+}
+
+// File submitted
+type T_SubmittedFile struct {
+	DepotFile string
+	Rev       int // new revision
+	Action    string
+}
+
+// Result of a submit
+type T_SubmitRes struct {
+	Change         int // changelist submitted, 0 if there was nothing to submit
+	OriginalChange int // number of the pending changelist if it was renamed, Change otherwise
+	Files          []T_SubmittedFile
+}
+
+// Outputs of p4 submit
+var submittedFilePattern = regexp.MustCompile(`(?m)^([a-z/]+) (//[^#\r\n]*)#([0-9]+)\r?$`)
+var submittedPattern = regexp.MustCompile(`(?m)^Change ([0-9]+) (?:renamed change ([0-9]+) and )?submitted\.`)
+
+// Submit()
+//	Submit a changelist: p4 submit [-r] [-s] [-f option] [--parallel=...] -d description | -c changelist
+//	or p4 submit [--parallel=...] -e changelist
+// 	Input:
+//		- options: the default changelist is submitted with a description, a pending
+//		  changelist without. The fixed jobs get the status given to Fix(), or the one
+//		  of the Jobs field of the default changelist with IncludeJobs.
+//  Return:
+//		- changelist submitted and files with their new revision - no changelist and
+//		  no error if there was nothing to submit
+//		- err code, nil if okay
+func (p *Perforce) Submit(opts SubmitOptions) (res T_SubmitRes, err error) {
+	p.logThis(fmt.Sprintf("Submit(%d, %s, shelved=%t, reopen=%t, unchanged=%s, parallel=%s, includejobs=%t)",
+		opts.Changelist, p.redactDescription(opts.Description), opts.Shelved, opts.Reopen, opts.Unchanged, opts.Parallel, opts.IncludeJobs))
+
+	if opts.Shelved && (opts.Reopen || len(opts.Unchanged) > 0 || opts.IncludeJobs) {
+		return res, fmt.Errorf("Submit() - Reopen, Unchanged and IncludeJobs can't be used with a shelved changelist: %d", opts.Changelist)
+	}
+	if opts.IncludeJobs && opts.Changelist > 0 {
+		return res, fmt.Errorf("Submit() - IncludeJobs is only used with the default changelist: %d", opts.Changelist)
+	}
+
+	args := []string{"submit"}
+	if opts.Reopen {
+		args = append(args, "-r")
+	}
+	if opts.IncludeJobs {
+		args = append(args, "-s")
+	}
+	switch opts.Unchanged {
+	case "":
+	case SubmitUnchanged, RevertUnchanged, LeaveUnchanged:
+		args = append(args, "-f", opts.Unchanged)
+	default:
+		return res, fmt.Errorf("Submit() - Invalid option for unchanged files: %s", opts.Unchanged)
+	}
+	if len(opts.Parallel) > 0 {
+		if err = p.requireFeature("Submit()", FeatureParallelSubmit); err != nil {
+			return res, err
+		}
+		args = append(args, "--parallel="+opts.Parallel)
+	}
+	switch {
+	case opts.Changelist > 0 && len(opts.Description) > 0:
+		return res, fmt.Errorf("Submit() - A description is only used with the default changelist: %d", opts.Changelist)
+	case opts.Shelved && opts.Changelist <= 0:
+		return res, fmt.Errorf("Submit() - No shelved changelist specified")
+	case opts.Shelved:
+		args = append(args, "-e", strconv.Itoa(opts.Changelist))
+	case opts.Changelist > 0:
+		args = append(args, "-c", strconv.Itoa(opts.Changelist))
+	case len(strings.TrimSpace(opts.Description)) <= 0:
+		return res, fmt.Errorf("Submit() - A description is needed to submit the default changelist")
+	default:
+		args = append(args, "-d", opts.Description)
+	}
+
+	out, err := p.execP4(nil, args...)
+
+	p.logThis(fmt.Sprintf("P4 response: %s", out))
+
+	if err != nil {
+		if strings.HasPrefix(string(out), "No files to submit from the default changelist.") ||
+			strings.HasSuffix(strings.TrimRight(string(out), "\r\n\t "), "No files to submit.") { //Submitting change 7654321\n No files to submit.
+			return res, nil // OK the CL was empty
+		}
+		return res, p.errorf("P4 command line error %v  out=%s", err, out)
+	}
+
+	// "Change 5008806 submitted." or "Change 4990122 renamed change 4990128 and submitted."
+	matches := submittedPattern.FindStringSubmatch(string(out))
+	if matches == nil {
+		return res, p.errorf("Error parsing submit response, received %s", out)
+	}
+	res.Change, _ = strconv.Atoi(matches[1])
+	res.OriginalChange = res.Change
+	if len(matches[2]) > 0 {
+		res.Change, _ = strconv.Atoi(matches[2])
+	}
+
+	for _, m := range submittedFilePattern.FindAllStringSubmatch(string(out), -1) {
+		rev, _ := strconv.Atoi(m[3])
+		res.Files = append(res.Files, T_SubmittedFile{DepotFile: UnescapePath(m[2]), Rev: rev, Action: m[1]})
+	}
+
+	return res, nil
+}
@@ -0,0 +1,48 @@
+package perforce_test
+
+import (
+	"testing"
+
+	perforce "github.com/fabdem/go-perforce"
+)
+
+func TestSubmitOptions(t *testing.T) {
+	srv, p := newChangeServer(t)
+	cl := srv.CreateChange("bob", "ws", "fix a")
+	if err := srv.Open("ws", "edit", "//depot/a.txt", cl); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Open("ws", "edit", "//depot/b@1.txt", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Options not sent to p4
+	n := len(srv.Commands())
+	for _, opts := range []perforce.SubmitOptions{
+		{Changelist: cl, Shelved: true, Reopen: true},
+		{Changelist: cl, Shelved: true, Unchanged: perforce.RevertUnchanged},
+		{Changelist: cl, Shelved: true, IncludeJobs: true},
+		{Changelist: cl, IncludeJobs: true},
+		{Changelist: cl, Description: "fix"},
+		{Unchanged: "keep", Description: "fix"},
+		{},
+	} {
+		if _, err := p.Submit(opts); err == nil {
+			t.Errorf("%+v: no error", opts)
+		}
+	}
+	if _, err := p.SubmitCL(0, ""); err == nil {
+		t.Errorf("default changelist without description: no error")
+	}
+	if len(srv.Commands()) != n {
+		t.Errorf("p4 run: %v", srv.Commands()[n:])
+	}
+
+	res, err := p.Submit(perforce.SubmitOptions{Description: "fix b", IncludeJobs: true, Reopen: true})
+	if err != nil || res.Change <= 0 || len(res.Files) != 1 || res.Files[0].DepotFile != "//depot/b@1.txt" {
+		t.Fatalf("%+v %v", res, err)
+	}
+	if cmd := lastCommand(srv); cmd != "submit -r -s -d fix b" {
+		t.Errorf("%s", cmd)
+	}
+}
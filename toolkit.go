@@ -8,8 +8,8 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -24,6 +24,18 @@ type T_DiffRes struct {
 	AddedLines   int
 	RemovedLines int
 	ChangedLines int
+	Err          error // error diffing this file, set by DiffChangelist() only
+}
+
+// DiffOptions - per call diff options, overriding the instance ones
+type DiffOptions struct {
+	IgnoreSpace bool // changes in spaces and line endings are ignored
+}
+
+// GetDiffOptions()
+//	Returns the diff options of the instance, i.e. to modify them for a single call.
+func (p *Perforce) GetDiffOptions() (opts DiffOptions) {
+	return DiffOptions{IgnoreSpace: p.diffignorespace}
 }
 
 // DiffHRvsWS()
@@ -44,6 +56,16 @@ type T_DiffRes struct {
 func (p *Perforce) DiffHRvsWS(algo string, depotFile string) (res T_DiffRes, err error) {
 	p.logThis(fmt.Sprintf("P4Diff(%s)", depotFile))
 
+	return p.DiffHRvsWSWithOptions(algo, depotFile, p.GetDiffOptions())
+}
+
+// DiffHRvsWSWithOptions()
+//
+// Same as DiffHRvsWS() with options for this call only.
+//
+func (p *Perforce) DiffHRvsWSWithOptions(algo string, depotFile string, opts DiffOptions) (res T_DiffRes, err error) {
+	p.logThis(fmt.Sprintf("DiffHRvsWSWithOptions(%s, %+v)", depotFile, opts))
+
 	res.FileHR = depotFile
 
 	// Get workspace file
@@ -52,10 +74,126 @@ func (p *Perforce) DiffHRvsWS(algo string, depotFile string) (res T_DiffRes, err
 		return res, err
 	}
 
+	return p.diffHRvsWS(algo, depotFile, workspaceFile, opts)
+}
+
+// DiffHRvsWSFiles()
+//
+// Same as DiffHRvsWS() for a list of files.
+//   - Workspace files are located with a single p4 where for all the files
+//	Input params:
+//		- Algo "p4" or "custom"
+//		- Depot files path and name
+//	Output params:
+//   	- Structure with results for each file, in the same order
+//		- Error - processing stops on the first error
+//
+func (p *Perforce) DiffHRvsWSFiles(algo string, depotFiles []string) (res []T_DiffRes, err error) {
+	p.logThis(fmt.Sprintf("DiffHRvsWSFiles(%d files)", len(depotFiles)))
+
+	// Get workspace files
+	where, err := p.WhereMany(depotFiles)
+	if err != nil {
+		return res, err
+	}
+
+	for _, w := range where {
+		if !w.Mapped {
+			return res, fmt.Errorf("DiffHRvsWSFiles() - File not in client view: %s", w.Input)
+		}
+		r, err := p.diffHRvsWS(algo, w.Input, w.Path, p.GetDiffOptions())
+		if err != nil {
+			return res, err
+		}
+		res = append(res, r)
+	}
+
+	return res, nil
+}
+
+// DiffChangelist()
+//
+// Diff head revision vs workspace of the files opened in a pending changelist.
+//   - Files opened for delete are skipped since they're not in the workspace anymore
+//   - Files opened for add, move/add or branch have no head revision: all their lines are added
+//   - A file which can't be diffed doesn't stop the others: its error is set in its result
+//	Input params:
+//		- Algo "p4" or "custom"
+//		- Changelist number
+//	Output params:
+//   	- Structure with results for each file, sorted by depot path
+//		- Error - changelist or workspace files not found
+//
+func (p *Perforce) DiffChangelist(algo string, changelist int) (res []T_DiffRes, err error) {
+	p.logThis(fmt.Sprintf("DiffChangelist(%d)", changelist))
+
+	if algo != "p4" && algo != "custom" {
+		return res, fmt.Errorf("DiffChangelist() - Invalid algorithm name: %s", algo)
+	}
+
+	properties, err := p.GetCLContent(changelist)
+	if err != nil {
+		return res, err
+	}
+
+	var files []string
+	for f, v := range properties.List {
+		if v.Action == "delete" || v.Action == "move/delete" {
+			continue
+		}
+		files = append(files, f)
+	}
+	sort.Strings(files)
+
+	// Get workspace files
+	where, err := p.WhereMany(files)
+	if err != nil {
+		return res, err
+	}
+
+	for _, w := range where {
+		var r T_DiffRes
+		var ferr error
+		switch action := properties.List[w.Input].Action; {
+		case !w.Mapped:
+			ferr = fmt.Errorf("DiffChangelist() - File not in client view: %s", w.Input)
+		case action == "add" || action == "move/add" || action == "branch":
+			r, ferr = p.diffAdded(w.Input, w.Path)
+		default:
+			r, ferr = p.diffHRvsWS(algo, w.Input, w.Path, p.GetDiffOptions())
+		}
+		if ferr != nil {
+			p.logThis(fmt.Sprintf("	%s: %v", w.Input, ferr))
+			r.FileHR, r.FileWS, r.Err = w.Input, w.Path, ferr
+		}
+		res = append(res, r)
+	}
+
+	return res, nil
+}
+
+// Diff of a file without head revision: all the lines of the workspace file are added
+func (p *Perforce) diffAdded(depotFile string, workspaceFile string) (res T_DiffRes, err error) {
+	res.FileHR = depotFile
+	res.FileWS = workspaceFile
+
+	f, err := os.Open(workspaceFile)
+	if err != nil {
+		return res, err
+	}
+	defer f.Close()
+
+	res.NbLinesWS, res.Utf16crlf, err = lineCounter(f)
+	res.AddedLines = res.NbLinesWS
+	return res, err
+}
+
+// Diff of a file in depot and its workspace version
+func (p *Perforce) diffHRvsWS(algo string, depotFile string, workspaceFile string, opts DiffOptions) (res T_DiffRes, err error) {
 	switch algo {
 	case "p4":
 		// Diff workspace file from head revision
-		res, err = p.p4DiffHRvsWS(depotFile, workspaceFile)
+		res, err = p.p4DiffHRvsWS(depotFile, workspaceFile, opts)
 		if err != nil {
 			return res, err
 		}
@@ -71,7 +209,7 @@ func (p *Perforce) DiffHRvsWS(algo string, depotFile string) (res T_DiffRes, err
 		res.NbLinesHR = res.NbLinesWS - res.AddedLines + res.RemovedLines
 
 	case "custom":
-		res, err = p.customDiffHRvsWS(depotFile, workspaceFile)
+		res, err = p.customDiffHRvsWS(depotFile, workspaceFile, opts)
 		if err != nil {
 			return res, err
 		}
@@ -92,7 +230,7 @@ func (p *Perforce) DiffHRvsWS(algo string, depotFile string) (res T_DiffRes, err
 //	p4 diff returns a number of added, modified and deleted lines.
 // 	Do a: p4 -uxxxxx -wyyyyy diff //workspacefile
 //	A workspace name needs to be defined
-//  If p.diffignorespace is set changes in spaces will be ignored.
+//  If opts.IgnoreSpace is set changes in spaces will be ignored.
 // 	Input:
 //		- Name of file in depot to diff - p4 will automatically determine workspace path
 //		- File in workspace
@@ -111,7 +249,7 @@ deleted 2 chunks 7 lines
 changed 1 chunks 3 / 3 lines
 */
 
-func (p *Perforce) p4DiffHRvsWS(fileInDepot string, fileInWS string) (r T_DiffRes, err error) {
+func (p *Perforce) p4DiffHRvsWS(fileInDepot string, fileInWS string, opts DiffOptions) (r T_DiffRes, err error) {
 	p.logThis(fmt.Sprintf("p4DiffHRvsWS(%s, %s)", fileInDepot, fileInWS))
 
 	// Get its line count
@@ -127,26 +265,17 @@ func (p *Perforce) p4DiffHRvsWS(fileInDepot string, fileInWS string) (r T_DiffRe
 		return r, err
 	}
 
-	var out []byte
 	option := "-dls" // Summary output and ignore line endings
-	if p.diffignorespace {
+	if opts.IgnoreSpace {
 		option += "b" // plus changes within spaces will be ignored
 	}
 
 	if len(p.workspace) <= 0 {
 		return r, fmt.Errorf("P4 command line error - a workspace needs to be defined")
 	}
-	if len(p.user) > 0 {
-		// fmt.Printf(p4Cmd + " -u " + user + " -c " + workspace + " diff -dls " + " " + fileInDepot + "\n")
-		out, err = exec.Command(p.p4Cmd, "-u", p.user, "-c", p.workspace, "diff", option, fileInDepot).CombinedOutput()
-		//fmt.Printf("P4 command line result - err=%s\n out=%s\n", err, out)
-	} else {
-		// fmt.Printf(p4Cmd + " -c " + workspace + " diff -dls " + " " + fileInDepot + "\n")
-		out, err = exec.Command(p.p4Cmd, "-c", p.workspace, "diff", option, fileInDepot).CombinedOutput()
-		// out, err := exec.Command(p.p4Cmd, "info").Output()
-	}
+	out, err := p.execP4(nil, "diff", option, EscapePath(fileInDepot))
 	if err != nil {
-		return r, fmt.Errorf("P4 command line error %v  out=%s", err, out)
+		return r, p.errorf("P4 command line error %v  out=%s", err, out)
 	}
 
 	p.logThis(fmt.Sprintf("	Diff response= %s", out))
@@ -173,10 +302,10 @@ func (p *Perforce) p4DiffHRvsWS(fileInDepot string, fileInWS string) (r T_DiffRe
 	// fmt.Printf("in toolkit changedLines=%d\n", changedLines)
 
 	if (err1 != nil) || (err2 != nil) || (err3 != nil) {
-		return r, fmt.Errorf("5 - P4 command line - unexpected response=%s\n", out)
+		return r, p.errorf("5 - P4 command line - unexpected response=%s\n", out)
 	}
 
-	r.FileHR = fileHR
+	r.FileHR = UnescapePath(fileHR)
 	r.FileWS = fileWS
 	r.AddedLines = addedLines
 	r.RemovedLines = removedLines
@@ -192,7 +321,7 @@ func (p *Perforce) p4DiffHRvsWS(fileInDepot string, fileInWS string) (r T_DiffRe
 //	between a file in the workspace and its latest version in depot.
 //  Limitations:
 //  => Works when line order is not important like in a json or vdf loc file.
-//  => If p.diffignorespace is set, changes in spaces, tabs and line endings will be ignored.
+//  => If opts.IgnoreSpace is set, changes in spaces, tabs and line endings will be ignored.
 //	   However, works only with utf8 encoding.
 //
 // 	There is no specific processing depending on encoding but works with utf8 and utf16.
@@ -215,7 +344,7 @@ func (p *Perforce) p4DiffHRvsWS(fileInDepot string, fileInWS string) (r T_DiffRe
 //		- Added, deleted and modified number of lines
 //		- Err code, nil if okay
 
-func (p *Perforce) customDiffHRvsWS(fileInDepot string, fileInWS string) (r T_DiffRes, err error) {
+func (p *Perforce) customDiffHRvsWS(fileInDepot string, fileInWS string, opts DiffOptions) (r T_DiffRes, err error) {
 	p.logThis(fmt.Sprintf("customDiffHRvsWS(%s, %s)", fileInDepot, fileInWS))
 
 	fWS, err := os.Open(fileInWS)
@@ -243,7 +372,7 @@ func (p *Perforce) customDiffHRvsWS(fileInDepot string, fileInWS string) (r T_Di
 	scanner := bufio.NewScanner(tempf)
 	for scanner.Scan() {
 		line := scanner.Text()
-		if p.diffignorespace {
+		if opts.IgnoreSpace {
 			line = strings.Trim(line, " \t\r\n")
 		}
 		if len(line) > 0 {
@@ -260,7 +389,7 @@ func (p *Perforce) customDiffHRvsWS(fileInDepot string, fileInWS string) (r T_Di
 	scanner = bufio.NewScanner(fWS)
 	for scanner.Scan() {
 		line := scanner.Text()
-		if p.diffignorespace {
+		if opts.IgnoreSpace {
 			line = strings.Trim(line, " \t\r\n")
 		}
 		if len(line) > 0 {
@@ -304,17 +433,13 @@ func lineCounter(r io.Reader) (count int, utf16crlf bool, err error) {
 
 	buf := make([]byte, 64*1024)
 	lineSep := []byte{'\n'}
-	utf16LESep := []byte{'\r', 0x00, '\n', 0x00}
-	utf16BESep := []byte{0x00, '\r', 0x00, '\n'}
 
 	for {
 		c, err := r.Read(buf)
 
 		if !utf16crlf {
 			// If utf16 and line endings are cr/lf inform caller.
-			if (bytes.Count(buf[:c], utf16LESep) >= 1) || (bytes.Count(buf[:c], utf16BESep) >= 1) {
-				utf16crlf = true
-			}
+			utf16crlf = isUTF16CRLF(buf[:c])
 		}
 
 		count += bytes.Count(buf[:c], lineSep)
@@ -327,5 +452,4 @@ func lineCounter(r io.Reader) (count int, utf16crlf bool, err error) {
 			return count, utf16crlf, err
 		}
 	}
-	return count, utf16crlf, nil
 }
@@ -0,0 +1,123 @@
+package perforce_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	perforce "github.com/fabdem/go-perforce"
+	"github.com/fabdem/go-perforce/perforcetest"
+)
+
+func TestWhereMany(t *testing.T) {
+	srv := perforcetest.NewServer()
+	root := t.TempDir()
+	if err := srv.AddClient("ws", root, "//depot/... //ws/...", "-//depot/tmp/... //ws/tmp/..."); err != nil {
+		t.Fatal(err)
+	}
+	p := srv.Perforce("bob", "ws")
+
+	files := []string{"//depot/a.txt", "//depot/tmp/x.log", "//other/b.txt", filepath.Join(root, "c.txt")}
+	res, err := p.WhereMany(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 4 {
+		t.Fatalf("%+v", res)
+	}
+	if w := res[0]; !w.Mapped || w.Input != files[0] || w.ClientFile != "//ws/a.txt" || w.Path != filepath.Join(root, "a.txt") {
+		t.Errorf("mapped: %+v", w)
+	}
+	if w := res[1]; w.Mapped || w.Input != files[1] {
+		t.Errorf("excluded: %+v", w)
+	}
+	if w := res[2]; w.Mapped || w.Input != files[2] {
+		t.Errorf("not in view: %+v", w)
+	}
+	if w := res[3]; !w.Mapped || w.DepotFile != "//depot/c.txt" {
+		t.Errorf("local path: %+v", w)
+	}
+	if n := len(srv.Commands()); n != 1 {
+		t.Errorf("%d calls", n)
+	}
+}
+
+// Changelist with an edit, an add, a move, a delete and an edit which local file was removed
+func TestDiffChangelist(t *testing.T) {
+	for _, algo := range []string{"p4", "custom"} {
+		srv := perforcetest.NewServer()
+		root := t.TempDir()
+		if err := srv.AddClient("ws", root, "//depot/... //ws/..."); err != nil {
+			t.Fatal(err)
+		}
+		srv.AddFile("//depot/a.txt", "text", "a\nb\n")
+		srv.AddFile("//depot/b.txt", "text", "b\n")
+		srv.AddFile("//depot/c.txt", "text", "c\n")
+		srv.AddFile("//depot/gone.txt", "text", "g\n")
+		if err := srv.Sync("ws"); err != nil {
+			t.Fatal(err)
+		}
+		cl := srv.CreateChange("bob", "ws", "diff")
+		for file, action := range map[string]string{"//depot/a.txt": "edit", "//depot/c.txt": "delete", "//depot/gone.txt": "edit", "//depot/new.txt": "add"} {
+			if err := srv.Open("ws", action, file, cl); err != nil {
+				t.Fatal(err)
+			}
+		}
+		os.WriteFile(filepath.Join(root, "a.txt"), []byte("a\nB\n"), 0644)
+		os.WriteFile(filepath.Join(root, "new.txt"), []byte("1\n2\n3\n"), 0644)
+		os.Remove(filepath.Join(root, "gone.txt"))
+		p := srv.Perforce("bob", "ws")
+		if _, err := p.Move(perforce.NewFileSpec("//depot/b.txt", perforce.RevSpec{}), perforce.NewFileSpec("//depot/moved/b.txt", perforce.RevSpec{}), perforce.MoveOptions{Changelist: cl}); err != nil {
+			t.Fatal(err)
+		}
+
+		before := len(srv.Commands())
+		res, err := p.DiffChangelist(algo, cl)
+		if err != nil {
+			t.Fatalf("%s: %v", algo, err)
+		}
+		var files []string
+		for _, r := range res {
+			files = append(files, r.FileHR)
+		}
+		if strings.Join(files, " ") != "//depot/a.txt //depot/gone.txt //depot/moved/b.txt //depot/new.txt" {
+			t.Fatalf("%s: files %v", algo, files)
+		}
+		if r := res[0]; r.Err != nil || r.AddedLines+r.ChangedLines != 1 {
+			t.Errorf("%s: edit %+v", algo, r)
+		}
+		if r := res[1]; r.Err == nil || r.FileWS != filepath.Join(root, "gone.txt") {
+			t.Errorf("%s: missing local file %+v", algo, r)
+		}
+		if r := res[2]; r.Err != nil || r.AddedLines != 1 || r.NbLinesWS != 1 || r.NbLinesHR != 0 {
+			t.Errorf("%s: move/add %+v", algo, r)
+		}
+		if r := res[3]; r.Err != nil || r.AddedLines != 3 || r.NbLinesWS != 3 || r.FileWS != filepath.Join(root, "new.txt") {
+			t.Errorf("%s: add %+v", algo, r)
+		}
+
+		// Nothing asked to the server about the files without head revision
+		for _, c := range srv.Commands()[before:] {
+			if cmd := strings.Join(c, " "); (strings.Contains(cmd, " diff ") || strings.Contains(cmd, " print ")) &&
+				(strings.Contains(cmd, "new.txt") || strings.Contains(cmd, "moved/b.txt")) {
+				t.Errorf("%s: %s", algo, cmd)
+			}
+		}
+	}
+}
+
+func TestDiffChangelistErrors(t *testing.T) {
+	srv := perforcetest.NewServer()
+	srv.AddClient("ws", t.TempDir(), "//depot/... //ws/...")
+	p := srv.Perforce("bob", "ws")
+	if _, err := p.DiffChangelist("other", 1); err == nil || len(srv.Commands()) != 0 {
+		t.Errorf("invalid algo: %v %v", err, srv.Commands())
+	}
+	if _, err := p.DiffChangelist("p4", 99); err == nil {
+		t.Errorf("unknown changelist: no error")
+	}
+	if _, err := p.DiffHRvsWSFiles("p4", []string{"//other/b.txt"}); err == nil {
+		t.Errorf("not in view: no error")
+	}
+}
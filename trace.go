@@ -0,0 +1,152 @@
+package perforce
+
+// Tracing of the p4 invocations: structured logging (log/slog) and hooks.
+//
+// Each p4 invocation is logged by the slog logger of the instance (Options.Logger)
+// with the attributes: command, args, duration, exitCode, bytesOut and changelist
+// when there's one. Successful commands are logged at debug level, failures at warn
+// level and commands that couldn't be run at error level.
+//
+// Hooks.BeforeCommand and Hooks.AfterCommand are called around each invocation,
+// i.e. to create OpenTelemetry spans or update Prometheus metrics:
+//
+//	hooks := perforce.Hooks{
+//		BeforeCommand: func(e *perforce.CommandEvent) {
+//			_, e.Data = tracer.Start(ctx, "p4 "+e.Command)
+//		},
+//		AfterCommand: func(e *perforce.CommandEvent) {
+//			p4Duration.WithLabelValues(e.Command).Observe(e.Duration.Seconds())
+//			e.Data.(trace.Span).End()
+//		},
+//	}
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// CommandEvent - a p4 invocation, passed to the hooks
+type CommandEvent struct {
+	Command    string        // p4 command i.e. "submit"
+	Args       []string      // command line without the p4 executable, redacted (see RedactPolicy)
+	Changelist int           // changelist the command applies to, 0 if none or unknown
+	Start      time.Time     // when the command was started
+	Duration   time.Duration // set for AfterCommand
+	ExitCode   int           // set for AfterCommand
+	BytesOut   int           // size of the output, set for AfterCommand
+	Err        error         // set for AfterCommand, error returned to the caller if any
+	Data       interface{}   // free for the hooks, i.e. to keep a span between BeforeCommand and AfterCommand
+}
+
+// Hooks - functions called around each p4 invocation. Either may be nil.
+// They may be called concurrently if the instance is shared between goroutines.
+type Hooks struct {
+	BeforeCommand func(e *CommandEvent)
+	AfterCommand  func(e *CommandEvent)
+}
+
+// WithLogger()
+//	Returns a copy of the instance logging to a slog logger.
+//	The traces of logThis() are sent at debug level whatever SetDebug() is.
+func (p *Perforce) WithLogger(logger *slog.Logger) *Perforce {
+	c := *p
+	c.logger = logger
+	return &c
+}
+
+// WithHooks()
+//	Returns a copy of the instance calling hooks around each p4 invocation.
+func (p *Perforce) WithHooks(hooks Hooks) *Perforce {
+	c := *p
+	c.hooks = hooks
+	return &c
+}
+
+// Global options followed by a value
+var globalOptionsWithValue = map[string]bool{
+	"-u": true, "-c": true, "-p": true, "-P": true, "-H": true, "-C": true,
+	"-d": true, "-L": true, "-r": true, "-v": true, "-Q": true, "-z": true, "-x": true, "-b": true,
+}
+
+// Index of the command in a command line: first arg after the global options
+func commandIndex(args []string) int {
+	i := 0
+	for i < len(args) && len(args[i]) > 1 && args[i][0] == '-' {
+		if globalOptionsWithValue[args[i]] {
+			i++
+		}
+		i++
+	}
+	return i
+}
+
+// newCommandEvent()
+//	Identify the command and changelist of a command line.
+func newCommandEvent(args []string) *CommandEvent {
+	e := &CommandEvent{Args: args, Start: time.Now()}
+
+	i := commandIndex(args)
+	if i >= len(args) {
+		return e
+	}
+	e.Command = args[i]
+
+	// Changelist: -c <n> (submit, reopen, shelve...), submit -e <n> or argument of change/describe
+	cmdArgs := args[i+1:]
+	for j, a := range cmdArgs {
+		switch {
+		case (a == "-c" || (a == "-e" && e.Command == "submit")) && j+1 < len(cmdArgs):
+			if cl, err := strconv.Atoi(cmdArgs[j+1]); err == nil {
+				e.Changelist = cl
+			}
+		case len(a) > 2 && a[:2] == "-c":
+			if cl, err := strconv.Atoi(a[2:]); err == nil {
+				e.Changelist = cl
+			}
+		case e.Command == "change" || e.Command == "changelist" || e.Command == "describe":
+			if cl, err := strconv.Atoi(a); err == nil {
+				e.Changelist = cl
+			}
+		}
+	}
+	return e
+}
+
+// Report the end of a p4 invocation to the logger and the hooks
+func (p *Perforce) traceCommand(e *CommandEvent) {
+	e.Duration = time.Since(e.Start)
+	if p.hooks.AfterCommand != nil {
+		p.hooks.AfterCommand(e)
+	}
+	if p.logger == nil {
+		return
+	}
+
+	level := slog.LevelDebug
+	switch {
+	case e.ExitCode == 0 && e.Err != nil:
+		level = slog.LevelError
+	case e.ExitCode != 0:
+		level = slog.LevelWarn
+	}
+	ctx := context.Background()
+	if !p.logger.Enabled(ctx, level) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("command", e.Command),
+		slog.Any("args", e.Args),
+		slog.Duration("duration", e.Duration),
+		slog.Int("exitCode", e.ExitCode),
+		slog.Int("bytesOut", e.BytesOut),
+	}
+	if e.Changelist > 0 {
+		attrs = append(attrs, slog.Int("changelist", e.Changelist))
+	}
+	if e.Err != nil {
+		attrs = append(attrs, slog.String("error", p.Redact(e.Err.Error())))
+	}
+	p.logger.LogAttrs(ctx, level, "p4 "+e.Command, attrs...)
+}
@@ -0,0 +1,88 @@
+package perforce_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+
+	perforce "github.com/fabdem/go-perforce"
+	"github.com/fabdem/go-perforce/perforcetest"
+)
+
+func TestHooks(t *testing.T) {
+	srv := perforcetest.NewServer()
+	srv.AddClient("ws", t.TempDir(), "//depot/... //ws/...")
+	srv.AddFile("//depot/a.txt", "text", "a\n")
+	cl := srv.CreateChange("bob", "ws", "hooked")
+
+	var before, after []perforce.CommandEvent
+	p := srv.Perforce("bob", "ws").WithHooks(perforce.Hooks{
+		BeforeCommand: func(e *perforce.CommandEvent) {
+			e.Data = len(before)
+			before = append(before, *e)
+		},
+		AfterCommand: func(e *perforce.CommandEvent) { after = append(after, *e) },
+	})
+
+	if _, err := p.GetCLSpecProperties(cl); err != nil {
+		t.Fatal(err)
+	}
+	srv.Fail("files", "Connect to server failed; check $P4PORT.\n", 1)
+	if _, err := p.GetHeadRev("//depot/a.txt"); err == nil {
+		t.Errorf("no error")
+	}
+
+	// change -o, info for the dates of the spec, files
+	if len(before) != 3 || len(after) != 3 {
+		t.Fatalf("%d %d", len(before), len(after))
+	}
+	e := after[0]
+	if e.Command != "change" || e.Changelist != cl || strings.Join(e.Args, " ") != "-u bob -c ws change -o "+strconv.Itoa(cl) ||
+		e.ExitCode != 0 || e.Err != nil || e.BytesOut <= 0 || e.Data != 0 {
+		t.Errorf("%+v", e)
+	}
+	if e = after[2]; e.Command != "files" || e.Changelist != 0 || e.ExitCode != 1 || e.Err == nil || e.Data != 2 {
+		t.Errorf("%+v", e)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	srv := perforcetest.NewServer()
+	srv.AddClient("ws", t.TempDir(), "//depot/... //ws/...")
+	srv.AddFile("//depot/a.txt", "text", "a\n")
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	p := srv.Perforce("bob", "ws").WithLogger(logger)
+	if _, err := p.GetHeadRev("//depot/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	srv.Fail("files", "Perforce password (P4PASSWD) invalid or unset.\n", 1)
+	p.GetHeadRev("//depot/a.txt")
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	var commands []string
+	for _, l := range lines {
+		if strings.Contains(l, "command=") {
+			commands = append(commands, l)
+		}
+	}
+	if len(commands) != 2 ||
+		!strings.Contains(commands[0], "level=DEBUG") || !strings.Contains(commands[0], `msg="p4 files"`) || !strings.Contains(commands[0], "exitCode=0") ||
+		!strings.Contains(commands[1], "level=WARN") || !strings.Contains(commands[1], "exitCode=1") || !strings.Contains(commands[1], "error=") {
+		t.Errorf("%s", logs.String())
+	}
+	// Traces of logThis() at debug level
+	if !strings.Contains(logs.String(), "GetHeadRev(//depot/a.txt)") {
+		t.Errorf("%s", logs.String())
+	}
+
+	// Nothing below the level of the handler
+	logs.Reset()
+	p = p.WithLogger(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	if _, err := p.GetHeadRev("//depot/a.txt"); err != nil || logs.Len() != 0 {
+		t.Errorf("%v %s", err, logs.String())
+	}
+}
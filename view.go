@@ -0,0 +1,420 @@
+package perforce
+
+// View mappings computed locally.
+//
+// Implements Perforce mapping semantics to translate depot, client (workspace)
+// and local paths without a server call:
+//	- wildcards: "..." any characters including /, "*" any characters except /,
+//	  "%%1" to "%%9" positional wildcards (like "*" but matched by number)
+//	- later lines take precedence over earlier ones
+//	- exclusion lines "-//depot/..." unmap what the earlier lines mapped
+//	- overlay lines "+//depot/..." don't hide earlier lines mapping to the same client path
+//	- ditto lines "&//depot/..." map a depot file to an additional client path
+//	- case sensitivity depends on the server (see ViewMap.CaseInsensitive, set from
+//	  p4 info by GetViewMap())
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Mapping types - prefix of a view line
+const (
+	MapInclude = ""
+	MapExclude = "-"
+	MapOverlay = "+"
+	MapDitto   = "&"
+)
+
+// ViewMapping - one line of a view
+type ViewMapping struct {
+	Type  string // MapInclude, MapExclude, MapOverlay or MapDitto
+	Left  string // Depot side i.e. //depot/main/...
+	Right string // Client side i.e. //my_ws/main/... or depot side for a branch view
+
+	left  *mapSide
+	right *mapSide
+}
+
+// ViewMap - ordered list of mappings
+type ViewMap struct {
+	Mappings        []ViewMapping
+	CaseInsensitive bool   // Server is case insensitive (i.e. Windows server)
+	Client          string // Workspace name, to translate client <-> local paths
+	Root            string // Workspace root, to translate client <-> local paths
+}
+
+// One side of a mapping compiled in a regex
+type mapSide struct {
+	pattern   string
+	tokens    []mapToken
+	regex     *regexp.Regexp
+	regexFold *regexp.Regexp // case insensitive version
+}
+
+// Literal text or wildcard
+type mapToken struct {
+	literal  string
+	wildcard string // "...", "*" or "%%n"
+}
+
+// ParseViewMap()
+//	Create a view map from view lines as found in a client, label or branch spec.
+//	i.e. "//depot/main/... //my_ws/main/..." or "-//depot/main/tmp/... //my_ws/main/tmp/..."
+//	Paths containing spaces are double-quoted.
+func ParseViewMap(lines []string) (v *ViewMap, err error) {
+	v = &ViewMap{}
+	for _, line := range lines {
+		if len(strings.TrimSpace(line)) <= 0 {
+			continue
+		}
+		words := splitSpecWords(line)
+		if len(words) != 2 {
+			return nil, fmt.Errorf("Error parsing view - expecting 2 paths: %s", line)
+		}
+		if len(words[0]) <= 0 || len(words[1]) <= 0 {
+			return nil, fmt.Errorf("Error parsing view - empty path: %s", line)
+		}
+		var m ViewMapping
+		if strings.ContainsAny(words[0][:1], "-+&") {
+			m.Type, words[0] = words[0][:1], words[0][1:]
+		}
+		m.Left, m.Right = words[0], words[1]
+		if err = v.add(m); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// Add()
+//	Append a mapping to the view. Later mappings take precedence.
+func (v *ViewMap) Add(mappingType string, left string, right string) (err error) {
+	return v.add(ViewMapping{Type: mappingType, Left: left, Right: right})
+}
+
+func (v *ViewMap) add(m ViewMapping) (err error) {
+	switch m.Type {
+	case MapInclude, MapExclude, MapOverlay, MapDitto:
+	default:
+		return fmt.Errorf("Invalid mapping type: %s", m.Type)
+	}
+	if m.left, err = compileMapSide(m.Left); err != nil {
+		return err
+	}
+	if m.right, err = compileMapSide(m.Right); err != nil {
+		return err
+	}
+	// Wildcards need to match on both sides
+	if m.left.wildcards() != m.right.wildcards() {
+		return fmt.Errorf("Error parsing view - wildcards mismatch: %s %s", m.Left, m.Right)
+	}
+	v.Mappings = append(v.Mappings, m)
+	return nil
+}
+
+// Lines()
+//	Returns the view lines as expected in a spec. Paths containing spaces are double-quoted.
+func (v *ViewMap) Lines() (lines []string) {
+	for _, m := range v.Mappings {
+		lines = append(lines, quoteSpecWord(m.Type+m.Left)+" "+quoteSpecWord(m.Right))
+	}
+	return lines
+}
+
+// String()
+func (v *ViewMap) String() string {
+	return strings.Join(v.Lines(), "\n")
+}
+
+// DepotToClient()
+//	Translate a depot path into a client path.
+//	Returns false if the file isn't mapped (not in the view or excluded).
+func (v *ViewMap) DepotToClient(depotPath string) (clientPath string, mapped bool) {
+	return v.translate(depotPath, false)
+}
+
+// ClientToDepot()
+//	Translate a client path into a depot path.
+//	Returns false if the file isn't mapped (not in the view or excluded).
+func (v *ViewMap) ClientToDepot(clientPath string) (depotPath string, mapped bool) {
+	return v.translate(clientPath, true)
+}
+
+// DepotToLocal()
+//	Translate a depot path into a local path (requires Client and Root).
+//	Returns false if the file isn't mapped.
+func (v *ViewMap) DepotToLocal(depotPath string) (localPath string, mapped bool) {
+	clientPath, mapped := v.DepotToClient(depotPath)
+	if !mapped {
+		return "", false
+	}
+	return v.ClientToLocal(clientPath)
+}
+
+// LocalToDepot()
+//	Translate a local path into a depot path (requires Client and Root).
+//	Returns false if the file isn't mapped.
+func (v *ViewMap) LocalToDepot(localPath string) (depotPath string, mapped bool) {
+	clientPath, mapped := v.LocalToClient(localPath)
+	if !mapped {
+		return "", false
+	}
+	return v.ClientToDepot(clientPath)
+}
+
+// ClientToLocal()
+//	Translate a client path //<client>/a/file into a local path <root>/a/file.
+//	The path separator is the one used by the root.
+//	The client path is escaped (p4 syntax), the local path isn't (see EscapePath()).
+//	Returns false if the path doesn't belong to the client.
+func (v *ViewMap) ClientToLocal(clientPath string) (localPath string, mapped bool) {
+	prefix := "//" + v.Client + "/"
+	if len(v.Client) <= 0 || len(clientPath) < len(prefix) || !v.equal(clientPath[:len(prefix)], prefix) {
+		return "", false
+	}
+	rel := clientPath[len(prefix):]
+	sep := rootSeparator(v.Root)
+	if sep != "/" {
+		rel = strings.ReplaceAll(rel, "/", sep)
+	}
+	return strings.TrimRight(v.Root, `/\`) + sep + UnescapePath(rel), true
+}
+
+// LocalToClient()
+//	Translate a local path <root>/a/file into a client path //<client>/a/file.
+//	The local path isn't escaped, the client path is (p4 syntax).
+//	Returns false if the path is not under the workspace root.
+func (v *ViewMap) LocalToClient(localPath string) (clientPath string, mapped bool) {
+	if len(v.Client) <= 0 || len(v.Root) <= 0 {
+		return "", false
+	}
+	root := strings.ReplaceAll(strings.TrimRight(v.Root, `/\`), `\`, "/") + "/"
+	path := strings.ReplaceAll(localPath, `\`, "/")
+	// Windows paths are case insensitive
+	if len(path) < len(root) || !(v.equal(path[:len(root)], root) || (rootSeparator(v.Root) == `\` && strings.EqualFold(path[:len(root)], root))) {
+		return "", false
+	}
+	return "//" + v.Client + "/" + EscapePath(path[len(root):]), true
+}
+
+// Translate a path from the left side to the right side (or the other way around).
+// The last mapping matching wins; a later mapping to the same target path hides an earlier one
+// unless it's an overlay or a ditto mapping.
+func (v *ViewMap) translate(path string, reverse bool) (result string, mapped bool) {
+	sides := func(m *ViewMapping) (from *mapSide, to *mapSide) {
+		left, right := m.left, m.right
+		if left == nil || right == nil { // Mapping not added with Add()
+			left, _ = compileMapSide(m.Left)
+			right, _ = compileMapSide(m.Right)
+			if left == nil || right == nil {
+				left, right = &mapSide{}, &mapSide{}
+			}
+		}
+		if reverse {
+			return right, left
+		}
+		return left, right
+	}
+
+	// Ditto mappings are only used when no other mapping applies
+	for _, ditto := range []bool{false, true} {
+		for i := len(v.Mappings) - 1; i >= 0; i-- {
+			m := &v.Mappings[i]
+			if (m.Type == MapDitto) != ditto {
+				continue
+			}
+			from, to := sides(m)
+			captures := from.match(path, v.CaseInsensitive)
+			if captures == nil {
+				continue
+			}
+			if m.Type == MapExclude {
+				return "", false
+			}
+			result = to.expand(from, captures)
+
+			// Check the target isn't excluded or hidden by a later mapping
+			for j := i + 1; j < len(v.Mappings); j++ {
+				n := &v.Mappings[j]
+				_, nto := sides(n)
+				if nto.match(result, v.CaseInsensitive) == nil {
+					continue
+				}
+				if n.Type == MapExclude || (n.Type == MapInclude && m.Type != MapDitto) {
+					return "", false
+				}
+			}
+			return result, true
+		}
+	}
+	return "", false
+}
+
+// Compile one side of a mapping
+func compileMapSide(pattern string) (s *mapSide, err error) {
+	if !strings.HasPrefix(pattern, "//") {
+		return nil, fmt.Errorf("Error parsing view - path should start with //: %s", pattern)
+	}
+	s = &mapSide{pattern: pattern}
+	var re strings.Builder
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			s.tokens = append(s.tokens, mapToken{literal: lit.String()})
+			re.WriteString(regexp.QuoteMeta(lit.String()))
+			lit.Reset()
+		}
+	}
+	for i := 0; i < len(pattern); {
+		switch {
+		case strings.HasPrefix(pattern[i:], "..."):
+			flush()
+			s.tokens = append(s.tokens, mapToken{wildcard: "..."})
+			re.WriteString("(.*)")
+			i += 3
+		case pattern[i] == '*':
+			flush()
+			s.tokens = append(s.tokens, mapToken{wildcard: "*"})
+			re.WriteString("([^/]*)")
+			i++
+		case strings.HasPrefix(pattern[i:], "%%") && i+2 < len(pattern) && pattern[i+2] >= '0' && pattern[i+2] <= '9':
+			if pattern[i+2] == '0' {
+				return nil, fmt.Errorf("Error parsing view - positional wildcards are %%%%1 to %%%%9: %s", pattern)
+			}
+			flush()
+			s.tokens = append(s.tokens, mapToken{wildcard: pattern[i : i+3]})
+			re.WriteString("([^/]*)")
+			i += 3
+		default:
+			lit.WriteByte(pattern[i])
+			i++
+		}
+	}
+	flush()
+
+	if s.regex, err = regexp.Compile("^" + re.String() + "$"); err != nil {
+		return nil, fmt.Errorf("Regex compile error: %v", err)
+	}
+	if s.regexFold, err = regexp.Compile("(?i)^" + re.String() + "$"); err != nil {
+		return nil, fmt.Errorf("Regex compile error: %v", err)
+	}
+	return s, nil
+}
+
+// Wildcards signature used to check both sides of a mapping are consistent
+func (s *mapSide) wildcards() string {
+	var positional, other int
+	var numbers []string
+	for _, t := range s.tokens {
+		switch {
+		case strings.HasPrefix(t.wildcard, "%%"):
+			positional++
+			numbers = append(numbers, t.wildcard)
+		case len(t.wildcard) > 0:
+			other++
+		}
+	}
+	// Positional wildcards may be in any order
+	for i := 0; i < len(numbers); i++ {
+		for j := i + 1; j < len(numbers); j++ {
+			if numbers[j] < numbers[i] {
+				numbers[i], numbers[j] = numbers[j], numbers[i]
+			}
+		}
+	}
+	return fmt.Sprintf("%d %d %v", other, positional, numbers)
+}
+
+// Returns the text matched by each wildcard or nil if the path doesn't match
+func (s *mapSide) match(path string, caseInsensitive bool) (captures []string) {
+	if s.regex == nil {
+		return nil
+	}
+	re := s.regex
+	if caseInsensitive {
+		re = s.regexFold
+	}
+	m := re.FindStringSubmatch(path)
+	if m == nil {
+		return nil
+	}
+	return m[1:]
+}
+
+// Build a path from this side replacing its wildcards with the text captured on the other side
+func (s *mapSide) expand(from *mapSide, captures []string) string {
+	// Index captures: positional by number, the others by order
+	var ordered []string
+	positional := make(map[string]string)
+	k := 0
+	for _, t := range from.tokens {
+		if len(t.wildcard) <= 0 {
+			continue
+		}
+		if strings.HasPrefix(t.wildcard, "%%") {
+			positional[t.wildcard] = captures[k]
+		} else {
+			ordered = append(ordered, captures[k])
+		}
+		k++
+	}
+
+	var sb strings.Builder
+	k = 0
+	for _, t := range s.tokens {
+		switch {
+		case len(t.wildcard) <= 0:
+			sb.WriteString(t.literal)
+		case strings.HasPrefix(t.wildcard, "%%"):
+			sb.WriteString(positional[t.wildcard])
+		default:
+			if k < len(ordered) {
+				sb.WriteString(ordered[k])
+			}
+			k++
+		}
+	}
+	return sb.String()
+}
+
+func (v *ViewMap) equal(a string, b string) bool {
+	if v.CaseInsensitive {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// Path separator used by a workspace root
+func rootSeparator(root string) string {
+	if strings.Contains(root, `\`) || (len(root) >= 2 && root[1] == ':') {
+		return `\`
+	}
+	return "/"
+}
+
+// Double-quote a path containing spaces
+func quoteSpecWord(word string) string {
+	if strings.ContainsAny(word, " \t") {
+		return `"` + word + `"`
+	}
+	return word
+}
+
+// GetViewMap()
+//	Get the view of a workspace to translate paths locally.
+// 	Input:
+//		- workspace - optional if not present uses current workspace
+//  Return:
+//		- view map with workspace name and root set
+//		- err code, nil if okay
+func (p *Perforce) GetViewMap(workspace string) (v *ViewMap, err error) {
+	p.logThis(fmt.Sprintf("GetViewMap(%s)", workspace))
+
+	properties, err := p.GetWorkspaceProperties(workspace)
+	if err != nil {
+		return nil, err
+	}
+	return properties.ViewMap, nil
+}
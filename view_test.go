@@ -0,0 +1,320 @@
+package perforce
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Workspace views checked against expected p4 where outputs. For each view,
+// testdata/where/<name>.jsonl holds p4 client -o, p4 -ztag info and p4 -ztag where <path>
+// invocations in the Recorder format. They're written by hand from the same reading
+// of the mapping rules as view.go, not recorded against a server: they check the
+// parsing of the spec and of the p4 outputs, not the rules (see TestViewMap for those).
+// To replace them with recordings (the workspace bob_ws is created or replaced, the
+// user is the one of the environment):
+//	P4_RECORD_WHERE=1 go test -run TestViewMapWhereFixtures
+// The view of a case insensitive server can only be recorded on such a server.
+var whereCases = []struct {
+	name            string
+	caseInsensitive bool
+	root            string
+	view            []string
+	paths           []string // depot or client paths given to p4 where
+}{
+	{
+		name: "exclusions",
+		root: "/home/bob/ws",
+		view: []string{
+			"//depot/main/... //bob_ws/main/...",
+			"-//depot/main/tmp/... //bob_ws/main/tmp/...",
+			"//depot/rel/....c //bob_ws/rel/....c",
+			`"//depot/sp ace/..." "//bob_ws/sp ace/..."`,
+		},
+		paths: []string{"//bob_ws/main/tmp/y.log", "//depot/Main/src/a.c", "//depot/main/src/a.c", "//depot/main/tmp/x.log",
+			"//depot/rel/lib/b.c", "//depot/rel/lib/b.h", "//depot/sp ace/f.txt"},
+	},
+	{
+		name: "overlay",
+		root: "/home/bob/ws",
+		view: []string{
+			"//depot/app/... //bob_ws/app/...",
+			"+//depot/patch/... //bob_ws/app/...",
+		},
+		paths: []string{"//bob_ws/app/a.c", "//depot/app/a.c", "//depot/patch/a.c"},
+	},
+	{
+		name: "hidden", // a later line hides an earlier one
+		root: "/home/bob/ws",
+		view: []string{
+			"//depot/v1/... //bob_ws/lib/...",
+			"//depot/v2/... //bob_ws/lib/...",
+		},
+		paths: []string{"//bob_ws/lib/a.c", "//depot/v1/a.c", "//depot/v2/a.c"},
+	},
+	{
+		name: "ditto",
+		root: "/home/bob/ws",
+		view: []string{
+			"//depot/main/... //bob_ws/main/...",
+			"&//depot/main/shared/... //bob_ws/shared/...",
+		},
+		paths: []string{"//bob_ws/main/shared/x.h", "//bob_ws/shared/x.h", "//depot/main/shared/x.h"},
+	},
+	{
+		name: "positional",
+		root: "/home/bob/ws",
+		view: []string{
+			"//depot/loc/%%1/%%2.txt //bob_ws/text/%%2/%%1.txt",
+			"//depot/img/*.png //bob_ws/img/*.png",
+		},
+		paths: []string{"//bob_ws/text/menu/fr.txt", "//depot/img/logo.png", "//depot/img/sub/logo.png", "//depot/loc/fr/menu.txt"},
+	},
+	{
+		name:            "case-insensitive",
+		caseInsensitive: true,
+		root:            `C:\ws\bob`,
+		view: []string{
+			"//depot/Main/... //bob_ws/main/...",
+			"-//depot/Main/Build/... //bob_ws/main/build/...",
+		},
+		paths: []string{"//BOB_WS/Main/a.c", "//depot/MAIN/a.c", "//depot/main/build/x.obj"},
+	},
+}
+
+func TestViewMapWhereFixtures(t *testing.T) {
+	for _, wc := range whereCases {
+		fixture := filepath.Join("testdata", "where", wc.name+".jsonl")
+		if len(os.Getenv("P4_RECORD_WHERE")) > 0 {
+			recordWhere(t, fixture, wc.root, wc.view, wc.paths, wc.caseInsensitive)
+		}
+
+		rep, err := NewReplayer(fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := NewWithRunner("", "bob_ws", rep)
+		v, err := p.GetViewMap("bob_ws")
+		if err != nil {
+			t.Fatalf("%s: %v", wc.name, err)
+		}
+		if v.CaseInsensitive != wc.caseInsensitive {
+			t.Errorf("%s: case insensitive %t", wc.name, v.CaseInsensitive)
+		}
+
+		for _, path := range wc.paths {
+			out, _ := p.execP4(nil, "-ztag", "where", EscapePath(path))
+			records, _ := parseZtag(out)
+			fromDepot := strings.HasPrefix(strings.ToLower(path), "//depot/")
+			var got string
+			var mapped bool
+			if fromDepot {
+				got, mapped = v.DepotToClient(path)
+			} else {
+				got, mapped = v.ClientToDepot(path)
+			}
+
+			// Several records for a ditto mapping: the translation is one of them
+			var want []string
+			for _, r := range records {
+				if _, unmap := r["unmap"]; unmap {
+					continue
+				}
+				if fromDepot {
+					want = append(want, UnescapePath(r["clientFile"]))
+				} else {
+					want = append(want, UnescapePath(r["depotFile"]))
+				}
+			}
+			if len(want) <= 0 {
+				if mapped {
+					t.Errorf("%s: %s mapped to %s, fixture: not mapped", wc.name, path, got)
+				}
+				continue
+			}
+			found := false
+			for _, w := range want {
+				found = found || (mapped && w == got)
+			}
+			if !found {
+				t.Errorf("%s: %s mapped to %s (%t), fixture: %v", wc.name, path, got, mapped, want)
+			}
+			if fromDepot && len(records) == 1 {
+				if local, _ := v.DepotToLocal(path); local != records[0]["path"] {
+					t.Errorf("%s: %s local path %s, fixture: %s", wc.name, path, local, records[0]["path"])
+				}
+			}
+		}
+		if unused := rep.Unused(); len(unused) > 0 {
+			t.Errorf("%s: recordings not replayed: %v", wc.name, unused)
+		}
+	}
+}
+
+// Record the p4 where outputs of a view in a fixture file, with the p4 of the environment
+func recordWhere(t *testing.T, fixture string, root string, view []string, paths []string, caseInsensitive bool) {
+	p, err := New("", "bob_ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := p.GetServerInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.CaseInsensitive != caseInsensitive {
+		t.Logf("%s not recorded: server case handling %s", fixture, info.CaseHandling)
+		return
+	}
+
+	spec, err := p.GetSpec("client", "bob_ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec.Set("Root", root)
+	spec.Set("Host", "")
+	spec.Delete("Stream")
+	spec.SetLines("View", view)
+	if _, err = p.PutSpec("client", spec, "-f"); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Remove(fixture)
+	q := NewWithRunner("", "bob_ws", NewRecorder(p.GetRunner(), fixture))
+	if _, err = q.GetViewMap("bob_ws"); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		q.execP4(nil, "-ztag", "where", EscapePath(path))
+	}
+}
+
+// Translations spelled out, for the rules easy to get wrong
+func TestViewMap(t *testing.T) {
+	for _, vc := range []struct {
+		name            string
+		caseInsensitive bool
+		view            []string
+		depotToClient   map[string]string // "" for a path not mapped
+		clientToDepot   map[string]string
+	}{
+		{
+			name: "exclusion order", // an exclusion only unmaps the lines before it
+			view: []string{
+				"-//depot/main/doc/... //ws/main/doc/...",
+				"//depot/main/... //ws/main/...",
+				"-//depot/main/tmp/... //ws/main/tmp/...",
+				"//depot/main/tmp/keep/... //ws/main/tmp/keep/...",
+			},
+			depotToClient: map[string]string{
+				"//depot/main/doc/a.txt":      "//ws/main/doc/a.txt",
+				"//depot/main/tmp/x.log":      "",
+				"//depot/main/tmp/keep/y.log": "//ws/main/tmp/keep/y.log",
+				"//depot/main/tmpx/z.log":     "//ws/main/tmpx/z.log",
+			},
+			clientToDepot: map[string]string{
+				"//ws/main/tmp/x.log":      "",
+				"//ws/main/tmp/keep/y.log": "//depot/main/tmp/keep/y.log",
+			},
+		},
+		{
+			name: "overlay", // both depot paths are mapped, the later line wins on the client side
+			view: []string{
+				"//depot/app/... //ws/app/...",
+				"+//depot/patch/... //ws/app/...",
+			},
+			depotToClient: map[string]string{
+				"//depot/app/a.c":   "//ws/app/a.c",
+				"//depot/patch/a.c": "//ws/app/a.c",
+			},
+			clientToDepot: map[string]string{"//ws/app/a.c": "//depot/patch/a.c"},
+		},
+		{
+			name: "hidden", // without +, the later line hides the earlier one
+			view: []string{
+				"//depot/app/... //ws/app/...",
+				"//depot/patch/... //ws/app/...",
+			},
+			depotToClient: map[string]string{
+				"//depot/app/a.c":   "",
+				"//depot/patch/a.c": "//ws/app/a.c",
+			},
+			clientToDepot: map[string]string{"//ws/app/a.c": "//depot/patch/a.c"},
+		},
+		{
+			name: "ditto", // a second client path for the same depot file
+			view: []string{
+				"//depot/main/... //ws/main/...",
+				"&//depot/main/shared/... //ws/shared/...",
+			},
+			depotToClient: map[string]string{"//depot/main/shared/x.h": "//ws/main/shared/x.h"},
+			clientToDepot: map[string]string{
+				"//ws/main/shared/x.h": "//depot/main/shared/x.h",
+				"//ws/shared/x.h":      "//depot/main/shared/x.h",
+				"//ws/shared.h":        "",
+			},
+		},
+		{
+			name: "positional", // %%n reordered, * doesn't match /
+			view: []string{
+				"//depot/loc/%%1/%%2.txt //ws/text/%%2/%%1.txt",
+				"//depot/img/*.png //ws/img/*.png",
+				"//depot/src/....c //ws/src/....c",
+			},
+			depotToClient: map[string]string{
+				"//depot/loc/fr/menu.txt":  "//ws/text/menu/fr.txt",
+				"//depot/loc/fr/menu.po":   "",
+				"//depot/img/logo.png":     "//ws/img/logo.png",
+				"//depot/img/sub/logo.png": "",
+				"//depot/src/lib/a.c":      "//ws/src/lib/a.c",
+				"//depot/src/lib/a.h":      "",
+			},
+			clientToDepot: map[string]string{"//ws/text/menu/fr.txt": "//depot/loc/fr/menu.txt"},
+		},
+		{
+			name:            "case-insensitive",
+			caseInsensitive: true,
+			view: []string{
+				"//depot/Main/... //ws/main/...",
+				"-//depot/Main/Build/... //ws/main/build/...",
+			},
+			depotToClient: map[string]string{
+				"//depot/MAIN/a.c":         "//ws/main/a.c",
+				"//depot/main/build/x.obj": "",
+			},
+			clientToDepot: map[string]string{"//WS/Main/a.c": "//depot/Main/a.c"},
+		},
+	} {
+		v, err := ParseViewMap(vc.view)
+		if err != nil {
+			t.Fatalf("%s: %v", vc.name, err)
+		}
+		v.CaseInsensitive = vc.caseInsensitive
+		for path, want := range vc.depotToClient {
+			if got, mapped := v.DepotToClient(path); got != want || mapped != (want != "") {
+				t.Errorf("%s: %s mapped to %q (%t), expected %q", vc.name, path, got, mapped, want)
+			}
+		}
+		for path, want := range vc.clientToDepot {
+			if got, mapped := v.ClientToDepot(path); got != want || mapped != (want != "") {
+				t.Errorf("%s: %s mapped to %q (%t), expected %q", vc.name, path, got, mapped, want)
+			}
+		}
+	}
+}
+
+func TestParseViewMapErrors(t *testing.T) {
+	for _, view := range [][]string{
+		{`"" //bob_ws/...`},
+		{`//depot/... ""`},
+		{"//depot/..."},
+		{"//depot/... //bob_ws/... //bob_ws/x"},
+		{"depot/... //bob_ws/..."},
+		{"//depot/%%0/... //bob_ws/%%0/..."},
+		{"//depot/%%1/%%2 //bob_ws/%%1/%%3"},
+	} {
+		if _, err := ParseViewMap(view); err == nil {
+			t.Errorf("%q: no error", view)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package perforce
+
+// Parsing of tagged output (p4 -ztag ...)
+//
+//	... depotFile //depot/a/file.txt
+//	... clientFile //my_ws/a/file.txt
+//	... path D:\ws\a\file.txt
+//
+//	... depotFile //depot/b/file.txt
+//	...
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Fields which value may span several lines
+var ztagMultiLine = map[string]bool{
+	"desc":        true,
+	"Description": true,
+	"data":        true,
+}
+
+// parseZtag()
+//	Split tagged output in records (one map per record, field name -> value).
+//	Lines that aren't part of a record (i.e. errors and warnings such as
+//	"//depot/x - no such file(s).") are returned as messages.
+func parseZtag(out []byte) (records []map[string]string, messages []string) {
+	return parseZtagFields(out, ztagMultiLine)
+}
+
+// parseZtagFields()
+//	Same as parseZtag() with the fields which value may span several lines.
+func parseZtagFields(out []byte, multiLine map[string]bool) (records []map[string]string, messages []string) {
+	var record map[string]string
+	var lastKey string
+	ended := false // a blank line was found after a field
+
+	closeRecord := func() {
+		if record != nil {
+			for k := range multiLine {
+				if v, ok := record[k]; ok {
+					record[k] = strings.TrimRight(v, "\r\n")
+				}
+			}
+			records = append(records, record)
+		}
+		record, lastKey, ended = nil, "", false
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+
+		if strings.HasPrefix(line, "... ") {
+			key, value := line[4:], ""
+			if i := strings.Index(key, " "); i >= 0 {
+				key, value = key[:i], key[i+1:]
+			}
+			if record != nil {
+				if _, exists := record[key]; exists || (ended && !multiLine[lastKey]) {
+					closeRecord()
+				}
+			}
+			if record == nil {
+				record = make(map[string]string)
+			}
+			record[key] = value
+			lastKey, ended = key, false
+			continue
+		}
+
+		switch {
+		case len(strings.TrimSpace(line)) <= 0:
+			if record != nil && multiLine[lastKey] {
+				record[lastKey] += "\n"
+			}
+			ended = true
+		case record != nil && multiLine[lastKey]:
+			record[lastKey] += "\n" + line // Continuation of a multi-line value
+		default:
+			closeRecord()
+			messages = append(messages, line)
+		}
+	}
+	closeRecord()
+
+	return records, messages
+}
+
+// Whether the messages of a failed command are all benign (i.e. "already integrated"):
+// the error can be ignored. False if there is none.
+func allBenign(messages []string, benign *regexp.Regexp) bool {
+	for _, m := range messages {
+		if !benign.MatchString(m) {
+			return false
+		}
+	}
+	return len(messages) > 0
+}
+
+// Messages of an untagged output: the non blank lines other than the results
+func otherLines(out []byte, result *regexp.Regexp) (messages []string) {
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if len(strings.TrimSpace(line)) > 0 && !result.MatchString(line) {
+			messages = append(messages, line)
+		}
+	}
+	return messages
+}